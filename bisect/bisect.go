@@ -0,0 +1,265 @@
+// Package bisect finds the commit that made a test flaky, by measuring its failure rate at commits between a known
+// good and bad commit. Failures are random, so every commit is run until its failure rate is significantly different
+// from one of the two, rather than until it fails once.
+package bisect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/smartcontractkit/flakeguard/git"
+	"github.com/smartcontractkit/flakeguard/report"
+)
+
+// ErrSkip is returned by an Attempt when the test can't run at a commit, e.g. because it doesn't build.
+// Skipped commits are left out of the search, like with git bisect skip.
+var ErrSkip = errors.New("commit can't be tested")
+
+// Attempt runs the test once at the commit, and returns how many times the test executed and how many of those
+// executions failed.
+type Attempt func(ctx context.Context, commit git.Commit) (executions, failures int, err error)
+
+// Verdicts of a commit
+const (
+	VerdictGood    = "good"
+	VerdictBad     = "bad"
+	VerdictSkipped = "skipped"
+)
+
+// Step is the outcome of running the test at a single commit
+type Step struct {
+	Commit      git.Commit    `json:"commit"`
+	Executions  int           `json:"executions"`
+	Failures    int           `json:"failures"`
+	FailureRate float64       `json:"failure_rate"`
+	Duration    time.Duration `json:"duration"`
+	Verdict     string        `json:"verdict"`
+	// Reason explains a skipped commit, or a verdict that was reached without significance
+	Reason string `json:"reason,omitempty"`
+}
+
+func (s *Step) add(executions, failures int) {
+	s.Executions += executions
+	s.Failures += failures
+	s.FailureRate = float64(s.Failures) / float64(s.Executions)
+}
+
+// Result is the outcome of a bisection
+type Result struct {
+	Good  Step   `json:"good"`
+	Bad   Step   `json:"bad"`
+	Steps []Step `json:"steps"`
+	// FirstBad is the first commit the failure rate rose significantly at
+	FirstBad git.Commit `json:"first_bad"`
+	// Candidates are the commits the failure rate may have risen at, if skipped commits came right before FirstBad.
+	// It's empty if FirstBad is certain.
+	Candidates []git.Commit `json:"candidates,omitempty"`
+}
+
+// Options tune how long each commit is run for
+type Options struct {
+	// MaxRuns is the most executions of the test at a single commit
+	MaxRuns int
+	// Confidence is the confidence a commit's failure rate needs to differ from the good or bad commit's at
+	Confidence float64
+}
+
+// Run bisects commits, oldest first, where the first is known to be good and the last to be bad.
+// The bad commit is run MaxRuns times to know its failure rate, then the good commit until it's significantly lower.
+// Every commit tested in between is bad once its failure rate is significantly higher than the good commit's, and
+// good once it's significantly lower than the bad commit's. Commits that are still undecided at MaxRuns are judged by
+// which of the two failure rates theirs is closer to.
+func Run(ctx context.Context, l zerolog.Logger, commits []git.Commit, opts Options, attempt Attempt) (Result, error) {
+	if len(commits) < 2 {
+		return Result{}, fmt.Errorf("need a good and a bad commit to bisect")
+	}
+	if opts.MaxRuns < 1 {
+		return Result{}, fmt.Errorf("max runs must be at least 1")
+	}
+
+	var (
+		result Result
+		err    error
+	)
+	result.Bad, err = measure(ctx, l, commits[len(commits)-1], opts, attempt, func(*Step) bool { return false })
+	if err != nil {
+		return result, err
+	}
+	if result.Bad.Verdict == VerdictSkipped {
+		return result, fmt.Errorf("can't test bad commit %s: %s", result.Bad.Commit.ShortHash(), result.Bad.Reason)
+	}
+	result.Good, err = measure(ctx, l, commits[0], opts, attempt, func(good *Step) bool {
+		return significantlyHigher(result.Bad, *good, opts)
+	})
+	if err != nil {
+		return result, err
+	}
+	if result.Good.Verdict == VerdictSkipped {
+		return result, fmt.Errorf("can't test good commit %s: %s", result.Good.Commit.ShortHash(), result.Good.Reason)
+	}
+	if !significantlyHigher(result.Bad, result.Good, opts) {
+		return result, fmt.Errorf(
+			"failure rate at bad commit %s (%.2f%%) isn't significantly higher than at good commit %s (%.2f%%) after %d runs, raise the max runs or pick other commits",
+			result.Bad.Commit.ShortHash(), result.Bad.FailureRate*100,
+			result.Good.Commit.ShortHash(), result.Good.FailureRate*100,
+			opts.MaxRuns,
+		)
+	}
+	result.Good.Verdict, result.Bad.Verdict = VerdictGood, VerdictBad
+	l.Info().
+		Float64("good_failure_rate", result.Good.FailureRate).
+		Float64("bad_failure_rate", result.Bad.FailureRate).
+		Int("commits", len(commits)-2).
+		Msg("Bisecting")
+
+	low, high := 0, len(commits)-1
+	skipped := map[int]bool{}
+	for {
+		untested := []int{}
+		for i := low + 1; i < high; i++ {
+			if !skipped[i] {
+				untested = append(untested, i)
+			}
+		}
+		if len(untested) == 0 {
+			break
+		}
+		mid := untested[len(untested)/2]
+
+		step, err := measure(ctx, l, commits[mid], opts, attempt, func(s *Step) bool {
+			return significantlyHigher(*s, result.Good, opts) || significantlyHigher(result.Bad, *s, opts)
+		})
+		if err != nil {
+			return result, err
+		}
+		if step.Verdict == "" {
+			step.Verdict, step.Reason = judge(step, result.Good, result.Bad, opts)
+		}
+		result.Steps = append(result.Steps, step)
+
+		switch step.Verdict {
+		case VerdictBad:
+			high = mid
+		case VerdictGood:
+			low = mid
+		case VerdictSkipped:
+			skipped[mid] = true
+		}
+	}
+
+	result.FirstBad = commits[high]
+	for i := low + 1; i < high; i++ {
+		result.Candidates = append(result.Candidates, commits[i])
+	}
+	if len(result.Candidates) > 0 {
+		result.Candidates = append(result.Candidates, commits[high])
+	}
+	return result, nil
+}
+
+// measure runs attempts at the commit until done returns true or MaxRuns is reached
+func measure(
+	ctx context.Context,
+	l zerolog.Logger,
+	commit git.Commit,
+	opts Options,
+	attempt Attempt,
+	done func(*Step) bool,
+) (Step, error) {
+	cl := l.With().Str("commit", commit.ShortHash()).Logger()
+	cl.Info().Str("subject", commit.Subject).Msg("Testing commit")
+
+	step := Step{Commit: commit}
+	start := time.Now()
+	for step.Executions < opts.MaxRuns && (step.Executions == 0 || !done(&step)) {
+		executions, failures, err := attempt(ctx, commit)
+		if errors.Is(err, ErrSkip) {
+			step.Verdict, step.Reason = VerdictSkipped, err.Error()
+			break
+		}
+		if err != nil {
+			return step, fmt.Errorf("failed to test commit %s: %w", commit.ShortHash(), err)
+		}
+		if executions == 0 {
+			step.Verdict, step.Reason = VerdictSkipped, "test didn't run"
+			break
+		}
+		step.add(executions, failures)
+	}
+	step.Duration = time.Since(start)
+
+	cl.Info().
+		Int("executions", step.Executions).
+		Int("failures", step.Failures).
+		Str("verdict", step.Verdict).
+		Str("duration", step.Duration.String()).
+		Msg("Commit tested")
+	return step, nil
+}
+
+// judge decides whether a commit is good or bad from its failure rate
+func judge(step, good, bad Step, opts Options) (verdict, reason string) {
+	switch {
+	case significantlyHigher(step, good, opts):
+		return VerdictBad, ""
+	case significantlyHigher(bad, step, opts):
+		return VerdictGood, ""
+	case step.FailureRate-good.FailureRate > bad.FailureRate-step.FailureRate:
+		return VerdictBad, "closer to the bad commit's failure rate, but not significantly"
+	default:
+		return VerdictGood, "closer to the good commit's failure rate, but not significantly"
+	}
+}
+
+func significantlyHigher(a, b Step, opts Options) bool {
+	return report.SignificantlyHigher(a.Failures, a.Executions, b.Failures, b.Executions, opts.Confidence)
+}
+
+// WriteReport writes a human-readable table of every commit tested, and the commit the test became flaky at
+func WriteReport(w io.Writer, test string, result Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "Commit\tSubject\tExecutions\tFailures\tFailure Rate\tVerdict\tDuration\t"); err != nil {
+		return err
+	}
+	steps := append(append([]Step{result.Good}, result.Steps...), result.Bad)
+	for _, step := range steps {
+		verdict := step.Verdict
+		if step.Reason != "" {
+			verdict = fmt.Sprintf("%s (%s)", verdict, step.Reason)
+		}
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.2f%%\t%s\t%s\t\n",
+			step.Commit.ShortHash(),
+			step.Commit.Subject,
+			step.Executions,
+			step.Failures,
+			step.FailureRate*100,
+			verdict,
+			step.Duration.Round(time.Millisecond),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(result.Candidates) > 0 {
+		candidates := make([]string, 0, len(result.Candidates))
+		for _, commit := range result.Candidates {
+			candidates = append(candidates, commit.String())
+		}
+		_, err := fmt.Fprintf(w, "%s became flaky in one of these commits, the ones that couldn't be tested hide which:\n  %s\n",
+			test, strings.Join(candidates, "\n  "))
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s became flaky at %s\n", test, result.FirstBad)
+	return err
+}
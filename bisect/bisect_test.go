@@ -0,0 +1,92 @@
+package bisect
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/flakeguard/git"
+	"github.com/smartcontractkit/flakeguard/internal/testhelpers"
+)
+
+func testCommits(n int) []git.Commit {
+	commits := make([]git.Commit, 0, n)
+	for i := range n {
+		commits = append(commits, git.Commit{Hash: fmt.Sprintf("%040d", i), Subject: fmt.Sprintf("Commit %d", i)})
+	}
+	return commits
+}
+
+// flakyFrom fakes a test that fails half of its executions from the commit at index flaky onward.
+// Commits in unbuildable can't be tested.
+func flakyFrom(commits []git.Commit, flaky int, unbuildable ...int) Attempt {
+	index := make(map[string]int, len(commits))
+	for i, commit := range commits {
+		index[commit.Hash] = i
+	}
+	return func(_ context.Context, commit git.Commit) (int, int, error) {
+		for _, i := range unbuildable {
+			if index[commit.Hash] == i {
+				return 0, 0, fmt.Errorf("%w: doesn't build", ErrSkip)
+			}
+		}
+		if index[commit.Hash] >= flaky {
+			return 10, 5, nil
+		}
+		return 10, 0, nil
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	l := testhelpers.Logger(t)
+	opts := Options{MaxRuns: 50, Confidence: 0.95}
+	commits := testCommits(20)
+
+	result, err := Run(context.Background(), l, commits, opts, flakyFrom(commits, 13))
+	require.NoError(t, err)
+	require.Equal(t, commits[13], result.FirstBad)
+	require.Empty(t, result.Candidates)
+	require.Less(t, len(result.Steps), 6, "should bisect, not test every commit")
+	for _, step := range result.Steps {
+		require.Empty(t, step.Reason, "every verdict should be significant")
+	}
+
+	var report bytes.Buffer
+	require.NoError(t, WriteReport(&report, "TestFlaky", result))
+	require.Contains(t, report.String(), "TestFlaky became flaky at "+commits[13].String())
+}
+
+func TestRunSkipped(t *testing.T) {
+	t.Parallel()
+
+	l := testhelpers.Logger(t)
+	opts := Options{MaxRuns: 50, Confidence: 0.95}
+	commits := testCommits(10)
+
+	result, err := Run(context.Background(), l, commits, opts, flakyFrom(commits, 5, 4))
+	require.NoError(t, err)
+	require.Equal(t, commits[5], result.FirstBad)
+	require.Equal(t, []git.Commit{commits[4], commits[5]}, result.Candidates, "skipped commit before the first bad one hides which is first")
+
+	var report bytes.Buffer
+	require.NoError(t, WriteReport(&report, "TestFlaky", result))
+	require.Contains(t, report.String(), "skipped (commit can't be tested: doesn't build)")
+	require.Contains(t, report.String(), "became flaky in one of these commits")
+}
+
+func TestRunNotFlakier(t *testing.T) {
+	t.Parallel()
+
+	l := testhelpers.Logger(t)
+	commits := testCommits(5)
+	_, err := Run(context.Background(), l, commits, Options{MaxRuns: 50, Confidence: 0.95}, flakyFrom(commits, 0))
+	require.ErrorContains(t, err, "isn't significantly higher")
+
+	_, err = Run(context.Background(), l, commits, Options{MaxRuns: 50, Confidence: 0.95}, flakyFrom(commits, 2, 0))
+	require.ErrorContains(t, err, "can't test good commit")
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/smartcontractkit/flakeguard/bisect"
+	"github.com/smartcontractkit/flakeguard/exit"
+	"github.com/smartcontractkit/flakeguard/git"
+	"github.com/smartcontractkit/flakeguard/report"
+	"github.com/smartcontractkit/flakeguard/runner"
+)
+
+const (
+	bisectFileOutput = "bisect-test-output-%d.json"
+	bisectReportFile = "bisect-report.json"
+)
+
+var (
+	// Bisect specific flags
+	bisectPackage    string
+	bisectGood       string
+	bisectBad        string
+	bisectBatch      int
+	bisectMaxRuns    int
+	bisectConfidence float64
+)
+
+var bisectCmd = &cobra.Command{
+	Use:   "bisect <test> --package <package> --good <commit> [--bad <commit>] [flakeguard flags] -- [gotestsum flags] -- [go test flags]",
+	Short: "Find the commit that made a test flaky",
+	Long: `Find the commit that made a test flaky, by bisecting the first-parent history between a commit where the test
+was stable and one where it's flaky.
+
+Every commit is checked out into a temporary worktree, leaving your own checkout alone, and the test is run there in
+batches of --batch until its failure rate is significantly higher than at the good commit, or significantly lower than
+at the bad commit, at --bisect-confidence. Commits that don't build, or don't have the test, are skipped.
+
+Examples:
+  flakeguard bisect TestFlakeTenPercent --package ./flaky --good v1.2.0 -- -- -tags examples
+  flakeguard bisect TestMyFlake --package github.com/org/repo/pkg --good 1a2b3c4 --bad main --bisect-max-runs 500`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		// Only the test name comes before the gotestsum and go test flags
+		if dash := cmd.ArgsLenAtDash(); len(args) == 0 || (dash != -1 && dash != 1) || (dash == -1 && len(args) != 1) {
+			return fmt.Errorf("expected a single test name before any gotestsum and go test flags")
+		}
+		return nil
+	},
+	RunE: runBisectCmd,
+}
+
+func runBisectCmd(cmd *cobra.Command, args []string) error {
+	test := args[0]
+	originalGotestsumFlags, goTestFlags := parseArgs(args[1:])
+	logger.Info().
+		Str("test", test).
+		Str("package", bisectPackage).
+		Str("good", bisectGood).
+		Str("bad", bisectBad).
+		Int("batch", bisectBatch).
+		Int("max_runs", bisectMaxRuns).
+		Float64("confidence", bisectConfidence).
+		Strs("entered_gotestsum_flags", originalGotestsumFlags).
+		Strs("entered_go_test_flags", goTestFlags).
+		Msg("Bisecting flaky test")
+
+	if slices.Contains(originalGotestsumFlags, "--jsonfile") {
+		return fmt.Errorf("jsonfile flag cannot be overridden while using flakeguard")
+	}
+	for _, flag := range goTestFlags {
+		if strings.HasPrefix(flag, "-count=") {
+			return fmt.Errorf("-count flag in go test cannot be overridden while using flakeguard, use --batch instead")
+		}
+	}
+	if bisectBatch < 1 {
+		return fmt.Errorf("--batch must be at least 1")
+	}
+	if bisectConfidence <= 0 || bisectConfidence >= 1 {
+		return fmt.Errorf("--bisect-confidence must be between 0 and 1")
+	}
+
+	pkg, err := resolvePackage(bisectPackage, runner.BuildFlags(goTestFlags))
+	if err != nil {
+		return err
+	}
+	commits, err := git.Commits(".", bisectGood, bisectBad)
+	if err != nil {
+		return exit.New(exit.CodeFlakeguardError, err)
+	}
+
+	wt, err := git.NewWorktree(logger, ".")
+	if err != nil {
+		return exit.New(exit.CodeFlakeguardError, err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			logger.Warn().Err(err).Str("dir", wt.Dir()).Msg("Failed to remove bisect worktree")
+		}
+	}()
+	// Run from the same directory in the worktree as we're in, the module may not be at the root of the repository
+	workDir, err := wt.Path(".")
+	if err != nil {
+		return exit.New(exit.CodeFlakeguardError, err)
+	}
+
+	var (
+		r          *runner.Runner
+		checkedOut string
+		nextRun    = 1
+	)
+	defer func() {
+		if r != nil {
+			if err := r.Close(); err != nil {
+				logger.Warn().Err(err).Msg("Failed to clean up compiled test binaries")
+			}
+		}
+	}()
+	topLevel, _, _ := strings.Cut(test, "/")
+	attempt := func(ctx context.Context, commit git.Commit) (int, int, error) {
+		if commit.Hash != checkedOut {
+			if r != nil {
+				if err := r.Close(); err != nil {
+					logger.Warn().Err(err).Msg("Failed to clean up compiled test binaries")
+				}
+			}
+			if err := wt.Checkout(commit.Hash); err != nil {
+				return 0, 0, err
+			}
+			checkedOut = commit.Hash
+			// Each commit compiles its test binary once, and reuses it for every batch
+			commitRunner, err := runner.New(
+				logger,
+				runner.WithDir(outputDir),
+				runner.WithFileFormat(bisectFileOutput),
+				runner.WithWorkDir(workDir),
+				runner.WithCompiledBinaries(),
+			)
+			if err != nil {
+				return 0, 0, err
+			}
+			r = commitRunner
+		}
+
+		flags := runner.NarrowGoTestFlags(goTestFlags, []string{pkg}, []string{topLevel})
+		flags = append(flags, fmt.Sprintf("-count=%d", bisectBatch))
+		run, err := r.Run(ctx, runner.Spec{
+			Number:         nextRun,
+			GotestsumFlags: originalGotestsumFlags,
+			GoTestFlags:    flags,
+		}, 0, false)
+		nextRun++
+		if exit.GetCode(err) == exit.CodeGoBuildError {
+			return 0, 0, fmt.Errorf("%w: doesn't build", bisect.ErrSkip)
+		} else if err != nil {
+			return 0, 0, err
+		}
+		results, err := report.Analyze(logger, outputDir, []report.Run{run}, nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, result := range results {
+			if result.Package == pkg && result.Name == test {
+				return result.Runs, result.Runs - result.Successes, nil
+			}
+		}
+		return 0, 0, nil
+	}
+
+	fmt.Printf("Bisecting %s in %s across %d commits\n", test, pkg, len(commits))
+	result, err := bisect.Run(
+		cmd.Context(),
+		logger,
+		commits,
+		bisect.Options{MaxRuns: bisectMaxRuns, Confidence: bisectConfidence},
+		attempt,
+	)
+	if err != nil {
+		return err
+	}
+	if err := bisect.WriteReport(os.Stdout, test, result); err != nil {
+		return fmt.Errorf("failed to write bisect report: %w", err)
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bisect result: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, bisectReportFile), resultJSON, 0600); err != nil {
+		return fmt.Errorf("failed to write bisect report: %w", err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(bisectCmd)
+	bisectCmd.Flags().
+		StringVar(&bisectPackage, "package", "", "Import path or directory of the package the test is in")
+	bisectCmd.Flags().
+		StringVar(&bisectGood, "good", "", "Commit, branch, or tag where the test was stable")
+	bisectCmd.Flags().
+		StringVar(&bisectBad, "bad", "HEAD", "Commit, branch, or tag where the test is flaky. The good commit must be in its first-parent history.")
+	bisectCmd.Flags().
+		IntVar(&bisectBatch, "batch", 20, "How many times each attempt runs the test with go test -count")
+	bisectCmd.Flags().
+		IntVar(&bisectMaxRuns, "bisect-max-runs", 200, "Most times the test runs at a single commit. Raise it for tests that rarely fail.")
+	bisectCmd.Flags().
+		Float64Var(&bisectConfidence, "bisect-confidence", 0.95, "Statistical confidence a commit's failure rate needs to differ from the good or bad commit's at")
+	_ = bisectCmd.MarkFlagRequired("package")
+	_ = bisectCmd.MarkFlagRequired("good")
+}
@@ -1,11 +1,65 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/flakeguard/config"
+	fg_github "github.com/smartcontractkit/flakeguard/github"
+	"github.com/smartcontractkit/flakeguard/history"
+	"github.com/smartcontractkit/flakeguard/internal/testhelpers"
+	"github.com/smartcontractkit/flakeguard/report"
+	"github.com/smartcontractkit/flakeguard/runner"
+	"github.com/smartcontractkit/flakeguard/ticket"
 )
 
+func TestBisectConfig(t *testing.T) {
+	// Sets bisect's flags, so it can't run in parallel with anything reading them.
+	flags := bisectCmd.LocalNonPersistentFlags()
+	t.Cleanup(func() {
+		for _, name := range []string{"bisect-max-runs", "bisect-confidence"} {
+			flag := flags.Lookup(name)
+			require.NoError(t, flag.Value.Set(flag.DefValue))
+			flag.Changed = false
+		}
+	})
+
+	path := filepath.Join(t.TempDir(), config.FileName)
+	require.NoError(t, os.WriteFile(path, []byte(`
+thresholds:
+  max_runs: 7
+  confidence: 0.5
+bisect:
+  confidence: 0.99
+`), 0600))
+	file, err := config.Load(path, configSettings)
+	require.NoError(t, err)
+	env := map[string]string{"FLAKEGUARD_MAX_RUNS": "9", "FLAKEGUARD_CONFIDENCE": "0.6"}
+	lookupEnv := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	_, err = config.Apply(flags, file, configSettings, lookupEnv)
+	require.NoError(t, err)
+	require.Equal(t, 200, bisectMaxRuns, "detect's max runs shouldn't reach bisect")
+	require.InDelta(t, 0.99, bisectConfidence, 0, "bisect should read its own confidence")
+
+	seen := map[string]string{}
+	for _, setting := range configSettings {
+		key, dup := seen[setting.Flag]
+		require.False(t, dup, "--%s is set by both %s and %s", setting.Flag, key, setting.Key)
+		seen[setting.Flag] = setting.Key
+	}
+}
+
 func TestParseArgs(t *testing.T) {
 	t.Parallel()
 
@@ -97,3 +151,274 @@ func TestParseArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestDetectSession(t *testing.T) {
+	t.Parallel()
+
+	var (
+		l   = testhelpers.Logger(t)
+		dir = t.TempDir()
+	)
+	session, err := newDetectSession(dir, []string{"--format", "dots"}, []string{"./..."}, report.TestRunInfo{RepoName: "repo"})
+	require.NoError(t, err)
+
+	for number := 1; number <= 2; number++ {
+		file := fmt.Sprintf(detectFileOutput, number)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte("{}"), 0600))
+		require.NoError(t, session.addRun(report.Run{Number: number, File: file, Phase: report.PhaseFull}))
+	}
+	require.NoError(t, os.Remove(filepath.Join(dir, fmt.Sprintf(detectFileOutput, 2))))
+
+	resumed, err := loadDetectSession(l, dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"--format", "dots"}, resumed.GotestsumFlags)
+	require.Equal(t, []string{"./..."}, resumed.GoTestFlags)
+	require.Equal(t, "repo", resumed.TestRunInfo.RepoName)
+	require.True(t, resumed.completed(1))
+	require.False(t, resumed.completed(2), "runs with missing output should run again")
+
+	_, err = loadDetectSession(l, t.TempDir())
+	require.Error(t, err, "should error when there's no session to resume")
+}
+
+func TestEstimateRunDuration(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	completedRuns := []report.Run{}
+	// An early long run shouldn't count once enough shorter runs came after it
+	for i, duration := range []time.Duration{time.Hour, 5, 3, 8, 2, 4} {
+		completedRuns = append(completedRuns, report.Run{
+			Number:   i + 1,
+			Started:  start.Add(time.Duration(i) * time.Second),
+			Duration: duration * time.Second,
+		})
+	}
+	require.Equal(t, 8*time.Second, estimateRunDuration(completedRuns))
+	require.Zero(t, estimateRunDuration(nil))
+}
+
+func TestRunAdaptiveStopsWithoutProgress(t *testing.T) {
+	// Sets detect's output dir, so it can't run in parallel with anything reading it.
+	previousOutputDir := outputDir
+	outputDir = t.TempDir()
+	t.Cleanup(func() { outputDir = previousOutputDir })
+
+	session, err := newDetectSession(outputDir, nil, []string{"./pkg"}, report.TestRunInfo{})
+	require.NoError(t, err)
+	fullRun := fmt.Sprintf(detectFileOutput, 1)
+	require.NoError(t, os.WriteFile(filepath.Join(outputDir, fullRun), []byte(`{"Action":"run","Package":"pkg","Test":"TestFlaky"}
+{"Action":"fail","Package":"pkg","Test":"TestFlaky","Elapsed":0.1}
+{"Action":"fail","Package":"pkg","Elapsed":0.1}
+`), 0600))
+	require.NoError(t, session.addRun(report.Run{Number: 1, File: fullRun, Phase: report.PhaseFull}))
+
+	// The flaky test skips from now on, so re-running it never adds runs
+	fake := filepath.Join(t.TempDir(), "fake-flakeguard")
+	//nolint:gosec // G306: the fake needs to be executable
+	require.NoError(t, os.WriteFile(fake, []byte(`#!/bin/sh
+while [ "$1" != "--jsonfile" ]; do shift; done
+cat > "$2" <<JSON
+{"Action":"run","Package":"pkg","Test":"TestFlaky"}
+{"Action":"skip","Package":"pkg","Test":"TestFlaky","Elapsed":0}
+{"Action":"pass","Package":"pkg","Elapsed":0.1}
+JSON
+`), 0700))
+	r, err := runner.New(testhelpers.Logger(t),
+		runner.WithDir(outputDir),
+		runner.WithFileFormat(detectFileOutput),
+		runner.WithExecutable(fake),
+		runner.WithOutput(io.Discard, io.Discard),
+		runner.WithRunCompleted(func(run report.Run) { require.NoError(t, session.addRun(run)) }),
+	)
+	require.NoError(t, err)
+
+	checks := 0
+	withinDurationTarget := func() bool {
+		checks++
+		return checks < 100
+	}
+	require.NoError(t, runAdaptive(t.Context(), r, session, runner.Matrix{}, nil, []string{"./pkg"}, withinDurationTarget))
+	adaptiveRuns := 0
+	for _, run := range session.runs() {
+		if run.Phase == report.PhaseAdaptive {
+			adaptiveRuns++
+		}
+	}
+	require.Equal(t, 1, adaptiveRuns, "adaptive runs should stop after a batch that didn't run the suspicious test again")
+}
+
+func TestFailingTests(t *testing.T) {
+	t.Parallel()
+
+	results := []*report.TestResult{
+		{Package: "pkg", Name: "TestPass", Runs: 1, Successes: 1},
+		{Package: "pkg", Name: "TestFlaky", Runs: 2, Successes: 1, Failures: 1, FailingRunNumbers: []int{1}},
+		{Package: "pkg", Name: "TestFail/sub", Runs: 2, Failures: 2, FailingRunNumbers: []int{1, 2}},
+		{Package: "pkg", Name: "TestFail", Runs: 2, Failures: 2, FailingRunNumbers: []int{1, 2}},
+		{Package: "other", Name: "TestPanic", Runs: 1, Panic: true, FailingRunNumbers: []int{1}},
+	}
+	packages, tests := failingTests(results)
+	require.Equal(t, []string{"pkg", "other"}, packages)
+	require.Equal(t, []string{"TestFail", "TestPanic"}, tests, "tests that passed since they failed shouldn't be retried")
+}
+
+func TestQuarantineFiles(t *testing.T) {
+	t.Parallel()
+
+	src := map[string][]byte{
+		"pkg/a_test.go": []byte("package pkg\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) {}\n\nfunc TestB(t *testing.T) {}\n"),
+	}
+	read := func(path string) ([]byte, error) { return src[path], nil }
+	candidates := []*quarantineCandidate{
+		{Stats: history.Stats{Package: "pkg", Test: "TestA", Runs: 10, Failures: 5}, Path: "pkg/a_test.go", Owners: []string{"@org/team"}},
+		{Stats: history.Stats{Package: "pkg", Test: "TestB", Runs: 10, Failures: 2}, Path: "pkg/a_test.go"},
+		{Stats: history.Stats{Package: "pkg", Test: "TestGone", Runs: 10, Failures: 1}, Path: "pkg/a_test.go"},
+		{Stats: history.Stats{Package: "pkg", Test: "TestC/sub", Runs: 10, Failures: 1}, Problem: "subtests have to be quarantined by hand"},
+	}
+
+	files, err := quarantineFiles(read, "main", candidates)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	quarantined := string(files["pkg/a_test.go"])
+	require.Contains(t, quarantined, "flakeguard.Quarantine(t, \"Flaky: failed 50.00% of 10 runs on main, quarantined by flakeguard\")")
+	require.Contains(t, quarantined, "flakeguard.Quarantine(t, \"Flaky: failed 20.00% of 10 runs on main, quarantined by flakeguard\")")
+
+	body := quarantineBody("main", candidates)
+	require.Contains(t, body, "| `TestA` | `pkg` | 50.00% | 10 | - | @org/team | - |")
+	require.Contains(t, body, "| `TestB` | `pkg` | 20.00% | 10 | - | - | - |")
+	require.Contains(t, body, "- `TestGone` in `pkg` (10.00% of 10 runs): test not found")
+	require.Contains(t, body, "- `TestC/sub` in `pkg` (10.00% of 10 runs): subtests have to be quarantined by hand")
+}
+
+// fakeTicketer keeps tickets in memory
+type fakeTicketer struct {
+	open   []ticket.Ticket
+	closed []string
+}
+
+func (f *fakeTicketer) Report(_ context.Context, o ticket.Occurrence) (ticket.Ticket, error) {
+	return ticket.Ticket{Package: o.Package, Test: o.Test, ID: "#" + o.Test}, nil
+}
+
+func (f *fakeTicketer) Open(context.Context) ([]ticket.Ticket, error) {
+	return f.open, nil
+}
+
+func (f *fakeTicketer) MarkQuarantined(context.Context, ticket.Ticket) error {
+	return nil
+}
+
+func (f *fakeTicketer) Close(_ context.Context, tk ticket.Ticket, _ string) error {
+	f.closed = append(f.closed, tk.Test)
+	return nil
+}
+
+func TestTicketQuarantines(t *testing.T) {
+	t.Parallel()
+
+	const pkg = "github.com/smartcontractkit/flakeguard/cmd"
+	ticketer := &fakeTicketer{open: []ticket.Ticket{
+		{Package: pkg, Test: "TestPendingQuarantine"},
+		{Package: pkg, Test: "TestReinstated", Quarantined: true},
+		{Package: pkg, Test: "TestStillFlaky", Quarantined: true},
+		{Package: pkg, Test: "TestSub/case", Quarantined: true},
+	}}
+	candidates := []*quarantineCandidate{{Stats: history.Stats{Package: pkg, Test: "TestStillFlaky", Runs: 10, Failures: 5}}}
+
+	require.NoError(t, ticketQuarantines(t.Context(), ticketer, "main", candidates, nil))
+	require.Equal(t, "[#TestStillFlaky]()", candidates[0].Ticket)
+	require.Equal(t, []string{"TestReinstated"}, ticketer.closed,
+		"only tickets of tests that were quarantined on the base branch should be closed once they aren't")
+}
+
+func TestAlreadyFlaky(t *testing.T) {
+	t.Parallel()
+
+	flaky := map[[2]string]bool{{"pkg", "TestFlaky"}: true, {"pkg", "TestFew"}: true, {"pkg", "TestOnce"}: true}
+	stats := func(test string, runs, failures int) history.Stats {
+		return history.Stats{Package: "pkg", Test: test, Runs: runs, Failures: failures}
+	}
+	isAlreadyFlaky := alreadyFlaky(flaky)
+	require.True(t, isAlreadyFlaky(stats("TestFlaky", 100, 10)))
+	require.False(t, isAlreadyFlaky(stats("TestOnce", 100, 1)), "a single failure on the base branch shouldn't be enough")
+	require.False(t, isAlreadyFlaky(stats("TestFew", 10, 5)), "tests under --min-runs shouldn't be judged")
+	require.False(t, isAlreadyFlaky(stats("TestStable", 100, 10)), "tests that weren't flaky in the session should be left alone")
+}
+
+func TestQuarantineComment(t *testing.T) {
+	t.Parallel()
+
+	candidates := []*quarantineCandidate{
+		{Stats: history.Stats{Package: "pkg", Test: "TestA", Runs: 10, Failures: 5}, Quarantined: true},
+		{Stats: history.Stats{Package: "pkg", Test: "TestB/sub", Runs: 10, Failures: 1}, Problem: "subtests have to be quarantined by hand"},
+	}
+	pushed := fg_github.PushedCommit{SHA: "abc123", Branch: "feature", Reapplied: true}
+	comment := quarantineComment("main", candidates, pushed, nil)
+	require.Contains(t, comment, "quarantined them in abc123")
+	require.Contains(t, comment, "the quarantines were made on top of them")
+	require.Contains(t, comment, "- `TestA` in `pkg`: failed 50.00% of 10 runs on `main`")
+	require.Contains(t, comment, "- `TestB/sub` in `pkg`: subtests have to be quarantined by hand")
+
+	comment = quarantineComment("main", candidates, fg_github.PushedCommit{}, fg_github.ErrCannotPush)
+	require.Contains(t, comment, "Flakeguard can't push to this branch")
+	require.Contains(t, comment, "- `TestB/sub` in `pkg`: failed 10.00% of 10 runs on `main`", "every test needs a hand")
+}
+
+func TestAddActionsInfo(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	prEvent := filepath.Join(dir, "pull_request.json")
+	require.NoError(t, os.WriteFile(prEvent, []byte(`{
+		"pull_request": {"number": 7, "head": {"ref": "feature", "sha": "head123"}, "base": {"ref": "main", "sha": "base456"}},
+		"repository": {"default_branch": "main"}
+	}`), 0600))
+	mergeGroupEvent := filepath.Join(dir, "merge_group.json")
+	require.NoError(t, os.WriteFile(mergeGroupEvent, []byte(`{
+		"merge_group": {"head_sha": "queue123", "head_ref": "refs/heads/gh-readonly-queue/main/pr-7-head123", "base_sha": "base456", "base_ref": "refs/heads/main"},
+		"repository": {"default_branch": "main"}
+	}`), 0600))
+
+	githubEnv := fg_github.ActionsEnv{
+		EventName:  "pull_request",
+		EventPath:  prEvent,
+		Ref:        "refs/pull/7/merge",
+		Workflow:   "CI",
+		RunID:      1234,
+		RunNumber:  56,
+		RunAttempt: "2",
+		RunnerName: "runner-1",
+	}
+	info := report.TestRunInfo{HeadBranch: "HEAD", HeadCommit: "merge789"}
+	require.NoError(t, addActionsInfo(&info, githubEnv))
+	require.Equal(t, report.TestRunInfo{
+		DefaultBranch:     "main",
+		HeadBranch:        "feature",
+		HeadCommit:        "head123",
+		BaseBranch:        "main",
+		BaseCommit:        "base456",
+		GitHubEvent:       "pull_request",
+		GitHubWorkflow:    "CI",
+		GitHubRunID:       "1234",
+		GitHubRunNumber:   "56",
+		GitHubRunAttempt:  "2",
+		RunnerName:        "runner-1",
+		PullRequestNumber: 7,
+	}, info)
+
+	githubEnv.EventName, githubEnv.EventPath = "merge_group", mergeGroupEvent
+	githubEnv.Ref = "refs/heads/gh-readonly-queue/main/pr-7-head123"
+	info = report.TestRunInfo{HeadBranch: "HEAD", HeadCommit: "queue123"}
+	require.NoError(t, addActionsInfo(&info, githubEnv))
+	require.Equal(t, "gh-readonly-queue/main/pr-7-head123", info.HeadBranch)
+	require.Equal(t, "queue123", info.HeadCommit)
+	require.Equal(t, "main", info.BaseBranch)
+	require.Equal(t, "base456", info.BaseCommit)
+	require.Zero(t, info.PullRequestNumber)
+
+	githubEnv = fg_github.ActionsEnv{EventName: "push", Ref: "refs/heads/main", SHA: "push123"}
+	info = report.TestRunInfo{HeadBranch: "HEAD", HeadCommit: "push123"}
+	require.NoError(t, addActionsInfo(&info, githubEnv))
+	require.Equal(t, "main", info.HeadBranch, "branch should come from the workflow, not the detached HEAD")
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/smartcontractkit/flakeguard/config"
+	"github.com/smartcontractkit/flakeguard/exit"
+)
+
+// configSettings binds the keys of the configuration file to flags
+var configSettings = []config.Setting{
+	{Key: "runs", Flag: "runs"},
+	{Key: "output_dir", Flag: "output-dir"},
+	{Key: "log.file", Flag: "log-file"},
+	{Key: "log.level", Flag: "log-level"},
+	{Key: "log.console", Flag: "enable-console-logs"},
+	{Key: "github.token", Flag: "github-token", Secret: true},
+	{Key: "github.api_url", Flag: "github-api-url"},
+	{Key: "github.graphql_url", Flag: "github-graphql-url"},
+	{Key: "github.ca_file", Flag: "github-ca-file"},
+	{Key: "github.app.id", Flag: "github-app-id"},
+	{Key: "github.app.installation_id", Flag: "github-app-installation-id"},
+	{Key: "github.app.private_key", Flag: "github-app-private-key", Secret: true},
+	{Key: "github.pr_comment", Flag: "pr-comment"},
+	{Key: "github.check_run", Flag: "check-run"},
+	{Key: "github.workflow_commands", Flag: "workflow-commands"},
+	{Key: "github.quarantine_pr", Flag: "quarantine-pr"},
+
+	{Key: "ignore.packages", Flag: "ignore-package"},
+	{Key: "ignore.tests", Flag: "ignore-test"},
+	{Key: "focus.packages", Flag: "focus-package"},
+	{Key: "focus.tests", Flag: "focus-test"},
+
+	{Key: "detect.parallel_runs", Flag: "parallel-runs"},
+	{Key: "detect.sequential_runs", Flag: "sequential-runs"},
+	{Key: "detect.compile_once", Flag: "compile-once"},
+	{Key: "detect.duration_target", Flag: "duration-target"},
+	{Key: "detect.strict_duration_target", Flag: "strict-duration-target"},
+	{Key: "detect.run_timeout", Flag: "run-timeout"},
+	{Key: "detect.stall_timeout", Flag: "stall-timeout"},
+	{Key: "detect.matrix", Flag: "matrix"},
+	{Key: "detect.adaptive", Flag: "adaptive"},
+
+	{Key: "thresholds.max_runs", Flag: "max-runs"},
+	{Key: "thresholds.confidence", Flag: "confidence"},
+	{Key: "thresholds.precision", Flag: "precision"},
+
+	{Key: "history.file", Flag: "history-file"},
+	{Key: "history.days", Flag: "days"},
+	{Key: "history.source", Flag: "history-source"},
+	{Key: "history.window", Flag: "history-window"},
+	{Key: "history.artifact", Flag: "history-artifact"},
+	{Key: "history.cache_dir", Flag: "history-cache-dir"},
+
+	{Key: "reproduce.budget", Flag: "budget"},
+	{Key: "reproduce.count", Flag: "count"},
+
+	{Key: "bisect.batch", Flag: "batch"},
+	{Key: "bisect.max_runs", Flag: "bisect-max-runs"},
+	{Key: "bisect.confidence", Flag: "bisect-confidence"},
+
+	{Key: "quarantine.threshold", Flag: "threshold"},
+	{Key: "quarantine.min_runs", Flag: "min-runs"},
+	{Key: "quarantine.base", Flag: "base"},
+	{Key: "quarantine.pr_branch", Flag: "pr-branch"},
+	{Key: "quarantine.history_link", Flag: "history-link"},
+	{Key: "quarantine.ticketer", Flag: "ticketer"},
+
+	{Key: "reporters.splunk.url", Flag: "splunk-url"},
+	{Key: "reporters.splunk.token", Flag: "splunk-token", Secret: true},
+	{Key: "reporters.splunk.index", Flag: "splunk-index"},
+	{Key: "reporters.splunk.source_type", Flag: "splunk-source-type"},
+	{Key: "reporters.splunk.search_url", Flag: "splunk-search-url"},
+	{Key: "reporters.splunk.search_token", Flag: "splunk-search-token", Secret: true},
+	{Key: "reporters.dx.webhook_url", Flag: "dx-webhook-url", Secret: true},
+	{Key: "reporters.slack.webhook_url", Flag: "slack-webhook-url", Secret: true},
+}
+
+var (
+	configFile string
+
+	// configFileUsed is the configuration file that was applied, if any
+	configFileUsed *config.File
+	// rootConfig is the effective configuration of the flags the running command was given
+	rootConfig []config.Effective
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect flakeguard's configuration",
+	Long: fmt.Sprintf(`Inspect flakeguard's configuration.
+
+Flakeguard reads %s from the root of the repository it runs in, or the file given with --config.
+Every setting stands in for a flag. Flags take precedence over %s* env vars, which take precedence over the file.`,
+		config.FileName, config.EnvPrefix,
+	),
+}
+
+var configPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print the effective configuration",
+	Long: `Print the effective configuration of every command, merged from flags, env vars, and the configuration file.
+Each value is commented with where it came from. Secrets are redacted.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		effective := rootConfig
+		// Settings for other commands' flags weren't applied yet
+		for _, c := range []*cobra.Command{detectCmd, reproduceCmd, bisectCmd, historyCmd, quarantineCmd} {
+			commandConfig, err := config.Apply(c.LocalNonPersistentFlags(), configFileUsed, configSettings, os.LookupEnv)
+			if err != nil {
+				return exit.New(exit.CodeFlakeguardError, err)
+			}
+			effective = append(effective, commandConfig...)
+		}
+		if configFileUsed != nil {
+			fmt.Fprintf(cmd.OutOrStdout(), "# %s\n", configFileUsed.Path)
+		}
+		if err := config.Print(cmd.OutOrStdout(), sortedConfig(effective)); err != nil {
+			return exit.New(exit.CodeFlakeguardError, err)
+		}
+		return nil
+	},
+}
+
+// applyConfig sets the command's flags that weren't given on the command line from env vars and the configuration file
+func applyConfig(cmd *cobra.Command) error {
+	path := configFile
+	if path == "" {
+		var err error
+		path, err = config.Find(".")
+		if err != nil {
+			return err
+		}
+	}
+	if path != "" {
+		var err error
+		configFileUsed, err = config.Load(path, configSettings)
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	rootConfig, err = config.Apply(cmd.Flags(), configFileUsed, configSettings, os.LookupEnv)
+	return err
+}
+
+// configFilePath is the path of the configuration file that was applied, or "" if there was none
+func configFilePath() string {
+	if configFileUsed == nil {
+		return ""
+	}
+	return configFileUsed.Path
+}
+
+// sortedConfig orders effective settings the same way as configSettings
+func sortedConfig(effective []config.Effective) []config.Effective {
+	sorted := make([]config.Effective, 0, len(effective))
+	for _, setting := range configSettings {
+		for _, e := range effective {
+			if e.Key == setting.Key {
+				sorted = append(sorted, e)
+				break
+			}
+		}
+	}
+	return sorted
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configPrintCmd)
+}
@@ -1,20 +1,18 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
-	"path/filepath"
 	"slices"
 	"strings"
-	"syscall"
 	"time"
 
-	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
-	gotestsumCmd "gotest.tools/gotestsum/cmd"
 
 	"github.com/smartcontractkit/flakeguard/exit"
+	fg_github "github.com/smartcontractkit/flakeguard/github"
 	"github.com/smartcontractkit/flakeguard/report"
+	"github.com/smartcontractkit/flakeguard/runner"
 )
 
 const detectFileOutput = "detect-test-output-%d.json"
@@ -22,6 +20,18 @@ const detectFileOutput = "detect-test-output-%d.json"
 var (
 	// Detect specific flags
 	durationTarget time.Duration
+	parallelRuns   int
+	sequentialRuns int
+	compileOnce    bool
+	adaptive       bool
+	maxRuns        int
+	confidence     float64
+	precision      float64
+	matrixFlags    []string
+	resume         bool
+	runTimeout     time.Duration
+	stallTimeout   time.Duration
+	strictDuration bool
 )
 
 var detectCmd = &cobra.Command{
@@ -33,112 +43,408 @@ Test results are analyzed to determine which tests are flaky, and results are re
 	RunE: runDetectCmd,
 }
 
-func runDetectCmd(_ *cobra.Command, args []string) error {
+func runDetectCmd(cmd *cobra.Command, args []string) error {
 	originalGotestsumFlags, goTestFlags := parseArgs(args)
 	logger.Info().
 		Int("runs", runs).
+		Int("parallel_runs", parallelRuns).
+		Int("sequential_runs", sequentialRuns).
+		Bool("compile_once", compileOnce).
+		Bool("adaptive", adaptive).
+		Strs("matrix", matrixFlags).
+		Bool("resume", resume).
+		Str("run_timeout", runTimeout.String()).
+		Str("stall_timeout", stallTimeout.String()).
+		Bool("strict_duration_target", strictDuration).
 		Strs("entered_gotestsum_flags", originalGotestsumFlags).
 		Strs("entered_go_test_flags", goTestFlags).
 		Strs("entered_args", args).
 		Msg("Detecting flaky tests")
 	fmt.Println("Detecting flaky tests")
 
+	var (
+		session *detectSession
+		err     error
+	)
+	if resume {
+		session, err = loadDetectSession(logger, outputDir)
+		if err != nil {
+			return err
+		}
+		if len(args) > 0 &&
+			(!slices.Equal(originalGotestsumFlags, session.GotestsumFlags) || !slices.Equal(goTestFlags, session.GoTestFlags)) {
+			return fmt.Errorf(
+				"gotestsum and go test flags can't change when resuming a session, the session uses '%s -- %s'",
+				strings.Join(session.GotestsumFlags, " "), strings.Join(session.GoTestFlags, " "),
+			)
+		}
+		originalGotestsumFlags, goTestFlags = session.GotestsumFlags, session.GoTestFlags
+		logger.Info().
+			Time("session_started", session.Started).
+			Int("completed_runs", len(session.CompletedRuns)).
+			Msg("Resuming detect session")
+		fmt.Printf("Resuming detect session with %d completed runs\n", len(session.CompletedRuns))
+	}
+
 	if slices.Contains(originalGotestsumFlags, "--jsonfile") {
 		return fmt.Errorf("jsonfile flag cannot be overridden while using flakeguard")
 	}
 
-	// Intentionally set -count=1 to avoid caching test results during detection
-	for _, flag := range goTestFlags {
-		if strings.HasPrefix(flag, "-count=") {
-			return fmt.Errorf("-count flag in go test cannot be overridden while using flakeguard")
-		}
+	runGoTestFlags, err := uncachedGoTestFlags(slices.Clone(goTestFlags))
+	if err != nil {
+		return err
+	}
+	runGoTestFlags, exclusions, err := selectTests(cmd.Context(), runGoTestFlags)
+	if err != nil {
+		return err
+	}
+	if len(exclusions) > 0 {
+		logger.Info().
+			Int("exclusions", len(exclusions)).
+			Strs("go_test_flags", runGoTestFlags).
+			Msg("Left out ignored packages and tests")
 	}
-	goTestFlags = append(goTestFlags, "-count=1")
 
-	testRunInfo, err := testRunInfo(logger, githubClient, ".")
+	if adaptive && (confidence <= 0 || confidence >= 1 || precision <= 0 || precision >= 1) {
+		return fmt.Errorf("--confidence and --precision must be between 0 and 1")
+	}
+
+	matrix, err := runner.ParseMatrix(matrixFlags)
 	if err != nil {
-		return fmt.Errorf("failed to get test run info: %w", err)
+		return err
 	}
 
-	startTime := time.Now()
-	detectFiles := []string{}
-	for run := range runs {
-		detectFile, err := runDetect(logger, run, originalGotestsumFlags, goTestFlags)
+	if session == nil {
+		testRunInfo, err := testRunInfo(cmd.Context(), logger, githubClient, ".")
+		if err != nil {
+			return fmt.Errorf("failed to get test run info: %w", err)
+		}
+		session, err = newDetectSession(outputDir, originalGotestsumFlags, goTestFlags, testRunInfo)
 		if err != nil {
 			return err
 		}
-		detectFiles = append(detectFiles, detectFile)
-		if durationTarget > 0 {
-			if time.Since(startTime) > durationTarget {
-				logger.Warn().
-					Str("duration_target", durationTarget.String()).
-					Str("elapsed_time", time.Since(startTime).String()).
-					Msg("Duration target hit, stopping detection")
-				break
+	}
+
+	runnerOpts := []runner.Option{
+		runner.WithDir(outputDir),
+		runner.WithFileFormat(detectFileOutput),
+		runner.WithRunCompleted(func(run report.Run) {
+			if err := session.addRun(run); err != nil {
+				logger.Error().Err(err).Int("run", run.Number).Msg("Failed to save detect session")
 			}
+		}),
+	}
+	if compileOnce {
+		runnerOpts = append(runnerOpts, runner.WithCompiledBinaries())
+	}
+	if runTimeout > 0 {
+		runnerOpts = append(runnerOpts, runner.WithRunTimeout(runTimeout))
+	}
+	if stallTimeout > 0 {
+		runnerOpts = append(runnerOpts, runner.WithStallTimeout(stallTimeout))
+	}
+	if useWorkflowCommands() {
+		runnerOpts = append(runnerOpts, runner.WithOutputGroups(fg_github.StartGroup))
+	}
+	r, err := runner.New(logger, runnerOpts...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			logger.Warn().Err(err).Msg("Failed to clean up compiled test binaries")
+		}
+	}()
+
+	startTime := time.Now()
+	withinDurationTarget := func() bool {
+		if durationTarget <= 0 {
+			return true
 		}
+		// In strict mode, only start runs that are expected to finish within the target
+		var estimate time.Duration
+		if strictDuration {
+			estimate = estimateRunDuration(session.runs())
+		}
+		if time.Since(startTime)+estimate <= durationTarget {
+			return true
+		}
+		logger.Warn().
+			Str("duration_target", durationTarget.String()).
+			Str("elapsed_time", time.Since(startTime).String()).
+			Str("estimated_run_duration", estimate.String()).
+			Msg("Duration target hit, stopping detection")
+		return false
 	}
 
-	err = report.New(
+	err = runDetectPhases(cmd.Context(), r, session, matrix, originalGotestsumFlags, runGoTestFlags, withinDurationTarget)
+	completedRuns := session.runs()
+	// On SIGINT or SIGTERM, report on whatever completed so the session isn't lost
+	interrupted := err != nil && cmd.Context().Err() != nil
+	if err != nil && !interrupted {
+		return err
+	}
+	if interrupted {
+		if len(completedRuns) == 0 {
+			return exit.New(exit.CodeInterrupted, fmt.Errorf("detect interrupted before any runs completed"))
+		}
+		logger.Warn().Int("completed_runs", len(completedRuns)).Msg("Detect interrupted, reporting on completed runs")
+		fmt.Printf("Interrupted, reporting on %d completed runs. Continue the session with --resume\n", len(completedRuns))
+	}
+
+	results, err := report.New(
 		logger,
-		testRunInfo,
-		detectFiles,
+		session.TestRunInfo,
+		completedRuns,
 		report.WithDir(outputDir),
+		report.WithFilter(testFilter),
+		report.WithExclusions(exclusions),
+		report.WithHistory(historyLookup(cmd.Context(), session.TestRunInfo.HeadBranch)),
 	)
 	if err != nil {
 		return err
 	}
 
+	if interrupted {
+		// The session isn't done, it's recorded once it's resumed and completes
+		return exit.New(exit.CodeInterrupted, fmt.Errorf("detect interrupted after %d runs", len(completedRuns)))
+	}
+	if err := recordHistory(results); err != nil {
+		return err
+	}
+	if err := writeWorkflowCommands(results, runner.BuildFlags(goTestFlags)); err != nil {
+		logger.Warn().Err(err).Msg("Failed to write GitHub Actions workflow commands")
+	}
+	if err := commentOnPullRequest(cmd.Context(), results); err != nil {
+		logger.Warn().Err(err).Msg("Failed to comment on pull request")
+	}
+	if err := publishCheckRun(cmd.Context(), results, runner.BuildFlags(goTestFlags)); err != nil {
+		logger.Warn().Err(err).Msg("Failed to publish check run")
+	}
 	return nil
 }
 
-// runDetect runs a single detect run.
-func runDetect(
-	l zerolog.Logger,
-	run int,
-	originalGotestsumFlags []string,
-	goTestFlags []string,
-) (detectFile string, err error) {
-	detectFile = fmt.Sprintf(detectFileOutput, run+1)
-	//nolint:gocritic // The slice appends are needed to avoid modifying the original slices
-	gotestsumFlags := append(originalGotestsumFlags, "--jsonfile", filepath.Join(outputDir, detectFile))
-	//nolint:gocritic // The slice appends are needed to avoid modifying the original slices
-	fullArgs := append(gotestsumFlags, "--")
-	fullArgs = append(fullArgs, goTestFlags...)
-	l = l.With().
-		Int("run", run+1).
-		Str("detect_results_file", detectFile).
-		Strs("gotestsum_flags", originalGotestsumFlags).
-		Strs("go_test_flags", goTestFlags).
-		Logger()
-
-	startDetectTime := time.Now()
-	err = gotestsumCmd.Run("gotestsum", fullArgs)
-	l.Debug().Err(err).Str("duration", time.Since(startDetectTime).String()).Msg("Detect run completed")
-	if err != nil {
-		exitCode := getExitCode(err)
-		if exitCode != 1 { // Exit code 1 is expected when there are flaky tests
-			return detectFile, exit.New(exitCode, err)
+// runDetectPhases runs whatever is left of the session: the full suite runs, adaptive runs, and the sequential baseline.
+// Completed runs are recorded in the session.
+func runDetectPhases(
+	ctx context.Context,
+	r *runner.Runner,
+	session *detectSession,
+	matrix runner.Matrix,
+	gotestsumFlags, goTestFlags []string,
+	withinDurationTarget func() bool,
+) error {
+	specs := make([]runner.Spec, 0, runs)
+	for number := 1; number <= runs; number++ {
+		if session.completed(number) {
+			continue
 		}
+		specs = append(specs, matrix.Apply(runner.Spec{
+			Number:         number,
+			Phase:          report.PhaseFull,
+			GotestsumFlags: gotestsumFlags,
+			GoTestFlags:    goTestFlags,
+		}))
+	}
+	if _, err := r.Runs(ctx, specs, parallelRuns, withinDurationTarget); err != nil {
+		return err
 	}
-	return detectFile, nil
+
+	if adaptive {
+		if err := runAdaptive(ctx, r, session, matrix, gotestsumFlags, goTestFlags, withinDurationTarget); err != nil {
+			return err
+		}
+	}
+
+	// Sequential runs act as a baseline to compare parallel runs against,
+	// tests that fail more often in parallel likely share state across processes.
+	if parallelRuns > 1 && sequentialRuns > 0 {
+		completedRuns := session.runs()
+		remaining := sequentialRuns
+		for _, run := range completedRuns {
+			if run.Phase == report.PhaseSequential {
+				remaining--
+			}
+		}
+		sequentialSpecs := make([]runner.Spec, 0, max(remaining, 0))
+		for run := range remaining {
+			sequentialSpecs = append(sequentialSpecs, matrix.Apply(runner.Spec{
+				Number:         nextRunNumber(completedRuns) + run,
+				Phase:          report.PhaseSequential,
+				GotestsumFlags: gotestsumFlags,
+				GoTestFlags:    goTestFlags,
+			}))
+		}
+		if _, err := r.Runs(ctx, sequentialSpecs, 1, withinDurationTarget); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func init() {
-	rootCmd.AddCommand(detectCmd)
-	detectCmd.Flags().
-		DurationVar(&durationTarget, "duration-target", 0, "Target duration for the full detection run. If set, detect will attempt to stop as soon as this duration is hit. This is a soft-limit, and will not abort in the middle of a run.")
+// uncachedGoTestFlags intentionally sets -count=1 to avoid caching test results
+func uncachedGoTestFlags(goTestFlags []string) ([]string, error) {
+	for _, flag := range goTestFlags {
+		if strings.HasPrefix(flag, "-count=") {
+			return nil, fmt.Errorf("-count flag in go test cannot be overridden while using flakeguard")
+		}
+	}
+	return append(goTestFlags, "-count=1"), nil
+}
+
+// runAdaptive keeps re-running tests that failed at least once, narrowed down with -run to just those tests,
+// until the failure rate of each of them is known precisely enough, they hit the max runs, or the duration target expires.
+// Packages without failures aren't run again. It also stops once a batch doesn't run any of the tests again, like when
+// they started skipping, as more batches wouldn't either.
+func runAdaptive(
+	ctx context.Context,
+	r *runner.Runner,
+	session *detectSession,
+	matrix runner.Matrix,
+	gotestsumFlags, goTestFlags []string,
+	withinDurationTarget func() bool,
+) error {
+	var previousRuns map[suspect]int
+	for withinDurationTarget() {
+		completedRuns := session.runs()
+		results, err := report.Analyze(logger, outputDir, completedRuns, testFilter)
+		if err != nil {
+			return err
+		}
+		if previousRuns != nil && !ranAgain(results, previousRuns) {
+			logger.Warn().Msg("Suspicious tests didn't run again, stopping adaptive runs")
+			break
+		}
+		packages, tests, suspectRuns := suspiciousTests(results)
+		if len(tests) == 0 {
+			logger.Info().Msg("All suspicious tests resolved, stopping adaptive runs")
+			break
+		}
+		previousRuns = suspectRuns
+
+		narrowedFlags := runner.NarrowGoTestFlags(goTestFlags, packages, tests)
+		logger.Info().
+			Strs("packages", packages).
+			Strs("tests", tests).
+			Strs("go_test_flags", narrowedFlags).
+			Msg("Re-running suspicious tests")
+		fmt.Printf("Re-running %d suspicious tests in %d packages\n", len(tests), len(packages))
+
+		batchSize := max(parallelRuns, 1)
+		specs := make([]runner.Spec, 0, batchSize)
+		for run := range batchSize {
+			specs = append(specs, matrix.Apply(runner.Spec{
+				Number:         nextRunNumber(completedRuns) + run,
+				Phase:          report.PhaseAdaptive,
+				GotestsumFlags: gotestsumFlags,
+				GoTestFlags:    narrowedFlags,
+			}))
+		}
+		batch, err := r.Runs(ctx, specs, parallelRuns, withinDurationTarget)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+	}
+	return nil
 }
 
-// getExitCode extracts the exit code from an error returned by exec.Cmd
-func getExitCode(err error) int {
-	if err == nil {
-		return 0
+// suspect identifies a suspicious test by its package and full name
+type suspect struct {
+	pkg  string
+	name string
+}
+
+// suspiciousTests returns the packages and top-level names of tests that failed at least once,
+// and whose failure rate isn't yet known within the target precision, along with how many times each of them ran.
+func suspiciousTests(results []*report.TestResult) (packages []string, tests []string, runs map[suspect]int) {
+	runs = map[suspect]int{}
+	for _, result := range results {
+		failures := len(result.FailingRunNumbers)
+		if failures == 0 || result.Runs >= maxRuns {
+			continue
+		}
+		low, high := report.FailureRateInterval(min(failures, result.Runs), result.Runs, confidence)
+		if (high-low)/2 <= precision {
+			continue
+		}
+
+		runs[suspect{pkg: result.Package, name: result.Name}] = result.Runs
+		topLevel, _, _ := strings.Cut(result.Name, "/")
+		if !slices.Contains(packages, result.Package) {
+			packages = append(packages, result.Package)
+		}
+		if !slices.Contains(tests, topLevel) {
+			tests = append(tests, topLevel)
+		}
 	}
-	if exitError, ok := err.(*exec.ExitError); ok {
-		if status, ok := exitError.Sys().(syscall.WaitStatus); ok {
-			return status.ExitStatus()
+	return packages, tests, runs
+}
+
+// ranAgain returns true if any of the suspicious tests ran more times than before the last batch
+func ranAgain(results []*report.TestResult, previousRuns map[suspect]int) bool {
+	for _, result := range results {
+		previous, ok := previousRuns[suspect{pkg: result.Package, name: result.Name}]
+		if ok && result.Runs > previous {
+			return true
 		}
 	}
-	return -1 // Unknown exit code
+	return false
+}
+
+// recentRunsForEstimate is how many of the latest runs are used to estimate how long the next run takes
+const recentRunsForEstimate = 5
+
+// estimateRunDuration estimates how long the next run will take as the longest of the latest runs, so estimates
+// follow along when runs get shorter, like when adaptive runs are narrowed down.
+func estimateRunDuration(completedRuns []report.Run) time.Duration {
+	slices.SortFunc(completedRuns, func(a, b report.Run) int {
+		return a.Started.Compare(b.Started)
+	})
+	var estimate time.Duration
+	for _, run := range completedRuns[max(len(completedRuns)-recentRunsForEstimate, 0):] {
+		estimate = max(estimate, run.Duration)
+	}
+	return estimate
+}
+
+// nextRunNumber returns the number the next run should get
+func nextRunNumber(completedRuns []report.Run) int {
+	next := runs + 1
+	for _, run := range completedRuns {
+		next = max(next, run.Number+1)
+	}
+	return next
+}
+
+func init() {
+	rootCmd.AddCommand(detectCmd)
+	detectCmd.Flags().
+		DurationVar(&durationTarget, "duration-target", 0, "Target duration for the full detection run. If set, detect will attempt to stop as soon as this duration is hit. This is a soft-limit, and will not abort in the middle of a run.")
+	detectCmd.Flags().
+		BoolVar(&strictDuration, "strict-duration-target", false, "Only start a run if it's expected to finish within --duration-target, estimated from the durations of the latest runs.")
+	detectCmd.Flags().
+		DurationVar(&runTimeout, "run-timeout", 0, "Kill any run that takes longer than this. Test binaries are sent SIGQUIT first to dump their goroutines, which are saved next to the run's output, and killed runs are marked in the report.")
+	detectCmd.Flags().
+		DurationVar(&stallTimeout, "stall-timeout", 0, "Kill any run that produces no test output for this long, most likely because of a deadlock. Goroutines are dumped the same way as with --run-timeout.")
+	detectCmd.Flags().
+		IntVar(&parallelRuns, "parallel-runs", 1, "Number of runs to execute at the same time. Each run gets its own GOTMPDIR, TMPDIR, output file, and a port range hint in the "+runner.PortRangeEnvVar+" env var.")
+	detectCmd.Flags().
+		BoolVar(&compileOnce, "compile-once", false, "Compile each package's test binary once with 'go test -c', then run the binaries directly through test2json for every run. Saves the package loading and linking go test repeats on every run.")
+	detectCmd.Flags().
+		IntVar(&sequentialRuns, "sequential-runs", 0, "Number of extra runs to execute one at a time after the parallel runs. Tests that fail more often in parallel than in sequential runs are reported as likely sharing state across processes.")
+	detectCmd.Flags().
+		BoolVar(&resume, "resume", false, "Continue the detect session in --output-dir up to --runs, e.g. after it was interrupted. The session's gotestsum and go test flags are used.")
+	detectCmd.Flags().
+		StringArrayVar(&matrixFlags, "matrix", nil, "Setting to rotate across runs, formatted as '-flag=value1|value2' for go test flags (e.g. '-cpu=1|4', '-race=true|false') or 'ENV_VAR=value1|value2' for env vars (e.g. 'TZ=UTC|Asia/Tokyo'). Can be repeated, runs rotate through every combination. Tests that fail more often with a setting are called out in the report.")
+	detectCmd.Flags().
+		BoolVar(&adaptive, "adaptive", false, "After the full suite runs (--runs), keep re-running only the tests that failed at least once until their failure rate is known within --precision at --confidence, they reach --max-runs, or --duration-target expires.")
+	detectCmd.Flags().
+		IntVar(&maxRuns, "max-runs", 100, "Maximum number of runs for any suspicious test in adaptive mode.")
+	detectCmd.Flags().
+		Float64Var(&confidence, "confidence", 0.95, "Statistical confidence to reach for suspicious tests in adaptive mode.")
+	detectCmd.Flags().
+		Float64Var(&precision, "precision", 0.1, "How far off the measured failure rate of a suspicious test may be at the target confidence in adaptive mode, e.g. 0.1 is +/-10%.")
 }
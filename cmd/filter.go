@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/smartcontractkit/flakeguard/filter"
+	"github.com/smartcontractkit/flakeguard/golang"
+	"github.com/smartcontractkit/flakeguard/runner"
+)
+
+var (
+	ignorePackages []string
+	focusPackages  []string
+	ignoreTests    []string
+	focusTests     []string
+
+	// testFilter leaves ignored packages and tests out of runs, analysis, and reports, built from the lists above
+	testFilter *filter.Filter
+)
+
+// selectTests rewrites go test flags to leave out the packages and top-level tests the filter excludes.
+// It returns what was left out, so it can be listed in the report. Tests that can't be left out with go test flags,
+// like ignored subtests, are left out of the analysis instead.
+func selectTests(ctx context.Context, goTestFlags []string) ([]string, []filter.Exclusion, error) {
+	if !testFilter.HasPackageRules() && !testFilter.HasTestRules() {
+		return goTestFlags, nil, nil
+	}
+
+	packages, err := runner.TestPackages(ctx, goTestFlags)
+	if err != nil {
+		return nil, nil, err
+	}
+	exclusions := []filter.Exclusion{}
+	if testFilter.HasPackageRules() {
+		kept := make([]string, 0, len(packages))
+		for _, pkg := range packages {
+			if exclusion, excluded := testFilter.Package(pkg); excluded {
+				exclusions = append(exclusions, exclusion)
+				continue
+			}
+			kept = append(kept, pkg)
+		}
+		if len(kept) == 0 {
+			return nil, nil, fmt.Errorf("every package is left out by the ignore and focus lists")
+		}
+		packages = kept
+		goTestFlags = runner.ReplacePackages(goTestFlags, packages)
+	}
+
+	// The user's own -skip and -run flags win, we can't combine them with ours
+	skip, run := testFilter.SkipPattern(), testFilter.RunPattern()
+	if runner.HasGoTestFlag(goTestFlags, "skip") {
+		skip = ""
+	}
+	if runner.HasGoTestFlag(goTestFlags, "run") {
+		run = ""
+	}
+	if skip == "" && run == "" {
+		return goTestFlags, exclusions, nil
+	}
+
+	// Tests go test never runs don't show up in the output, list them from the source instead
+	buildFlags := runner.BuildFlags(goTestFlags)
+	for _, pkg := range packages {
+		tests, err := golang.TestNames(logger, ".", pkg, buildFlags...)
+		if errors.Is(err, golang.ErrTestNotFound) {
+			continue
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("failed to list tests in %s: %w", pkg, err)
+		}
+		for _, test := range tests {
+			if exclusion, excluded := testFilter.Test(pkg, test); excluded {
+				exclusions = append(exclusions, exclusion)
+			}
+		}
+	}
+	if skip != "" {
+		goTestFlags = runner.AddGoTestFlags(goTestFlags, "-skip="+skip)
+	}
+	if run != "" {
+		goTestFlags = runner.AddGoTestFlags(goTestFlags, "-run="+run)
+	}
+	return goTestFlags, exclusions, nil
+}
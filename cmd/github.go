@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/smartcontractkit/flakeguard/git"
+	fg_github "github.com/smartcontractkit/flakeguard/github"
+	"github.com/smartcontractkit/flakeguard/golang"
+	"github.com/smartcontractkit/flakeguard/report"
+)
+
+var (
+	// prComment keeps a comment listing flaky tests on the pull request that triggered the workflow
+	prComment bool
+	// checkRun publishes a check run annotating flaky tests on the commit the workflow runs on
+	checkRun bool
+	// workflowCommands groups the output of runs in the workflow log, annotates failing and flaky tests, and sets the
+	// step's outputs
+	workflowCommands bool
+)
+
+// Verdicts of a detect session, set as the verdict step output
+const (
+	verdictPass    = "pass"
+	verdictFlaky   = "flaky"
+	verdictFailing = "failing"
+)
+
+// githubRepository returns the owner and name of the repository, from GitHub Actions or the git remote
+func githubRepository() (string, string, error) {
+	githubEnv, err := fg_github.GetActionsEnv()
+	if err == nil {
+		owner, repo, ok := strings.Cut(githubEnv.Repository, "/")
+		if !ok {
+			return "", "", fmt.Errorf("invalid GITHUB_REPOSITORY '%s'", githubEnv.Repository)
+		}
+		return owner, repo, nil
+	} else if !errors.Is(err, fg_github.ErrNotInActions) {
+		return "", "", err
+	}
+	repoInfo, err := git.ReadBasicRepoInfo(logger, ".")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read repository info: %w", err)
+	}
+	return repoInfo.Owner, repoInfo.Name, nil
+}
+
+// githubClientOptions points the GitHub client at the GitHub Enterprise install the flags, the GitHub Actions
+// environment, or the git remote's host, in that order. github.com needs no options. With a GitHub App, the client
+// authenticates as its installation instead of with a token.
+func githubClientOptions(l zerolog.Logger) ([]fg_github.ClientOption, error) {
+	var opts []fg_github.ClientOption
+	if githubCAFile != "" {
+		opts = append(opts, fg_github.WithCACertFile(githubCAFile))
+	}
+	if githubAppID != 0 {
+		app, err := githubApp()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, fg_github.WithAppAuth(app))
+	}
+	if githubAPIURL != "" {
+		return append(opts, fg_github.WithEnterpriseURLs(githubAPIURL, githubGraphQLURL)), nil
+	}
+
+	githubEnv, err := fg_github.GetActionsEnv()
+	if err == nil {
+		if githubEnv.APIURL != "" && githubEnv.APIURL != fg_github.DefaultAPIURL {
+			return append(opts, fg_github.WithEnterpriseURLs(githubEnv.APIURL, githubEnv.GraphQLURL)), nil
+		}
+		return opts, nil
+	}
+	repoInfo, err := git.ReadBasicRepoInfo(l, ".")
+	if err != nil {
+		return opts, nil
+	}
+	if restURL, graphQLURL, ok := fg_github.EnterpriseURLs(repoInfo.Host); ok {
+		l.Info().Str("host", repoInfo.Host).Str("api_url", restURL).Msg("Using GitHub Enterprise API of the git remote's host")
+		return append(opts, fg_github.WithEnterpriseURLs(restURL, graphQLURL)), nil
+	}
+	return opts, nil
+}
+
+// githubApp reads the GitHub App credentials from the flags. Without an installation ID, the app's installation on
+// the repository is used.
+func githubApp() (fg_github.AppAuth, error) {
+	if githubAppPrivateKey == "" {
+		return fg_github.AppAuth{}, errors.New("--github-app-private-key must be set along with --github-app-id")
+	}
+	privateKey := []byte(githubAppPrivateKey)
+	if !strings.HasPrefix(strings.TrimSpace(githubAppPrivateKey), "-----BEGIN") {
+		var err error
+		//nolint:gosec // G304: the path comes from the user
+		privateKey, err = os.ReadFile(githubAppPrivateKey)
+		if err != nil {
+			return fg_github.AppAuth{}, fmt.Errorf("failed to read GitHub App private key: %w", err)
+		}
+	}
+	app := fg_github.AppAuth{
+		AppID:          githubAppID,
+		PrivateKey:     privateKey,
+		InstallationID: githubAppInstallationID,
+	}
+	if app.InstallationID == 0 {
+		var err error
+		app.Owner, app.Repo, err = githubRepository()
+		if err != nil {
+			return fg_github.AppAuth{}, fmt.Errorf("failed to find the repository the GitHub App is installed on: %w", err)
+		}
+	}
+	return app, nil
+}
+
+// commentOnPullRequest keeps a sticky comment listing the flaky tests on the pull request that triggered the workflow
+// up to date, and deletes it once a run finds none, so clean pull requests aren't commented on.
+// Outside of pull request workflows it does nothing.
+func commentOnPullRequest(ctx context.Context, results []*report.TestResult) error {
+	if !prComment || dryRun {
+		return nil
+	}
+	githubEnv, err := fg_github.GetActionsEnv()
+	if errors.Is(err, fg_github.ErrNotInActions) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	pr, err := fg_github.ReadPullRequest(githubEnv.EventPath)
+	if errors.Is(err, fg_github.ErrNotPullRequest) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	owner, repo, ok := strings.Cut(githubEnv.Repository, "/")
+	if !ok {
+		return fmt.Errorf("invalid GITHUB_REPOSITORY '%s'", githubEnv.Repository)
+	}
+	// Every job running flakeguard on the pull request keeps its own comment
+	comment := fg_github.StickyComment{
+		Owner:  owner,
+		Repo:   repo,
+		Number: pr.Number,
+		Key:    githubEnv.Workflow + "/" + githubEnv.Job,
+	}
+	l := logger.With().Int("pull_request", pr.Number).Str("comment_key", comment.Key).Logger()
+
+	if len(report.FlakyTests(results)) == 0 {
+		deleted, err := fg_github.DeleteComment(ctx, githubClient, comment)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			l.Info().Msg("No flaky tests, deleted pull request comment")
+		}
+		return nil
+	}
+
+	var body strings.Builder
+	if err := report.WriteMarkdownSummary(&body, results); err != nil {
+		return err
+	}
+	if githubEnv.RunID != 0 {
+		fmt.Fprintf(&body, "\n[Workflow run](%s/%s/actions/runs/%d)\n", githubEnv.ServerURL, githubEnv.Repository, githubEnv.RunID)
+	}
+	posted, err := fg_github.UpsertComment(ctx, githubClient, comment, body.String())
+	if err != nil {
+		return err
+	}
+	l.Info().Str("url", posted.GetHTMLURL()).Msg("Commented flaky tests on pull request")
+	return nil
+}
+
+// publishCheckRun publishes a Flakeguard check run on the commit the workflow runs on, with a summary of the flaky
+// tests and an annotation on each of them. For pull requests that's the head commit of the pull request, not the merge
+// commit GitHub Actions checks out.
+func publishCheckRun(ctx context.Context, results []*report.TestResult, buildFlags []string) error {
+	if !checkRun || dryRun {
+		return nil
+	}
+	githubEnv, err := fg_github.GetActionsEnv()
+	if errors.Is(err, fg_github.ErrNotInActions) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	owner, repo, ok := strings.Cut(githubEnv.Repository, "/")
+	if !ok {
+		return fmt.Errorf("invalid GITHUB_REPOSITORY '%s'", githubEnv.Repository)
+	}
+	headSHA := githubEnv.SHA
+	pr, err := fg_github.ReadPullRequest(githubEnv.EventPath)
+	if err == nil {
+		headSHA = pr.Head.SHA
+	} else if !errors.Is(err, fg_github.ErrNotPullRequest) {
+		return err
+	}
+
+	flaky := report.FlakyTests(results)
+	run := fg_github.CheckRun{
+		Owner:      owner,
+		Repo:       repo,
+		HeadSHA:    headSHA,
+		Conclusion: "success",
+		Title:      "No flaky tests",
+		Summary:    "Flakeguard didn't find any flaky tests.",
+	}
+	if len(flaky) > 0 {
+		var summary strings.Builder
+		if err := report.WriteMarkdownSummary(&summary, results); err != nil {
+			return err
+		}
+		// Flaky tests are worth a look, but shouldn't block merging on their own
+		run.Conclusion = "neutral"
+		run.Title = fmt.Sprintf("%d flaky tests", len(flaky))
+		if len(flaky) == 1 {
+			run.Title = "1 flaky test"
+		}
+		run.Summary = summary.String()
+		run.Annotations = testAnnotations(flaky, buildFlags)
+	}
+
+	published, err := fg_github.PublishCheckRun(ctx, githubClient, run)
+	if err != nil {
+		return err
+	}
+	logger.Info().
+		Str("url", published.GetHTMLURL()).
+		Str("head_sha", headSHA).
+		Int("annotations", len(run.Annotations)).
+		Msg("Published check run")
+	return nil
+}
+
+// testAnnotations point at the declaration of each flaky or failing test. Tests that can't be found in the code are
+// left out, they're still in the summaries.
+func testAnnotations(results []*report.TestResult, buildFlags []string) []fg_github.Annotation {
+	annotations := []fg_github.Annotation{}
+	for _, result := range results {
+		l := logger.With().Str("package", result.Package).Str("test", result.Name).Logger()
+		location, err := golang.FindTestLocation(l, ".", result.Package, result.Name, buildFlags...)
+		if err != nil {
+			l.Debug().Err(err).Msg("Not annotating test, can't find where it's declared")
+			continue
+		}
+		path, err := git.RelativePath(location.FilePath)
+		if err != nil {
+			l.Debug().Err(err).Msg("Not annotating test, it's not in the repository")
+			continue
+		}
+
+		message := fmt.Sprintf("Passed %d of %d runs (%.2f%%)", result.Successes, result.Runs, result.PassRatio*100)
+		if signature := result.FailureSignature(); signature != "" {
+			message += "\n" + signature
+		}
+		var details strings.Builder
+		for _, command := range result.ReproductionCommands {
+			fmt.Fprintf(&details, "%s:\n%s\n", command.Description, command.Command)
+		}
+		title := fmt.Sprintf("%s is flaky (%s)", result.Name, result.Classification())
+		if !result.Flaky() {
+			title = fmt.Sprintf("%s failed every run", result.Name)
+		}
+		annotations = append(annotations, fg_github.Annotation{
+			Path:       path,
+			Line:       location.LineNumber,
+			Title:      title,
+			Message:    message,
+			RawDetails: strings.TrimSpace(details.String()),
+		})
+	}
+	return annotations
+}
+
+// useWorkflowCommands reports whether flakeguard runs in GitHub Actions and should write workflow commands
+func useWorkflowCommands() bool {
+	_, err := fg_github.GetActionsEnv()
+	return workflowCommands && err == nil
+}
+
+// writeWorkflowCommands annotates failing tests as errors and flaky tests as warnings in the workflow run, and sets the
+// step's outputs so later steps can act on the results
+func writeWorkflowCommands(results []*report.TestResult, buildFlags []string) error {
+	if !workflowCommands {
+		return nil
+	}
+	githubEnv, err := fg_github.GetActionsEnv()
+	if errors.Is(err, fg_github.ErrNotInActions) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	flaky, failing := report.FlakyTests(results), report.FailingTests(results)
+	for _, annotation := range testAnnotations(failing, buildFlags) {
+		if err := fg_github.WriteAnnotation(os.Stdout, fg_github.AnnotationError, annotation); err != nil {
+			return err
+		}
+	}
+	for _, annotation := range testAnnotations(flaky, buildFlags) {
+		if err := fg_github.WriteAnnotation(os.Stdout, fg_github.AnnotationWarning, annotation); err != nil {
+			return err
+		}
+	}
+
+	if githubEnv.Output == "" {
+		return nil
+	}
+	reportPath, err := filepath.Abs(filepath.Join(outputDir, report.DefaultJSONFile))
+	if err != nil {
+		return err
+	}
+	verdict := verdictPass
+	if len(failing) > 0 {
+		verdict = verdictFailing
+	} else if len(flaky) > 0 {
+		verdict = verdictFlaky
+	}
+	return fg_github.SetOutputs(githubEnv.Output, map[string]string{
+		"flaky_tests":   strconv.Itoa(len(flaky)),
+		"failing_tests": strconv.Itoa(len(failing)),
+		"report_path":   reportPath,
+		"verdict":       verdict,
+	})
+}
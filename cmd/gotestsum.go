@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	gotestsumCmd "gotest.tools/gotestsum/cmd"
+
+	"github.com/smartcontractkit/flakeguard/exit"
+	"github.com/smartcontractkit/flakeguard/runner"
+)
+
+// runGotestsumCmd runs gotestsum in its own process, so that every run gets its own environment and can be
+// signalled on its own. It's only meant to be launched by flakeguard itself.
+var runGotestsumCmd = &cobra.Command{
+	Use:                runner.GotestsumCommand + " [gotestsum flags] -- [go test flags]",
+	Short:              "Run gotestsum in its own process",
+	Hidden:             true,
+	DisableFlagParsing: true,
+	// Skip the root setup, the parent flakeguard process already handled it
+	PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+		return nil
+	},
+	Run: func(_ *cobra.Command, args []string) {
+		// SIGQUIT is meant for the test binaries to dump their goroutines, gotestsum needs to outlive them
+		signal.Ignore(syscall.SIGQUIT)
+		// Exit directly with gotestsum's exit code, the same way the gotestsum binary does
+		err := gotestsumCmd.Run("gotestsum", args)
+		switch {
+		case err == nil:
+			return
+		case !gotestsumCmd.IsExitCoder(err):
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exit.CodeFlakeguardError)
+		default:
+			os.Exit(gotestsumCmd.ExitCodeWithDefault(err))
+		}
+	},
+}
+
+// runTestBinariesCmd runs pre-compiled test binaries through test2json, standing in for go test when detect compiles
+// test binaries once. It's only meant to be launched by flakeguard itself, through gotestsum.
+var runTestBinariesCmd = &cobra.Command{
+	Use:                runner.TestBinariesCommand + " <manifest> -- [test binary flags]",
+	Short:              "Run compiled test binaries through test2json",
+	Hidden:             true,
+	DisableFlagParsing: true,
+	Args:               cobra.MinimumNArgs(1),
+	// Skip the root setup, the parent flakeguard process already handled it
+	PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		// SIGQUIT is meant for the test binaries to dump their goroutines, gotestsum needs our output to outlive them
+		signal.Ignore(syscall.SIGQUIT)
+		testArgs := args[1:]
+		if len(testArgs) > 0 && testArgs[0] == "--" {
+			testArgs = testArgs[1:]
+		}
+		os.Exit(runner.RunBinaries(cmd.Context(), args[0], testArgs, os.Stdout, os.Stderr))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(runGotestsumCmd)
+	rootCmd.AddCommand(runTestBinariesCmd)
+}
@@ -2,15 +2,30 @@ package cmd
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/spf13/cobra"
+
+	"github.com/smartcontractkit/flakeguard/exit"
+	fg_github "github.com/smartcontractkit/flakeguard/github"
+	"github.com/smartcontractkit/flakeguard/report"
+	"github.com/smartcontractkit/flakeguard/runner"
 )
 
+const guardFileOutput = "guard-test-output-%d.json"
+
 var guardCmd = &cobra.Command{
 	Use:   "guard [flakeguard flags] -- [gotestsum flags] -- [go test flags]",
 	Short: "Guard your tests",
 	Long: `Guard your CI/CD pipeline by running your tests multiple times and retrying them if they fail.
 
+The tests run once, then the tests that failed are retried on their own, up to --runs times, until they pass.
+Guard only fails if a test failed every time.
+
+With --quarantine-pr, tests that failed in a pull request workflow, but were already flaky on its base branch, are
+quarantined on the pull request's branch so they don't keep blocking it.
+
 Examples:
   flakeguard guard -- --format testname -- ./pkg/...
   flakeguard guard --runs 10 -- --format dots -- -v -run TestMyFunction`,
@@ -19,8 +34,118 @@ Examples:
 
 func init() {
 	rootCmd.AddCommand(guardCmd)
+	guardCmd.Flags().
+		BoolVar(&quarantinePR, "quarantine-pr", false, "In GitHub Actions pull request workflows, commit quarantines of flaky tests that were already flaky on the base branch to the pull request, and comment why. Tests are held to the quarantine.threshold and quarantine.min_runs settings.")
+}
+
+func guardTests(cmd *cobra.Command, args []string) error {
+	originalGotestsumFlags, goTestFlags := parseArgs(args)
+	logger.Info().
+		Int("runs", runs).
+		Bool("quarantine_pr", quarantinePR).
+		Strs("entered_gotestsum_flags", originalGotestsumFlags).
+		Strs("entered_go_test_flags", goTestFlags).
+		Msg("Guarding tests")
+
+	if slices.Contains(originalGotestsumFlags, "--jsonfile") {
+		return fmt.Errorf("jsonfile flag cannot be overridden while using flakeguard")
+	}
+	runGoTestFlags, err := uncachedGoTestFlags(slices.Clone(goTestFlags))
+	if err != nil {
+		return err
+	}
+	runGoTestFlags, exclusions, err := selectTests(cmd.Context(), runGoTestFlags)
+	if err != nil {
+		return err
+	}
+	info, err := testRunInfo(cmd.Context(), logger, githubClient, ".")
+	if err != nil {
+		return fmt.Errorf("failed to get test run info: %w", err)
+	}
+
+	runnerOpts := []runner.Option{runner.WithDir(outputDir), runner.WithFileFormat(guardFileOutput)}
+	if useWorkflowCommands() {
+		runnerOpts = append(runnerOpts, runner.WithOutputGroups(fg_github.StartGroup))
+	}
+	r, err := runner.New(logger, runnerOpts...)
+	if err != nil {
+		return err
+	}
+
+	run, err := r.Run(cmd.Context(), runner.Spec{
+		Number:         1,
+		Phase:          report.PhaseFull,
+		GotestsumFlags: originalGotestsumFlags,
+		GoTestFlags:    runGoTestFlags,
+	}, 0, false)
+	if err != nil {
+		return err
+	}
+	completedRuns := []report.Run{run}
+	for retry := 1; retry <= runs; retry++ {
+		results, err := report.Analyze(logger, outputDir, completedRuns, testFilter)
+		if err != nil {
+			return err
+		}
+		packages, tests := failingTests(results)
+		if len(tests) == 0 {
+			break
+		}
+		retryFlags := runner.NarrowGoTestFlags(runGoTestFlags, packages, tests)
+		logger.Info().
+			Int("retry", retry).
+			Strs("packages", packages).
+			Strs("tests", tests).
+			Strs("go_test_flags", retryFlags).
+			Msg("Retrying failing tests")
+		fmt.Printf("Retrying %d failing tests in %d packages (%d/%d)\n", len(tests), len(packages), retry, runs)
+		run, err := r.Run(cmd.Context(), runner.Spec{
+			Number:         retry + 1,
+			Phase:          report.PhaseRetry,
+			GotestsumFlags: originalGotestsumFlags,
+			GoTestFlags:    retryFlags,
+		}, 0, false)
+		if err != nil {
+			return err
+		}
+		completedRuns = append(completedRuns, run)
+	}
+
+	results, err := report.New(
+		logger,
+		info,
+		completedRuns,
+		report.WithDir(outputDir),
+		report.WithFilter(testFilter),
+		report.WithExclusions(exclusions),
+		report.WithHistory(historyLookup(cmd.Context(), info.HeadBranch)),
+	)
+	if err != nil {
+		return err
+	}
+	if err := quarantineOnPullRequest(cmd.Context(), results, runner.BuildFlags(goTestFlags)); err != nil {
+		logger.Warn().Err(err).Msg("Failed to quarantine flaky tests on pull request")
+	}
+
+	if _, tests := failingTests(results); len(tests) > 0 {
+		return exit.New(exit.CodeGoFailingTest, fmt.Errorf("tests failed every time they ran: %s", strings.Join(tests, ", ")))
+	}
+	return nil
 }
 
-func guardTests(_ *cobra.Command, _ []string) error {
-	return fmt.Errorf("guard not implemented")
+// failingTests returns the packages and top-level names of tests that failed, and haven't passed since
+func failingTests(results []*report.TestResult) (packages []string, tests []string) {
+	for _, result := range results {
+		if result.Successes > 0 || len(result.FailingRunNumbers) == 0 {
+			continue
+		}
+		topLevel, _, _ := strings.Cut(result.Name, "/")
+		if !slices.Contains(packages, result.Package) {
+			packages = append(packages, result.Package)
+		}
+		if !slices.Contains(tests, topLevel) {
+			tests = append(tests, topLevel)
+		}
+	}
+	return packages, tests
 }
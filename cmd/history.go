@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/smartcontractkit/flakeguard/exit"
+	fg_github "github.com/smartcontractkit/flakeguard/github"
+	"github.com/smartcontractkit/flakeguard/history"
+	"github.com/smartcontractkit/flakeguard/report"
+)
+
+// defaultHistoryFile is where the history is kept in the output dir, unless --history-file is set
+const defaultHistoryFile = "history.jsonl"
+
+// Where detect and guard read the history of past sessions from
+const (
+	historySourceLocal  = "local"
+	historySourceSplunk = "splunk"
+	historySourceGitHub = "github"
+)
+
+var (
+	historyFile   string
+	historySource string
+	historyWindow time.Duration
+	// historyArtifact is the name of the artifacts detect's output is uploaded as, for --history-source github
+	historyArtifact string
+	// historyCacheDir keeps downloaded artifacts between runs
+	historyCacheDir string
+
+	// History specific flags
+	historyDays         int
+	historyLastSessions int
+	historyBranch       string
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show how flaky tests have been over time",
+	Long: `Show how flaky tests have been over time, from the results of past detect sessions.
+
+Every detect session that completes adds its results to the history file. The history command shows the flake rate
+of every test that failed within the window, per branch, and compares the newer half of the sessions with the older
+half to call out tests that recently became flaky or stabilized.
+
+Examples:
+  flakeguard history
+  flakeguard history --days 7 --branch main
+  flakeguard history --last-sessions 20`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		store, err := openHistory()
+		if err != nil {
+			return exit.New(exit.CodeFlakeguardError, err)
+		}
+		query := history.Query{LastSessions: historyLastSessions, Branch: historyBranch}
+		if historyDays > 0 {
+			query.Since = time.Now().AddDate(0, 0, -historyDays)
+		}
+		logger.Debug().
+			Str("history_file", store.Path()).
+			Time("since", query.Since).
+			Int("last_sessions", query.LastSessions).
+			Str("branch", query.Branch).
+			Msg("Reading history")
+
+		entries, err := store.Entries(query)
+		if err != nil {
+			return exit.New(exit.CodeFlakeguardError, err)
+		}
+		if err := history.WriteReport(cmd.OutOrStdout(), entries); err != nil {
+			return exit.New(exit.CodeFlakeguardError, fmt.Errorf("failed to write history report: %w", err))
+		}
+		return nil
+	},
+}
+
+// openHistory opens the history file set with --history-file, or the one in the output dir
+func openHistory() (*history.Store, error) {
+	path := historyFile
+	if path == "" {
+		path = filepath.Join(outputDir, defaultHistoryFile)
+	}
+	return history.Open(path)
+}
+
+// historyProvider returns the provider set with --history-source
+func historyProvider() (history.Provider, error) {
+	switch historySource {
+	case historySourceLocal:
+		return openHistory()
+	case historySourceSplunk:
+		return history.NewSplunk(logger, splunkSearchURL, splunkSearchToken, splunkIndex, splunkSourceType)
+	case historySourceGitHub:
+		owner, repo, err := githubRepository()
+		if err != nil {
+			return nil, err
+		}
+		cacheDir := historyCacheDir
+		if cacheDir == "" {
+			userCacheDir, err := os.UserCacheDir()
+			if err != nil {
+				return nil, fmt.Errorf("failed to find cache directory, set --history-cache-dir: %w", err)
+			}
+			cacheDir = filepath.Join(userCacheDir, "flakeguard", "artifacts")
+		}
+		return fg_github.NewArtifactHistory(logger, githubClient, owner, repo, historyArtifact, cacheDir)
+	default:
+		return nil, fmt.Errorf("unknown history source %q, must be %s, %s, or %s",
+			historySource, historySourceLocal, historySourceSplunk, historySourceGitHub)
+	}
+}
+
+// historyLookup fetches the history of every test on the branch within --history-window, so it can be combined with
+// the results of the current session. History is only there to add context, failing to fetch it is logged and
+// returns nil.
+func historyLookup(ctx context.Context, branch string) report.HistoryLookup {
+	if historyWindow <= 0 {
+		return nil
+	}
+	provider, err := historyProvider()
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to set up history provider, reporting without history")
+		return nil
+	}
+	stats, err := provider.FlakeRates(ctx, history.Query{Since: time.Now().Add(-historyWindow), Branch: branch})
+	if err != nil {
+		logger.Warn().Err(err).Str("history_source", historySource).Msg("Failed to fetch history, reporting without history")
+		return nil
+	}
+	logger.Debug().
+		Str("history_source", historySource).
+		Str("branch", branch).
+		Int("tests", len(stats)).
+		Msg("Fetched history")
+
+	byTest := map[[2]string]report.History{}
+	for _, s := range stats {
+		key := [2]string{s.Package, s.Test}
+		h := byTest[key]
+		h.Runs += s.Runs
+		h.Failures += s.Failures
+		h.Window = historyWindow
+		byTest[key] = h
+	}
+	return func(pkg, test string) (report.History, bool) {
+		h, ok := byTest[[2]string{pkg, test}]
+		return h, ok
+	}
+}
+
+// recordHistory adds the results of a completed detect session to the history
+func recordHistory(results []*report.TestResult) error {
+	store, err := openHistory()
+	if err != nil {
+		return err
+	}
+	if err := store.Append(time.Now(), results); err != nil {
+		return err
+	}
+	logger.Debug().Str("history_file", store.Path()).Int("results", len(results)).Msg("Recorded results in history")
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.PersistentFlags().
+		StringVar(&historyFile, "history-file", "", "File to keep the history of test results in, defaults to "+defaultHistoryFile+" in --output-dir. Keep it between CI runs (e.g. with a cache) to build up history.")
+	rootCmd.PersistentFlags().
+		StringVar(&historySource, "history-source", historySourceLocal, "Where detect reads the history of past sessions from to combine with its results: 'local' for --history-file, 'splunk' to search the results reported to --splunk-index, or 'github' to download the reports uploaded as --history-artifact by past GitHub Actions runs")
+	rootCmd.PersistentFlags().
+		DurationVar(&historyWindow, "history-window", 7*24*time.Hour, "How far back detect looks at the history of past sessions, 0 to not look at history")
+	rootCmd.PersistentFlags().
+		StringVar(&historyArtifact, "history-artifact", fg_github.DefaultReportArtifact, "Name of the artifacts --output-dir is uploaded as in GitHub Actions, for --history-source github. Artifacts whose names start with it are read too")
+	rootCmd.PersistentFlags().
+		StringVar(&historyCacheDir, "history-cache-dir", "", "Directory to cache artifacts downloaded for --history-source github in, defaults to flakeguard/artifacts in the user's cache directory")
+	historyCmd.Flags().
+		IntVar(&historyDays, "days", 30, "Only look at sessions from the last number of days, 0 for all of them")
+	historyCmd.Flags().
+		IntVar(&historyLastSessions, "last-sessions", 0, "Only look at the latest number of sessions, 0 for all of them")
+	historyCmd.Flags().
+		StringVar(&historyBranch, "branch", "", "Only look at sessions that ran on this branch")
+}
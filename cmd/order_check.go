@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/smartcontractkit/flakeguard/golang"
+	"github.com/smartcontractkit/flakeguard/ordercheck"
+	"github.com/smartcontractkit/flakeguard/report"
+	"github.com/smartcontractkit/flakeguard/runner"
+)
+
+const (
+	orderCheckFileOutput = "order-check-test-output-%d.json"
+	orderCheckReportFile = "order-check-report.json"
+)
+
+var (
+	// Order check specific flags
+	orderCheckTest    string
+	orderCheckPackage string
+)
+
+var orderCheckCmd = &cobra.Command{
+	Use:   "order-check --test <test> --package <package> [flakeguard flags] -- [gotestsum flags] -- [go test flags]",
+	Short: "Check if a flaky test fails because of the tests that run before it",
+	Long: `Check if a flaky test fails because of the tests that run before it.
+
+The test is run alone, then after every test that runs before it in its package. If it only fails after other tests,
+those tests are narrowed down until the smallest set of tests that pollute it is found.
+Every trial runs --runs times, and fails if the test fails in any of them.
+
+Examples:
+  flakeguard order-check --test TestVictim --package ./order -- -- -tags examples
+  flakeguard order-check --test TestVictim --package github.com/org/repo/pkg --runs 10`,
+	RunE: runOrderCheckCmd,
+}
+
+func runOrderCheckCmd(cmd *cobra.Command, args []string) error {
+	originalGotestsumFlags, goTestFlags := parseArgs(args)
+	logger.Info().
+		Str("test", orderCheckTest).
+		Str("package", orderCheckPackage).
+		Int("runs", runs).
+		Strs("entered_gotestsum_flags", originalGotestsumFlags).
+		Strs("entered_go_test_flags", goTestFlags).
+		Msg("Checking test order dependency")
+
+	if slices.Contains(originalGotestsumFlags, "--jsonfile") {
+		return fmt.Errorf("jsonfile flag cannot be overridden while using flakeguard")
+	}
+	goTestFlags, err := uncachedGoTestFlags(goTestFlags)
+	if err != nil {
+		return err
+	}
+
+	// Only top-level tests can be reordered
+	target, _, _ := strings.Cut(orderCheckTest, "/")
+	buildFlags := runner.BuildFlags(goTestFlags)
+	pkg, err := resolvePackage(orderCheckPackage, buildFlags)
+	if err != nil {
+		return err
+	}
+	tests, err := golang.TestNames(logger, ".", pkg, buildFlags...)
+	if err != nil {
+		return err
+	}
+	targetIndex := slices.Index(tests, target)
+	if targetIndex == -1 {
+		return fmt.Errorf("%w: looking for test '%s' in package '%s'", golang.ErrTestNotFound, target, pkg)
+	}
+	preceding := tests[:targetIndex]
+	fmt.Printf("Checking if %s depends on the %d tests that run before it\n", target, len(preceding))
+
+	r, err := runner.New(logger, runner.WithDir(outputDir), runner.WithFileFormat(orderCheckFileOutput))
+	if err != nil {
+		return err
+	}
+
+	nextRun := 1
+	trial := func(ctx context.Context, preceding []string) (bool, error) {
+		narrowedFlags := runner.NarrowGoTestFlags(goTestFlags, []string{pkg}, append(slices.Clone(preceding), target))
+		specs := make([]runner.Spec, 0, runs)
+		for range runs {
+			specs = append(specs, runner.Spec{
+				Number:         nextRun,
+				GotestsumFlags: originalGotestsumFlags,
+				GoTestFlags:    narrowedFlags,
+			})
+			nextRun++
+		}
+		completedRuns, err := r.Runs(ctx, specs, 1, nil)
+		if err != nil {
+			return false, err
+		}
+		results, err := report.Analyze(logger, outputDir, completedRuns, nil)
+		if err != nil {
+			return false, err
+		}
+		return slices.ContainsFunc(results, func(result *report.TestResult) bool {
+			return result.Name == target && len(result.FailingRunNumbers) > 0
+		}), nil
+	}
+
+	result, err := ordercheck.Check(cmd.Context(), logger, pkg, target, preceding, trial)
+	if err != nil {
+		return err
+	}
+	logger.Info().
+		Str("verdict", string(result.Verdict)).
+		Strs("polluters", result.Polluters).
+		Int("trials", result.Trials).
+		Msg("Order check complete")
+	fmt.Println(result.String())
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal order check result: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, orderCheckReportFile), resultJSON, 0600); err != nil {
+		return fmt.Errorf("failed to write order check report: %w", err)
+	}
+	return nil
+}
+
+// resolvePackage finds the import path of a package given either its import path or its directory
+func resolvePackage(pkg string, buildFlags []string) (string, error) {
+	pkgs, err := golang.Packages(logger, ".", buildFlags...)
+	if err != nil {
+		return "", fmt.Errorf("failed to load packages: %w", err)
+	}
+	absDir, err := filepath.Abs(pkg)
+	if err != nil {
+		return "", err
+	}
+	for _, info := range pkgs {
+		if info.ImportPath == pkg || info.Dir == absDir {
+			return info.ImportPath, nil
+		}
+	}
+	return "", fmt.Errorf("package '%s' not found", pkg)
+}
+
+func init() {
+	rootCmd.AddCommand(orderCheckCmd)
+	orderCheckCmd.Flags().StringVar(&orderCheckTest, "test", "", "Name of the flaky test to check")
+	orderCheckCmd.Flags().
+		StringVar(&orderCheckPackage, "package", "", "Import path or directory of the package the test is in")
+	_ = orderCheckCmd.MarkFlagRequired("test")
+	_ = orderCheckCmd.MarkFlagRequired("package")
+}
@@ -0,0 +1,557 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/smartcontractkit/flakeguard/config"
+	"github.com/smartcontractkit/flakeguard/exit"
+	"github.com/smartcontractkit/flakeguard/git"
+	fg_github "github.com/smartcontractkit/flakeguard/github"
+	"github.com/smartcontractkit/flakeguard/golang"
+	"github.com/smartcontractkit/flakeguard/history"
+	"github.com/smartcontractkit/flakeguard/report"
+	"github.com/smartcontractkit/flakeguard/runner"
+	"github.com/smartcontractkit/flakeguard/ticket"
+)
+
+const quarantineTitle = "Quarantine flaky tests"
+
+var (
+	// quarantinePR commits quarantines of tests that were already flaky on the base branch to the pull request that
+	// triggered the workflow
+	quarantinePR bool
+
+	// Quarantine specific flags
+	quarantineThreshold   float64
+	quarantineMinRuns     int
+	quarantineBase        string
+	quarantineBranch      string
+	quarantineHistoryLink string
+	quarantineTicketer    string
+)
+
+// Ticketers that track quarantined tests
+const ticketerGitHub = "github"
+
+var quarantineCmd = &cobra.Command{
+	Use:   "quarantine [flakeguard flags] [-- go build flags]",
+	Short: "Open a pull request quarantining flaky tests",
+	Long: `Open a pull request that quarantines every test whose flake rate on the base branch is over --threshold.
+
+The flake rates come from the history (--history-source) within --history-window. Each flaky test gets a
+flakeguard.Quarantine call, committed to --pr-branch through the GitHub API, so no push credentials are needed.
+If flakeguard's pull request is already open, the new quarantines are added to it and its description updated,
+instead of opening another one. Meant to run on a schedule, on a checkout of the base branch.
+
+With --ticketer, every flaky test also gets a ticket, commented on each time it's still flaky and closed once the
+test is reinstated, when its quarantine is removed from the code.
+
+Examples:
+  flakeguard quarantine --threshold 0.05
+  flakeguard quarantine --history-source splunk --min-runs 50 -- -tags integration`,
+	RunE: runQuarantineCmd,
+}
+
+// quarantineCandidate is a test over the quarantine threshold
+type quarantineCandidate struct {
+	history.Stats
+	// Path of the file the test is in, relative to the root of the repository, empty if it couldn't be found
+	Path   string
+	Owners []string
+	// Ticket links to the ticket tracking the flaky test, if there is one
+	Ticket string
+	// Quarantined is true once the test is quarantined on the pull request's branch
+	Quarantined bool
+	// Problem is why the test couldn't be quarantined automatically
+	Problem string
+}
+
+func runQuarantineCmd(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	buildFlags := runner.BuildFlags(args)
+	if historyWindow <= 0 {
+		return fmt.Errorf("--history-window must be set to judge which tests to quarantine")
+	}
+
+	owner, repo, err := githubRepository()
+	if err != nil {
+		return exit.New(exit.CodeFlakeguardError, err)
+	}
+	base := quarantineBase
+	if base == "" {
+		repository, err := fg_github.RepoInfo(ctx, githubClient, owner, repo)
+		if err != nil {
+			return exit.New(exit.CodeFlakeguardError, err)
+		}
+		base = repository.GetDefaultBranch()
+	}
+	l := logger.With().Str("repository", owner+"/"+repo).Str("base", base).Logger()
+
+	provider, err := historyProvider()
+	if err != nil {
+		return exit.New(exit.CodeFlakeguardError, err)
+	}
+	stats, err := provider.FlakeRates(ctx, history.Query{Since: time.Now().Add(-historyWindow), Branch: base})
+	if err != nil {
+		return exit.New(exit.CodeFlakeguardError, fmt.Errorf("failed to fetch history: %w", err))
+	}
+	candidates, err := quarantineCandidates(stats, overQuarantineThreshold, buildFlags)
+	if err != nil {
+		return exit.New(exit.CodeFlakeguardError, err)
+	}
+	if quarantineTicketer != "" && !dryRun {
+		ticketer, err := newTicketer(owner, repo)
+		if err != nil {
+			return exit.New(exit.CodeFlakeguardError, err)
+		}
+		if err := ticketQuarantines(ctx, ticketer, base, candidates, buildFlags); err != nil {
+			return exit.New(exit.CodeFlakeguardError, err)
+		}
+	}
+	if len(candidates) == 0 {
+		fmt.Printf("No tests on %s failed in at least %.2f%% of %d or more runs\n", base, quarantineThreshold*100, quarantineMinRuns)
+		return nil
+	}
+	l.Info().Int("candidates", len(candidates)).Msg("Found tests to quarantine")
+
+	if dryRun {
+		for _, candidate := range candidates {
+			candidate.Quarantined = candidate.Problem == ""
+		}
+		fmt.Println(quarantineBody(base, candidates))
+		return nil
+	}
+
+	pr, err := fg_github.UpsertBatchPullRequest(ctx, githubClient, fg_github.BatchPullRequest{
+		Owner:         owner,
+		Repo:          repo,
+		Base:          base,
+		Branch:        quarantineBranch,
+		Title:         quarantineTitle,
+		CommitMessage: quarantineTitle,
+		Edit: func(read fg_github.ReadFunc) (map[string][]byte, string, error) {
+			files, err := quarantineFiles(read, base, candidates)
+			return files, quarantineBody(base, candidates), err
+		},
+	})
+	if err != nil {
+		return exit.New(exit.CodeFlakeguardError, err)
+	}
+	if pr == nil {
+		fmt.Println("No tests left to quarantine automatically")
+		return nil
+	}
+	l.Info().Int("pull_request", pr.GetNumber()).Str("url", pr.GetHTMLURL()).Msg("Quarantine pull request is up to date")
+	fmt.Printf("Quarantine pull request: %s\n", pr.GetHTMLURL())
+	return nil
+}
+
+// quarantineCandidates picks the tests to quarantine by their history, and finds the files they're in and their code
+// owners. Subtests are left out if their parent test is picked too.
+func quarantineCandidates(
+	stats []history.Stats,
+	pick func(history.Stats) bool,
+	buildFlags []string,
+) ([]*quarantineCandidate, error) {
+	root, err := git.RepoRoot(".")
+	if err != nil {
+		return nil, err
+	}
+	codeOwners, err := fg_github.ReadCodeOwners(root)
+	if err != nil {
+		return nil, err
+	}
+
+	picked := map[[2]string]bool{}
+	for _, s := range stats {
+		if pick(s) {
+			picked[[2]string{s.Package, s.Test}] = true
+		}
+	}
+	candidates := []*quarantineCandidate{}
+	for _, s := range stats {
+		if !picked[[2]string{s.Package, s.Test}] {
+			continue
+		}
+		if exclusion, excluded := testFilter.Test(s.Package, s.Test); excluded {
+			logger.Debug().Str("package", s.Package).Str("test", s.Test).Str("rule", exclusion.Rule).Msg("Not quarantining test")
+			continue
+		}
+		topLevel, _, isSubtest := strings.Cut(s.Test, "/")
+		if isSubtest && picked[[2]string{s.Package, topLevel}] {
+			continue
+		}
+
+		candidate := &quarantineCandidate{Stats: s}
+		candidates = append(candidates, candidate)
+		if isSubtest {
+			candidate.Problem = "subtests have to be quarantined by hand"
+		}
+		location, err := golang.FindTestLocation(logger, ".", s.Package, topLevel, buildFlags...)
+		if err != nil {
+			candidate.Problem = cmp.Or(candidate.Problem, "can't find the test in the code")
+			continue
+		}
+		candidate.Path, err = git.RelativePath(location.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		candidate.Owners = codeOwners.Owners(candidate.Path)
+		// The quarantine call imports flakeguard, which wouldn't compile in modules that don't require it
+		requires, err := golang.RequiresFlakeguard(filepath.Dir(location.FilePath))
+		if err != nil {
+			return nil, err
+		}
+		if !requires {
+			candidate.Problem = cmp.Or(candidate.Problem, "its module doesn't require github.com/smartcontractkit/flakeguard, add it with go get")
+		}
+	}
+	slices.SortFunc(candidates, func(a, b *quarantineCandidate) int {
+		return cmp.Or(cmp.Compare(b.FlakeRate(), a.FlakeRate()), cmp.Compare(a.Package, b.Package), cmp.Compare(a.Test, b.Test))
+	})
+	return candidates, nil
+}
+
+// quarantineFiles adds a quarantine call to every candidate test, in the files read from the pull request's branch
+func quarantineFiles(read fg_github.ReadFunc, base string, candidates []*quarantineCandidate) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for _, candidate := range candidates {
+		if candidate.Problem != "" {
+			continue
+		}
+		content, ok := files[candidate.Path]
+		if !ok {
+			var err error
+			content, err = read(candidate.Path)
+			if err != nil {
+				return nil, err
+			}
+		}
+		message := fmt.Sprintf("Flaky: failed %.2f%% of %d runs on %s, quarantined by flakeguard",
+			candidate.FlakeRate()*100, candidate.Runs, base)
+		quarantined, err := golang.QuarantineTest(content, candidate.Test, message)
+		switch {
+		case errors.Is(err, golang.ErrAlreadyQuarantined):
+			candidate.Quarantined = true
+		case errors.Is(err, golang.ErrCannotQuarantine), errors.Is(err, golang.ErrTestNotFound):
+			candidate.Problem = err.Error()
+		case err != nil:
+			return nil, fmt.Errorf("failed to quarantine %s in %s: %w", candidate.Test, candidate.Path, err)
+		default:
+			candidate.Quarantined = true
+			files[candidate.Path] = quarantined
+		}
+	}
+	return files, nil
+}
+
+// quarantineBody describes the quarantined tests for the pull request, and lists the ones that need a hand
+func quarantineBody(base string, candidates []*quarantineCandidate) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### :snowflake: Quarantine flaky tests\n\n")
+	fmt.Fprintf(&b, "These tests failed in at least %.2f%% of their runs on `%s` over the last %s. ",
+		quarantineThreshold*100, base, report.History{Window: historyWindow}.WindowString())
+	fmt.Fprintf(&b, "Quarantined tests are skipped, unless `FLAKEGUARD_RUN_QUARANTINED_TESTS=true` is set.\n\n")
+	b.WriteString("| Test | Package | Flake Rate | Runs | History | Code Owners | Ticket |\n")
+	b.WriteString("| --- | --- | --- | --- | --- | --- | --- |\n")
+	for _, candidate := range candidates {
+		if !candidate.Quarantined {
+			continue
+		}
+		fmt.Fprintf(&b, "| `%s` | `%s` | %.2f%% | %d | %s | %s | %s |\n",
+			candidate.Test, candidate.Package, candidate.FlakeRate()*100, candidate.Runs,
+			historyLink(candidate.Package, candidate.Test), cmp.Or(strings.Join(candidate.Owners, " "), "-"), cmp.Or(candidate.Ticket, "-"))
+	}
+
+	var manual strings.Builder
+	for _, candidate := range candidates {
+		if candidate.Problem != "" {
+			fmt.Fprintf(&manual, "- `%s` in `%s` (%.2f%% of %d runs): %s\n",
+				candidate.Test, candidate.Package, candidate.FlakeRate()*100, candidate.Runs, candidate.Problem)
+		}
+	}
+	if manual.Len() > 0 {
+		b.WriteString("\n#### Needs to be quarantined by hand\n\n")
+		b.WriteString(manual.String())
+	}
+	return b.String()
+}
+
+// historyLink links to the history of a test with --history-link, or "-" if it isn't set
+func historyLink(pkg, test string) string {
+	if quarantineHistoryLink == "" {
+		return "-"
+	}
+	return fmt.Sprintf("[History](%s)", historyURL(pkg, test))
+}
+
+// historyURL is --history-link for a test, empty if it isn't set
+func historyURL(pkg, test string) string {
+	if quarantineHistoryLink == "" {
+		return ""
+	}
+	return strings.NewReplacer("{package}", url.QueryEscape(pkg), "{test}", url.QueryEscape(test)).Replace(quarantineHistoryLink)
+}
+
+// newTicketer returns the ticketer set with --ticketer
+func newTicketer(owner, repo string) (ticket.Ticketer, error) {
+	switch quarantineTicketer {
+	case ticketerGitHub:
+		return fg_github.NewIssueTicketer(logger, githubClient, owner, repo), nil
+	default:
+		return nil, fmt.Errorf("unknown ticketer %q, must be %s", quarantineTicketer, ticketerGitHub)
+	}
+}
+
+// ticketQuarantines reports every candidate to the ticketer and links its ticket in the pull request. Tickets of tests
+// seen quarantined in the code that's checked out are marked as such, and closed once the tests are reinstated: no
+// longer flaky enough to be candidates, and no longer quarantined. Tests that were never quarantined, like while the
+// quarantine pull request is still open, keep their tickets.
+func ticketQuarantines(
+	ctx context.Context,
+	ticketer ticket.Ticketer,
+	base string,
+	candidates []*quarantineCandidate,
+	buildFlags []string,
+) error {
+	isCandidate := map[[2]string]bool{}
+	for _, candidate := range candidates {
+		isCandidate[[2]string{candidate.Package, candidate.Test}] = true
+		reported, err := ticketer.Report(ctx, ticket.Occurrence{
+			Package:   candidate.Package,
+			Test:      candidate.Test,
+			Branch:    base,
+			FlakeRate: candidate.FlakeRate(),
+			Runs:      candidate.Runs,
+			Path:      candidate.Path,
+			Owners:    candidate.Owners,
+			Link:      historyURL(candidate.Package, candidate.Test),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to report %s in %s to ticketer: %w", candidate.Test, candidate.Package, err)
+		}
+		candidate.Ticket = fmt.Sprintf("[%s](%s)", reported.ID, reported.URL)
+	}
+
+	open, err := ticketer.Open(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list open tickets: %w", err)
+	}
+	for _, tk := range open {
+		// Subtests are quarantined by hand, in ways that can't be told apart from the code
+		if strings.Contains(tk.Test, "/") {
+			continue
+		}
+		quarantined, err := isQuarantinedInCode(tk.Package, tk.Test, buildFlags)
+		if err != nil {
+			return err
+		}
+		if quarantined {
+			if !tk.Quarantined {
+				if err := ticketer.MarkQuarantined(ctx, tk); err != nil {
+					return fmt.Errorf("failed to mark ticket %s as quarantined: %w", tk.ID, err)
+				}
+			}
+			continue
+		}
+		if !tk.Quarantined || isCandidate[[2]string{tk.Package, tk.Test}] {
+			continue
+		}
+		reason := fmt.Sprintf("`%s` is no longer quarantined on `%s`, closing.", tk.Test, base)
+		if err := ticketer.Close(ctx, tk, reason); err != nil {
+			return fmt.Errorf("failed to close ticket %s: %w", tk.ID, err)
+		}
+	}
+	return nil
+}
+
+// isQuarantinedInCode reports whether a test is quarantined in the code that's checked out. Removed tests aren't.
+func isQuarantinedInCode(pkg, test string, buildFlags []string) (bool, error) {
+	location, err := golang.FindTestLocation(logger, ".", pkg, test, buildFlags...)
+	if errors.Is(err, golang.ErrTestNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	src, err := os.ReadFile(location.FilePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", location.FilePath, err)
+	}
+	quarantined, err := golang.IsQuarantined(src, test)
+	if err != nil {
+		return false, fmt.Errorf("failed to check whether %s is quarantined: %w", test, err)
+	}
+	return quarantined, nil
+}
+
+// quarantineOnPullRequest quarantines flaky tests that are blocking the pull request that triggered the workflow, but
+// were already flaky on its base branch before it, by committing to the pull request's own branch. It explains why in a
+// comment on the pull request, or asks for them to be quarantined by hand if the branch can't be pushed to.
+func quarantineOnPullRequest(ctx context.Context, results []*report.TestResult, buildFlags []string) error {
+	if !quarantinePR || dryRun {
+		return nil
+	}
+	githubEnv, err := fg_github.GetActionsEnv()
+	if errors.Is(err, fg_github.ErrNotInActions) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	pr, err := fg_github.ReadPullRequest(githubEnv.EventPath)
+	if errors.Is(err, fg_github.ErrNotPullRequest) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	owner, repo, ok := strings.Cut(githubEnv.Repository, "/")
+	if !ok {
+		return fmt.Errorf("invalid GITHUB_REPOSITORY '%s'", githubEnv.Repository)
+	}
+	flaky := map[[2]string]bool{}
+	for _, result := range report.FlakyTests(results) {
+		flaky[[2]string{result.Package, result.Name}] = true
+	}
+	if len(flaky) == 0 || historyWindow <= 0 {
+		return nil
+	}
+	base := pr.Base.Ref
+	l := logger.With().Int("pull_request", pr.Number).Str("base", base).Logger()
+	// Guard doesn't have quarantine's flags, apply their settings to hold tests to the same bar as batch quarantines
+	if _, err := config.Apply(quarantineCmd.LocalNonPersistentFlags(), configFileUsed, configSettings, os.LookupEnv); err != nil {
+		return err
+	}
+
+	provider, err := historyProvider()
+	if err != nil {
+		return err
+	}
+	stats, err := provider.FlakeRates(ctx, history.Query{Since: time.Now().Add(-historyWindow), Branch: base})
+	if err != nil {
+		return fmt.Errorf("failed to fetch history of %s: %w", base, err)
+	}
+	candidates, err := quarantineCandidates(stats, alreadyFlaky(flaky), buildFlags)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		l.Debug().Msg("No flaky tests that were already flaky on the base branch")
+		return nil
+	}
+
+	pushed, err := fg_github.CommitToPullRequest(ctx, l, githubClient, fg_github.PullRequestCommit{
+		Owner:           owner,
+		Repo:            repo,
+		Number:          pr.Number,
+		ExpectedHeadSHA: pr.Head.SHA,
+		Message:         fmt.Sprintf("Quarantine tests that are flaky on %s", base),
+		Edit: func(read fg_github.ReadFunc) (map[string][]byte, error) {
+			return quarantineFiles(read, base, candidates)
+		},
+	})
+	var body string
+	switch {
+	case errors.Is(err, fg_github.ErrNothingToCommit):
+		l.Info().Msg("Tests that were already flaky on the base branch are quarantined already, or need a hand")
+		return nil
+	case errors.Is(err, fg_github.ErrCannotPush):
+		l.Warn().Err(err).Msg("Can't push quarantines to pull request, asking for them to be done by hand")
+		body = quarantineComment(base, candidates, fg_github.PushedCommit{}, err)
+	case err != nil:
+		return err
+	default:
+		l.Info().Str("sha", pushed.SHA).Str("branch", pushed.Branch).Bool("reapplied", pushed.Reapplied).Msg("Pushed quarantines to pull request")
+		body = quarantineComment(base, candidates, pushed, nil)
+	}
+	// Later runs update the comment instead of adding another, like when the branch can never be pushed to
+	_, err = fg_github.UpsertComment(ctx, githubClient, fg_github.StickyComment{
+		Owner:  owner,
+		Repo:   repo,
+		Number: pr.Number,
+		Key:    "quarantine/" + githubEnv.Workflow + "/" + githubEnv.Job,
+	}, body)
+	return err
+}
+
+// overQuarantineThreshold is true if a test failed often enough, over enough runs, to be quarantined
+func overQuarantineThreshold(s history.Stats) bool {
+	return s.Runs >= quarantineMinRuns && s.FlakeRate() >= quarantineThreshold
+}
+
+// alreadyFlaky is true for tests that were flaky in the session, and were flaky on the base branch before the pull
+// request too, so it's not what made them flaky. One bad commit on the base branch isn't enough, they have to be over
+// the quarantine threshold.
+func alreadyFlaky(flaky map[[2]string]bool) func(history.Stats) bool {
+	return func(s history.Stats) bool {
+		return flaky[[2]string{s.Package, s.Test}] && overQuarantineThreshold(s)
+	}
+}
+
+// quarantineComment explains to the author of a pull request why flakeguard quarantined tests on their branch, or why
+// it couldn't
+func quarantineComment(base string, candidates []*quarantineCandidate, pushed fg_github.PushedCommit, pushErr error) string {
+	var b strings.Builder
+	if pushErr != nil {
+		b.WriteString("### :snowflake: Flaky tests need to be quarantined\n\n")
+	} else {
+		b.WriteString("### :snowflake: Flakeguard quarantined flaky tests\n\n")
+	}
+	fmt.Fprintf(&b, "These tests were already flaky on `%s` before this pull request, so they're not failing because of it. ", base)
+	if pushErr != nil {
+		fmt.Fprintf(&b, "Flakeguard can't push to this branch (%s), ", pushErr)
+		b.WriteString("so to keep them from blocking it, please add `flakeguard.Quarantine(t, \"...\")` to the start of each of them.\n\n")
+	} else {
+		fmt.Fprintf(&b, "To keep them from blocking it, flakeguard quarantined them in %s, pull before pushing again.", pushed.SHA)
+		if pushed.Reapplied {
+			b.WriteString(" The branch had new commits since it was tested, the quarantines were made on top of them.")
+		}
+		b.WriteString("\n\n")
+	}
+	for _, candidate := range candidates {
+		if pushErr == nil && !candidate.Quarantined {
+			continue
+		}
+		fmt.Fprintf(&b, "- `%s` in `%s`: failed %.2f%% of %d runs on `%s`\n",
+			candidate.Test, candidate.Package, candidate.FlakeRate()*100, candidate.Runs, base)
+	}
+
+	if pushErr == nil {
+		var manual strings.Builder
+		for _, candidate := range candidates {
+			if candidate.Problem != "" {
+				fmt.Fprintf(&manual, "- `%s` in `%s`: %s\n", candidate.Test, candidate.Package, candidate.Problem)
+			}
+		}
+		if manual.Len() > 0 {
+			b.WriteString("\n#### Needs to be quarantined by hand\n\n")
+			b.WriteString(manual.String())
+		}
+	}
+	return b.String()
+}
+
+func init() {
+	rootCmd.AddCommand(quarantineCmd)
+	quarantineCmd.Flags().
+		Float64Var(&quarantineThreshold, "threshold", 0.05, "Flake rate at or above which a test is quarantined, between 0 and 1")
+	quarantineCmd.Flags().
+		IntVar(&quarantineMinRuns, "min-runs", 20, "Fewest runs within --history-window a test needs to be judged by its flake rate")
+	quarantineCmd.Flags().
+		StringVar(&quarantineBase, "base", "", "Branch to judge flake rates on and open the pull request into, defaults to the repository's default branch")
+	quarantineCmd.Flags().
+		StringVar(&quarantineBranch, "pr-branch", "flakeguard/quarantine", "Branch flakeguard commits quarantines to")
+	quarantineCmd.Flags().
+		StringVar(&quarantineHistoryLink, "history-link", "", "Link to the history of a test in the pull request, with {package} and {test} replaced (e.g. a Splunk search)")
+	quarantineCmd.Flags().
+		StringVar(&quarantineTicketer, "ticketer", "", "Track every quarantined test with a ticket until it's reinstated: 'github' for GitHub Issues. Unset opens no tickets")
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/smartcontractkit/flakeguard/report"
+	"github.com/smartcontractkit/flakeguard/reproduce"
+	"github.com/smartcontractkit/flakeguard/runner"
+)
+
+const (
+	reproduceFileOutput = "reproduce-test-output-%d.json"
+	reproduceReportFile = "reproduce-report.json"
+)
+
+var (
+	// Reproduce specific flags
+	reproducePackage string
+	reproduceBudget  time.Duration
+	reproduceCount   int
+	reproduceAll     bool
+)
+
+var reproduceCmd = &cobra.Command{
+	Use:   "reproduce <test> --package <package> [flakeguard flags] -- [gotestsum flags] -- [go test flags]",
+	Short: "Reproduce a flaky test by following the fixing flaky tests guide",
+	Long: `Reproduce a flaky test by running it under increasingly hostile conditions, the same steps the fixing flaky tests guide
+walks through by hand: alone, with its package, in random order, with the race detector, and with different CPU limits.
+
+Each condition runs until the test fails or its --budget runs out. Flakeguard stops at the first condition that
+reproduces the failure, unless --all is set, and reports the failure rate under each condition.
+
+Examples:
+  flakeguard reproduce TestFlakeTenPercent --package ./flaky -- -- -tags examples
+  flakeguard reproduce TestMyFlake --package github.com/org/repo/pkg --budget 5m --all`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		// Only the test name comes before the gotestsum and go test flags
+		if dash := cmd.ArgsLenAtDash(); len(args) == 0 || (dash != -1 && dash != 1) || (dash == -1 && len(args) != 1) {
+			return fmt.Errorf("expected a single test name before any gotestsum and go test flags")
+		}
+		return nil
+	},
+	RunE: runReproduceCmd,
+}
+
+func runReproduceCmd(cmd *cobra.Command, args []string) error {
+	test := args[0]
+	originalGotestsumFlags, goTestFlags := parseArgs(args[1:])
+	logger.Info().
+		Str("test", test).
+		Str("package", reproducePackage).
+		Str("budget", reproduceBudget.String()).
+		Int("count", reproduceCount).
+		Bool("all", reproduceAll).
+		Strs("entered_gotestsum_flags", originalGotestsumFlags).
+		Strs("entered_go_test_flags", goTestFlags).
+		Msg("Reproducing flaky test")
+
+	if slices.Contains(originalGotestsumFlags, "--jsonfile") {
+		return fmt.Errorf("jsonfile flag cannot be overridden while using flakeguard")
+	}
+	for _, flag := range goTestFlags {
+		if strings.HasPrefix(flag, "-count=") {
+			return fmt.Errorf("-count flag in go test cannot be overridden while using flakeguard, use --count instead")
+		}
+	}
+	if reproduceCount < 1 {
+		return fmt.Errorf("--count must be at least 1")
+	}
+
+	pkg, err := resolvePackage(reproducePackage, runner.BuildFlags(goTestFlags))
+	if err != nil {
+		return err
+	}
+
+	r, err := runner.New(logger, runner.WithDir(outputDir), runner.WithFileFormat(reproduceFileOutput))
+	if err != nil {
+		return err
+	}
+
+	topLevel, _, _ := strings.Cut(test, "/")
+	nextRun := 1
+	attempt := func(ctx context.Context, condition reproduce.Condition) (int, int, error) {
+		tests := []string{topLevel}
+		if condition.WholePackage {
+			tests = nil
+		}
+		flags := runner.NarrowGoTestFlags(goTestFlags, []string{pkg}, tests)
+		flags = append(flags, condition.GoTestFlags...)
+		flags = append(flags, fmt.Sprintf("-count=%d", reproduceCount))
+
+		run, err := r.Run(ctx, runner.Spec{
+			Number:         nextRun,
+			GotestsumFlags: originalGotestsumFlags,
+			GoTestFlags:    flags,
+		}, 0, false)
+		nextRun++
+		if err != nil {
+			return 0, 0, err
+		}
+		results, err := report.Analyze(logger, outputDir, []report.Run{run}, nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, result := range results {
+			if result.Package == pkg && result.Name == test {
+				return result.Runs, result.Runs - result.Successes, nil
+			}
+		}
+		return 0, 0, nil
+	}
+
+	fmt.Printf("Reproducing %s in %s\n", test, pkg)
+	results, err := reproduce.Run(
+		cmd.Context(),
+		logger,
+		reproduce.DefaultConditions(),
+		reproduceBudget,
+		reproduceAll,
+		attempt,
+	)
+	if err != nil {
+		return err
+	}
+	if err := reproduce.WriteReport(os.Stdout, test, results); err != nil {
+		return fmt.Errorf("failed to write reproduce report: %w", err)
+	}
+
+	resultsJSON, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("failed to marshal reproduce results: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, reproduceReportFile), resultsJSON, 0600); err != nil {
+		return fmt.Errorf("failed to write reproduce report: %w", err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(reproduceCmd)
+	reproduceCmd.Flags().
+		StringVar(&reproducePackage, "package", "", "Import path or directory of the package the test is in")
+	reproduceCmd.Flags().
+		DurationVar(&reproduceBudget, "budget", time.Minute, "How long to keep trying each condition before moving on to the next. This is a soft-limit, and will not abort in the middle of an attempt.")
+	reproduceCmd.Flags().
+		IntVar(&reproduceCount, "count", 20, "How many times each attempt runs the test with go test -count")
+	reproduceCmd.Flags().
+		BoolVar(&reproduceAll, "all", false, "Try every condition and report failure rates for all of them, instead of stopping at the first one that reproduces the failure")
+	_ = reproduceCmd.MarkFlagRequired("package")
+}
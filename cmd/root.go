@@ -2,18 +2,25 @@
 package cmd
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/charmbracelet/fang"
 	"github.com/go-git/go-git/v5"
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
 
+	"github.com/smartcontractkit/flakeguard/config"
 	"github.com/smartcontractkit/flakeguard/exit"
+	"github.com/smartcontractkit/flakeguard/filter"
 	fg_git "github.com/smartcontractkit/flakeguard/git"
 	fg_github "github.com/smartcontractkit/flakeguard/github"
 	"github.com/smartcontractkit/flakeguard/logging"
@@ -37,6 +44,14 @@ var (
 	// GitHub
 	// Flag for GitHub token
 	githubToken string
+	// API URLs and CA certificates of GitHub Enterprise Server installs
+	githubAPIURL     string
+	githubGraphQLURL string
+	githubCAFile     string
+	// GitHub App to authenticate as instead of with a token
+	githubAppID             int64
+	githubAppInstallationID int64
+	githubAppPrivateKey     string
 	// Client for GitHub API
 	githubClient *fg_github.Client
 
@@ -45,6 +60,9 @@ var (
 	splunkToken      string
 	splunkIndex      string
 	splunkSourceType string
+	// Splunk's search API, used to fetch history
+	splunkSearchURL   string
+	splunkSearchToken string
 
 	dxWebhookURL string
 
@@ -56,7 +74,17 @@ var rootCmd = &cobra.Command{
 	Short:        "Detect and prevent flaky tests from disrupting CI/CD pipelines",
 	Long:         `Flakeguard helps you detect and prevent flaky tests from disrupting CI/CD pipelines.`,
 	SilenceUsage: true,
-	PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+	PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+		if err := applyConfig(cmd); err != nil {
+			return exit.New(exit.CodeFlakeguardError, err)
+		}
+
+		var err error
+		testFilter, err = filter.New(ignorePackages, focusPackages, ignoreTests, focusTests)
+		if err != nil {
+			return exit.New(exit.CodeFlakeguardError, err)
+		}
+
 		// Setup logging
 		loggingOpts := []logging.Option{}
 		if !enableConsoleLogs {
@@ -68,7 +96,6 @@ var rootCmd = &cobra.Command{
 		if logFile != "" {
 			loggingOpts = append(loggingOpts, logging.WithFileName(fmt.Sprintf("%s/%s", outputDir, logFile)))
 		}
-		var err error
 		if err = os.MkdirAll(outputDir, 0750); err != nil {
 			return exit.New(exit.CodeFlakeguardError, err)
 		}
@@ -77,7 +104,11 @@ var rootCmd = &cobra.Command{
 			return exit.New(exit.CodeFlakeguardError, err)
 		}
 
-		githubClient, err = fg_github.NewClient(logger, githubToken, nil)
+		githubOpts, err := githubClientOptions(logger)
+		if err != nil {
+			return exit.New(exit.CodeFlakeguardError, err)
+		}
+		githubClient, err = fg_github.NewClient(logger, githubToken, nil, githubOpts...)
 		if err != nil {
 			return exit.New(exit.CodeFlakeguardError, err)
 		}
@@ -102,12 +133,16 @@ var rootCmd = &cobra.Command{
 			Bool("enable_console_logs", enableConsoleLogs).
 			Int("runs", runs).
 			Str("output_dir", outputDir).
+			Str("config_file", configFilePath()).
 			Msg("Run info")
 		return nil
 	},
 }
 
 func init() {
+	rootCmd.PersistentFlags().
+		StringVar(&configFile, "config", "", "Configuration file to use instead of the "+config.FileName+" at the root of the repository")
+
 	// Logging
 	rootCmd.PersistentFlags().
 		StringVar(&logFile, "log-file", "flakeguard.log.json", "File to store flakeguard logs")
@@ -124,9 +159,37 @@ func init() {
 	rootCmd.PersistentFlags().
 		BoolVarP(&dryRun, "dry-run", "d", false, "Disables making any changes to the codebase and prevents reporting results to outside services (Splunk, Slack, etc.)")
 
+	// Filtering
+	rootCmd.PersistentFlags().
+		StringArrayVar(&ignorePackages, "ignore-package", nil, "Glob pattern of package import paths to leave out of runs, analysis, reports, and quarantine decisions. '*' matches within a path element, '...' matches anything (e.g. 'github.com/org/repo/e2e/...'). Can be repeated.")
+	rootCmd.PersistentFlags().
+		StringArrayVar(&focusPackages, "focus-package", nil, "Glob pattern of package import paths to focus on, every other package is left out. Can be repeated.")
+	rootCmd.PersistentFlags().
+		StringArrayVar(&ignoreTests, "ignore-test", nil, "Glob pattern of test names to leave out of runs, analysis, reports, and quarantine decisions, along with their subtests (e.g. 'TestKnownBad*'). Can be repeated.")
+	rootCmd.PersistentFlags().
+		StringArrayVar(&focusTests, "focus-test", nil, "Glob pattern of test names to focus on, every other test is left out. Can be repeated.")
+
 	// GitHub
 	rootCmd.PersistentFlags().
 		StringVarP(&githubToken, "github-token", "t", "", "GitHub token to use for GitHub API requests, if not provided, the GITHUB_TOKEN environment variable will be used")
+	rootCmd.PersistentFlags().
+		Int64Var(&githubAppID, "github-app-id", 0, "ID of a GitHub App to authenticate as instead of with a token, so the pull requests flakeguard opens trigger workflows")
+	rootCmd.PersistentFlags().
+		Int64Var(&githubAppInstallationID, "github-app-installation-id", 0, "Installation of the GitHub App to authenticate as, defaults to its installation on the repository")
+	rootCmd.PersistentFlags().
+		StringVar(&githubAppPrivateKey, "github-app-private-key", "", "PEM encoded private key of the GitHub App, or the path of a file holding it")
+	rootCmd.PersistentFlags().
+		StringVar(&githubAPIURL, "github-api-url", "", "GitHub Enterprise REST API URL (e.g. https://github.example.com/api/v3). Defaults to GITHUB_API_URL in GitHub Actions, or is derived from the git remote's host if it looks like a GitHub Enterprise install.")
+	rootCmd.PersistentFlags().
+		StringVar(&githubGraphQLURL, "github-graphql-url", "", "GitHub Enterprise GraphQL API URL (e.g. https://github.example.com/api/graphql). Derived from --github-api-url if not set.")
+	rootCmd.PersistentFlags().
+		StringVar(&githubCAFile, "github-ca-file", "", "PEM file of CA certificates to trust for GitHub API requests, on top of the system's, for on-prem installs")
+	rootCmd.PersistentFlags().
+		BoolVar(&prComment, "pr-comment", true, "In GitHub Actions pull request workflows, keep a comment on the pull request listing the flaky tests found, and delete it once a run finds none")
+	rootCmd.PersistentFlags().
+		BoolVar(&checkRun, "check-run", true, "In GitHub Actions, publish a Flakeguard check run with an annotation on each flaky test. Needs the checks: write permission.")
+	rootCmd.PersistentFlags().
+		BoolVar(&workflowCommands, "workflow-commands", true, "In GitHub Actions, group the output of each run in the log, annotate failing and flaky tests, and set the flaky_tests, failing_tests, report_path, and verdict step outputs")
 
 	// Reporting
 	// Splunk
@@ -138,6 +201,10 @@ func init() {
 		StringVar(&splunkIndex, "splunk-index", "flakeguard_json", "Splunk index to send events to")
 	rootCmd.PersistentFlags().
 		StringVar(&splunkSourceType, "splunk-source-type", "flakeguard_json", "Splunk source type to send events to")
+	rootCmd.PersistentFlags().
+		StringVar(&splunkSearchURL, "splunk-search-url", "", "Splunk REST API URL (e.g. https://splunk.example.com:8089) to search for test history with --history-source splunk")
+	rootCmd.PersistentFlags().
+		StringVar(&splunkSearchToken, "splunk-search-token", "", "Splunk token allowed to run searches on --splunk-index")
 
 	// DX
 	rootCmd.PersistentFlags().
@@ -152,8 +219,17 @@ func init() {
 }
 
 // Execute executes the root flakeguard command.
+// SIGINT and SIGTERM cancel the command's context, so commands can stop in-flight work and wrap up.
+// A second signal kills flakeguard right away.
 func Execute() {
-	err := fang.Execute(context.Background(), rootCmd, fang.WithVersion(version), fang.WithCommit(commit))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := fang.Execute(ctx, rootCmd, fang.WithVersion(version), fang.WithCommit(commit))
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to execute command")
 		os.Exit(exit.GetCode(err))
@@ -182,7 +258,10 @@ func parseArgs(args []string) (gotestsumFlags []string, goTestFlags []string) {
 	return gotestsumFlags, goTestFlags
 }
 
+// testRunInfo describes the code the tests run on, from the git repository and, in GitHub Actions, from the workflow's
+// environment and event
 func testRunInfo(
+	ctx context.Context,
 	l zerolog.Logger,
 	githubClient *fg_github.Client,
 	repoPath string,
@@ -204,19 +283,64 @@ func testRunInfo(
 
 	// Get GitHub Actions data if available
 	githubEnv, err := fg_github.GetActionsEnv()
-	if err != nil && !errors.Is(err, fg_github.ErrNotInActions) {
+	if err == nil {
+		if err := addActionsInfo(&t, githubEnv); err != nil {
+			return t, err
+		}
+	} else if !errors.Is(err, fg_github.ErrNotInActions) {
 		return t, fmt.Errorf("failed to get GitHub Actions environment variables: %w", err)
 	}
-	t.GitHubEvent = githubEnv.EventName
-	t.BaseBranch = githubEnv.BaseRef
 
-	// Get GitHub Repo data if available
-	err = fg_github.RepoInfo(githubClient, repoInfo.Owner, repoInfo.Name)
-	if err != nil {
-		return t, fmt.Errorf("failed to get GitHub repo info: %w", err)
+	if t.DefaultBranch == "" {
+		t.DefaultBranch, err = fg_git.DefaultBranch(repoPath)
+		if err != nil {
+			l.Debug().Err(err).Msg("Default branch isn't known locally, getting it from GitHub")
+			repo, err := fg_github.RepoInfo(ctx, githubClient, repoInfo.Owner, repoInfo.Name)
+			if err != nil {
+				l.Warn().Err(err).Msg("Failed to get default branch")
+			}
+			t.DefaultBranch = repo.GetDefaultBranch()
+		}
 	}
+	t.OnDefaultBranch = t.DefaultBranch != "" && t.HeadBranch == t.DefaultBranch && t.PullRequestNumber == 0
+	return t, nil
+}
+
+// addActionsInfo adds the workflow run, and the branches and commits of the event that triggered it, to the test run
+// info. Actions checks out a detached HEAD, so the branches have to come from the workflow instead of git.
+func addActionsInfo(t *report.TestRunInfo, githubEnv fg_github.ActionsEnv) error {
 	t.GitHubEvent = githubEnv.EventName
+	t.GitHubWorkflow = githubEnv.Workflow
+	t.GitHubRunID = strconv.FormatInt(githubEnv.RunID, 10)
+	t.GitHubRunNumber = strconv.Itoa(githubEnv.RunNumber)
+	t.GitHubRunAttempt = githubEnv.RunAttempt
+	t.RunnerName = githubEnv.RunnerName
+	if branch, ok := strings.CutPrefix(githubEnv.Ref, "refs/heads/"); ok {
+		t.HeadBranch = branch
+		t.HeadCommit = cmp.Or(githubEnv.SHA, t.HeadCommit)
+	}
 	t.BaseBranch = githubEnv.BaseRef
+	if githubEnv.EventPath == "" {
+		return nil
+	}
 
-	return t, nil
+	event, err := fg_github.ReadEvent(githubEnv.EventPath)
+	if err != nil {
+		return err
+	}
+	t.DefaultBranch = event.Repository.DefaultBranch
+	switch {
+	case event.PullRequest != nil:
+		t.PullRequestNumber = event.PullRequest.Number
+		t.HeadBranch = event.PullRequest.Head.Ref
+		t.HeadCommit = event.PullRequest.Head.SHA
+		t.BaseBranch = event.PullRequest.Base.Ref
+		t.BaseCommit = event.PullRequest.Base.SHA
+	case event.MergeGroup != nil:
+		t.HeadBranch = strings.TrimPrefix(event.MergeGroup.HeadRef, "refs/heads/")
+		t.HeadCommit = event.MergeGroup.HeadSHA
+		t.BaseBranch = strings.TrimPrefix(event.MergeGroup.BaseRef, "refs/heads/")
+		t.BaseCommit = event.MergeGroup.BaseSHA
+	}
+	return nil
 }
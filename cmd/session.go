@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/smartcontractkit/flakeguard/report"
+)
+
+const detectSessionFile = "detect-session.json"
+
+// detectSession is kept in the output dir and updated after every run, so that an interrupted detect session can be
+// reported on or resumed with --resume.
+type detectSession struct {
+	Started time.Time `json:"started"`
+	// The gotestsum and go test flags as they were entered, before flakeguard adds its own
+	GotestsumFlags []string           `json:"gotestsum_flags"`
+	GoTestFlags    []string           `json:"go_test_flags"`
+	TestRunInfo    report.TestRunInfo `json:"test_run_info"`
+	CompletedRuns  []report.Run       `json:"completed_runs"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// newDetectSession starts a new session, replacing any previous session in dir
+func newDetectSession(
+	dir string,
+	gotestsumFlags, goTestFlags []string,
+	testRunInfo report.TestRunInfo,
+) (*detectSession, error) {
+	session := &detectSession{
+		Started:        time.Now(),
+		GotestsumFlags: gotestsumFlags,
+		GoTestFlags:    goTestFlags,
+		TestRunInfo:    testRunInfo,
+		CompletedRuns:  []report.Run{},
+		path:           filepath.Join(dir, detectSessionFile),
+	}
+	return session, session.save()
+}
+
+// loadDetectSession loads the session in dir to resume it.
+// Completed runs whose output file is gone are dropped, so they run again.
+func loadDetectSession(l zerolog.Logger, dir string) (*detectSession, error) {
+	path := filepath.Join(dir, detectSessionFile)
+	//nolint:gosec // we're reading our own session file
+	sessionBytes, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no detect session to resume in '%s'", dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read detect session: %w", err)
+	}
+
+	session := &detectSession{path: path}
+	if err := json.Unmarshal(sessionBytes, session); err != nil {
+		return nil, fmt.Errorf("failed to parse detect session '%s': %w", path, err)
+	}
+
+	completedRuns := make([]report.Run, 0, len(session.CompletedRuns))
+	for _, run := range session.CompletedRuns {
+		if _, err := os.Stat(filepath.Join(dir, run.File)); err != nil {
+			l.Warn().Err(err).Int("run", run.Number).Str("file", run.File).Msg("Output of completed run is missing, it will run again")
+			continue
+		}
+		completedRuns = append(completedRuns, run)
+	}
+	session.CompletedRuns = completedRuns
+	return session, nil
+}
+
+// addRun records a completed run and saves the session
+func (s *detectSession) addRun(run report.Run) error {
+	s.mu.Lock()
+	s.CompletedRuns = append(s.CompletedRuns, run)
+	s.mu.Unlock()
+	return s.save()
+}
+
+// completed reports whether the run with the given number has already completed
+func (s *detectSession) completed(number int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, run := range s.CompletedRuns {
+		if run.Number == number {
+			return true
+		}
+	}
+	return false
+}
+
+// runs returns all completed runs of the session
+func (s *detectSession) runs() []report.Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.CompletedRuns)
+}
+
+// save writes the session to a temp file first, so that being killed mid-write never leaves a corrupt session behind
+func (s *detectSession) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessionBytes, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal detect session: %w", err)
+	}
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, sessionBytes, 0600); err != nil {
+		return fmt.Errorf("failed to write detect session: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to write detect session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+// Package config reads flakeguard's repository configuration file, and applies it to the command line flags.
+// Every setting in the file stands in for a flag, so the file can hold what would otherwise be a long list of flags
+// repeated in every workflow. Flags take precedence over FLAKEGUARD_* env vars, which take precedence over the file.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// FileName is the name of the configuration file flakeguard looks for at the root of the repository
+	FileName = ".flakeguard.yaml"
+	// EnvPrefix is the prefix of the env vars that set flags, e.g. FLAKEGUARD_PARALLEL_RUNS sets --parallel-runs
+	EnvPrefix = "FLAKEGUARD_"
+
+	redacted = "<redacted>"
+)
+
+// Source is where the effective value of a setting came from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFlag    Source = "flag"
+	SourceEnv     Source = "env"
+	SourceFile    Source = "file"
+)
+
+// envReference matches references to env vars in the file, like ${SPLUNK_TOKEN}
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Setting binds a key in the configuration file to a flag
+type Setting struct {
+	// Key is the dotted path of the setting in the file, e.g. "detect.parallel_runs"
+	Key  string
+	Flag string
+	// Secret settings are redacted when printing the configuration. They're best set with env var references, e.g.
+	// token: ${SPLUNK_TOKEN}
+	Secret bool
+}
+
+// EnvVar is the env var that sets the setting's flag
+func (s Setting) EnvVar() string {
+	return EnvVar(s.Flag)
+}
+
+// EnvVar is the env var that sets a flag
+func EnvVar(flag string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// File is a parsed configuration file
+type File struct {
+	Path   string
+	values map[string]fileValue
+}
+
+type fileValue struct {
+	values []string
+	list   bool
+	line   int
+}
+
+// Find looks for the configuration file at the root of the repository dir is in, which is the closest directory
+// holding .git. It returns "" if dir isn't in a repository, or the repository has no configuration file.
+func Find(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			path := filepath.Join(dir, FileName)
+			if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+				return "", nil
+			} else if err != nil {
+				return "", fmt.Errorf("failed to check for %s: %w", path, err)
+			}
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// Load reads and validates the configuration file at path against the known settings.
+// Env var references like ${SPLUNK_TOKEN} in values are replaced with the env var's value.
+func Load(path string, settings []Setting) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return parse(path, data, settings)
+}
+
+func parse(path string, data []byte, settings []Setting) (*File, error) {
+	file := &File{Path: path, values: map[string]fileValue{}}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 { // Empty file
+		return file, nil
+	}
+	if err := file.read(doc.Content[0], "", settings); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// read walks a mapping node of the file, prefix is the dotted path to it
+func (f *File) read(node *yaml.Node, prefix string, settings []Setting) error {
+	if node.Kind != yaml.MappingNode {
+		if prefix == "" {
+			return fmt.Errorf("%s:%d: expected a mapping of settings", f.Path, node.Line)
+		}
+		return fmt.Errorf("%s:%d: %s must be a mapping of settings", f.Path, node.Line, prefix)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		key := keyNode.Value
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		isSetting := slices.ContainsFunc(settings, func(s Setting) bool { return s.Key == key })
+		isSection := slices.ContainsFunc(settings, func(s Setting) bool { return strings.HasPrefix(s.Key, key+".") })
+		switch {
+		case isSection:
+			if err := f.read(valueNode, key, settings); err != nil {
+				return err
+			}
+		case !isSetting:
+			return fmt.Errorf(
+				"%s:%d: unknown setting %q, valid settings are: %s",
+				f.Path, keyNode.Line, key, strings.Join(validKeys(prefix, settings), ", "),
+			)
+		case valueNode.Tag == "!!null":
+			// Leaving a setting empty is the same as leaving it out
+		case valueNode.Kind == yaml.ScalarNode:
+			f.values[key] = fileValue{values: []string{expandEnv(valueNode.Value)}, line: valueNode.Line}
+		case valueNode.Kind == yaml.SequenceNode:
+			value := fileValue{list: true, line: valueNode.Line}
+			for _, item := range valueNode.Content {
+				if item.Kind != yaml.ScalarNode {
+					return fmt.Errorf("%s:%d: %s must be a list of values", f.Path, item.Line, key)
+				}
+				value.values = append(value.values, expandEnv(item.Value))
+			}
+			f.values[key] = value
+		default:
+			return fmt.Errorf("%s:%d: %s must be a value or a list of values", f.Path, valueNode.Line, key)
+		}
+	}
+	return nil
+}
+
+// validKeys lists the settings directly under prefix, to point out typos
+func validKeys(prefix string, settings []Setting) []string {
+	keys := []string{}
+	for _, s := range settings {
+		key := s.Key
+		if prefix != "" {
+			if !strings.HasPrefix(key, prefix+".") {
+				continue
+			}
+			key = strings.TrimPrefix(key, prefix+".")
+		}
+		key, _, _ = strings.Cut(key, ".")
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func expandEnv(value string) string {
+	return envReference.ReplaceAllStringFunc(value, func(ref string) string {
+		return os.Getenv(envReference.FindStringSubmatch(ref)[1])
+	})
+}
+
+// Effective is the value a setting ended up with, and where it came from
+type Effective struct {
+	Setting
+	Value  pflag.Value
+	Source Source
+}
+
+// Apply sets the flags that weren't set on the command line from their env vars, or else from the file.
+// Settings for flags that aren't in flags are skipped. file may be nil if there is no configuration file.
+func Apply(flags *pflag.FlagSet, file *File, settings []Setting, lookupEnv func(string) (string, bool)) ([]Effective, error) {
+	effective := []Effective{}
+	for _, setting := range settings {
+		flag := flags.Lookup(setting.Flag)
+		if flag == nil {
+			continue
+		}
+		source := SourceDefault
+		switch envValue, inEnv := lookupEnv(setting.EnvVar()); {
+		case flag.Changed:
+			source = SourceFlag
+		case inEnv:
+			source = SourceEnv
+			// List flags take one value per line
+			values := []string{envValue}
+			if isList(flag) {
+				values = strings.Split(strings.TrimSpace(envValue), "\n")
+			}
+			for _, v := range values {
+				if err := flags.Set(setting.Flag, v); err != nil {
+					return nil, fmt.Errorf("invalid value %q for %s: %w", v, setting.EnvVar(), err)
+				}
+			}
+		case file != nil:
+			value, inFile := file.values[setting.Key]
+			if !inFile {
+				break
+			}
+			source = SourceFile
+			if value.list && !isList(flag) {
+				return nil, fmt.Errorf("%s:%d: %s must be a single value", file.Path, value.line, setting.Key)
+			}
+			for _, v := range value.values {
+				if err := flags.Set(setting.Flag, v); err != nil {
+					return nil, fmt.Errorf("%s:%d: invalid value %q for %s: %w", file.Path, value.line, v, setting.Key, err)
+				}
+			}
+		}
+		effective = append(effective, Effective{Setting: setting, Value: flag.Value, Source: source})
+	}
+	return effective, nil
+}
+
+func isList(flag *pflag.Flag) bool {
+	_, ok := flag.Value.(pflag.SliceValue)
+	return ok
+}
+
+// Print writes the effective configuration as YAML in the same layout as the configuration file, noting where each
+// value came from. Secrets are redacted.
+func Print(w io.Writer, effective []Effective) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, e := range effective {
+		section := root
+		path := strings.Split(e.Key, ".")
+		for _, name := range path[:len(path)-1] {
+			section = childMapping(section, name)
+		}
+
+		var value *yaml.Node
+		if slice, ok := e.Value.(pflag.SliceValue); ok {
+			value = &yaml.Node{Kind: yaml.SequenceNode}
+			for _, v := range slice.GetSlice() {
+				value.Content = append(value.Content, scalar(e, v))
+			}
+		} else {
+			value = scalar(e, e.Value.String())
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: path[len(path)-1]}
+		comment := string(e.Source)
+		if e.Source == SourceEnv {
+			comment += " " + e.EnvVar()
+		}
+		// Comments on lists end up after their last item, keep them next to the key instead
+		if value.Kind == yaml.SequenceNode {
+			key.LineComment = comment
+		} else {
+			value.LineComment = comment
+		}
+		section.Content = append(section.Content, key, value)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return fmt.Errorf("failed to print config: %w", err)
+	}
+	return encoder.Close()
+}
+
+func childMapping(parent *yaml.Node, name string) *yaml.Node {
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == name {
+			return parent.Content[i+1]
+		}
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode}
+	parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, child)
+	return child
+}
+
+func scalar(e Effective, value string) *yaml.Node {
+	if e.Secret && value != "" {
+		value = redacted
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	// Quote strings that would otherwise read as another type, like "true"
+	if e.Value.Type() == "string" || e.Value.Type() == "stringArray" {
+		node.Tag = "!!str"
+	}
+	return node
+}
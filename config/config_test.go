@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSettings = []Setting{
+	{Key: "runs", Flag: "runs"},
+	{Key: "detect.timeout", Flag: "timeout"},
+	{Key: "detect.matrix", Flag: "matrix"},
+	{Key: "reporters.splunk.token", Flag: "splunk-token", Secret: true},
+}
+
+func testFlags(t *testing.T) *pflag.FlagSet {
+	t.Helper()
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Int("runs", 5, "")
+	flags.Duration("timeout", 0, "")
+	flags.StringArray("matrix", nil, "")
+	flags.String("splunk-token", "", "")
+	return flags
+}
+
+func TestParse(t *testing.T) {
+	t.Setenv("TEST_SPLUNK_TOKEN", "secret")
+
+	file, err := parse("test.yaml", []byte(`
+runs: 10
+detect:
+  timeout:
+  matrix:
+    - -cpu=1|4
+    - TZ=UTC
+reporters:
+  splunk:
+    token: ${TEST_SPLUNK_TOKEN}
+`), testSettings)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]fileValue{
+		"runs":                   {values: []string{"10"}, line: 2},
+		"detect.matrix":          {values: []string{"-cpu=1|4", "TZ=UTC"}, list: true, line: 6},
+		"reporters.splunk.token": {values: []string{"secret"}, line: 10},
+	}, file.values, "empty settings should be left out, and env var references expanded")
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{"unknown setting", "detect:\n  timout: 1m\n", `test.yaml:2: unknown setting "detect.timout", valid settings are: timeout, matrix`},
+		{"unknown section", "detecting:\n  timeout: 1m\n", `test.yaml:1: unknown setting "detecting", valid settings are: runs, detect, reporters`},
+		{"scalar section", "detect: 1m\n", "test.yaml:1: detect must be a mapping of settings"},
+		{"nested list", "detect:\n  matrix:\n    - [a, b]\n", "test.yaml:3: detect.matrix must be a list of values"},
+		{"mapping value", "runs:\n  count: 5\n", "test.yaml:2: runs must be a value or a list of values"},
+		{"not a mapping", "- runs\n", "test.yaml:1: expected a mapping of settings"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := parse("test.yaml", []byte(tc.yaml), testSettings)
+			require.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+
+	file, err := parse("test.yaml", []byte(`
+runs: 10
+detect:
+  timeout: 1m
+  matrix: [-cpu=1|4, TZ=UTC]
+`), testSettings)
+	require.NoError(t, err)
+
+	flags := testFlags(t)
+	require.NoError(t, flags.Parse([]string{"--runs", "3"}))
+	env := map[string]string{"FLAKEGUARD_TIMEOUT": "2m", "FLAKEGUARD_SPLUNK_TOKEN": "secret"}
+	lookupEnv := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	effective, err := Apply(flags, file, testSettings, lookupEnv)
+	require.NoError(t, err)
+	sources := map[string]Source{}
+	for _, e := range effective {
+		sources[e.Key] = e.Source
+	}
+	assert.Equal(t, map[string]Source{
+		"runs":                   SourceFlag,
+		"detect.timeout":         SourceEnv,
+		"detect.matrix":          SourceFile,
+		"reporters.splunk.token": SourceEnv,
+	}, sources)
+
+	runs, err := flags.GetInt("runs")
+	require.NoError(t, err)
+	assert.Equal(t, 3, runs, "flags should take precedence over env vars and the file")
+	timeout, err := flags.GetDuration("timeout")
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, timeout, "env vars should take precedence over the file")
+	matrix, err := flags.GetStringArray("matrix")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-cpu=1|4", "TZ=UTC"}, matrix)
+
+	var out bytes.Buffer
+	require.NoError(t, Print(&out, effective))
+	assert.Equal(t, `runs: 3 # flag
+detect:
+  timeout: 2m0s # env FLAKEGUARD_TIMEOUT
+  matrix: # file
+    - -cpu=1|4
+    - TZ=UTC
+reporters:
+  splunk:
+    token: <redacted> # env FLAKEGUARD_SPLUNK_TOKEN
+`, out.String())
+}
+
+func TestApplyInvalid(t *testing.T) {
+	t.Parallel()
+
+	file, err := parse("test.yaml", []byte("runs: many\n"), testSettings)
+	require.NoError(t, err)
+	_, err = Apply(testFlags(t), file, testSettings, func(string) (string, bool) { return "", false })
+	require.ErrorContains(t, err, `test.yaml:1: invalid value "many" for runs`)
+
+	file, err = parse("test.yaml", []byte("runs: [1, 2]\n"), testSettings)
+	require.NoError(t, err)
+	_, err = Apply(testFlags(t), file, testSettings, func(string) (string, bool) { return "", false })
+	require.EqualError(t, err, "test.yaml:1: runs must be a single value")
+}
+
+func TestFind(t *testing.T) {
+	t.Parallel()
+
+	repo := t.TempDir()
+	nested := filepath.Join(repo, "a", "b")
+	require.NoError(t, os.MkdirAll(nested, 0750))
+	require.NoError(t, os.Mkdir(filepath.Join(repo, ".git"), 0750))
+
+	path, err := Find(nested)
+	require.NoError(t, err)
+	assert.Empty(t, path, "repo without a config file")
+
+	require.NoError(t, os.WriteFile(filepath.Join(repo, FileName), []byte("runs: 1\n"), 0600))
+	path, err = Find(nested)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(repo, FileName), path)
+}
@@ -0,0 +1,30 @@
+//go:build examples
+
+// Package order has a test that only fails after another test pollutes shared state.
+package order
+
+import (
+	"testing"
+)
+
+var cache = map[string]string{}
+
+func TestFirst(t *testing.T) {
+	cache["first"] = "ok"
+}
+
+func TestPolluter(t *testing.T) {
+	cache["config"] = "polluted"
+}
+
+func TestInnocent(t *testing.T) {
+	if cache["first"] != "ok" {
+		t.Log("first was not cached")
+	}
+}
+
+func TestVictim(t *testing.T) {
+	if cache["config"] != "" {
+		t.Fatalf("expected config to be unset, got '%s'", cache["config"])
+	}
+}
@@ -15,6 +15,8 @@ const (
 	CodeGoBuildError = 2
 	// CodeFlakeguardError is the exit code for a flakeguard specific error.
 	CodeFlakeguardError = 3
+	// CodeInterrupted is the exit code when flakeguard is stopped by SIGINT or SIGTERM, following the shell's 128+SIGINT convention.
+	CodeInterrupted = 130
 )
 
 // Error represents an error with a specific exit code
@@ -0,0 +1,201 @@
+// Package filter decides which packages and tests flakeguard looks at, from ignore and focus lists of glob patterns.
+// Ignored packages and tests are left out of detect runs, analysis, reports, and quarantine decisions.
+// If there are focus patterns, everything that doesn't match one is left out as well.
+//
+// Patterns match whole import paths or test names. '*' matches any characters except '/', '?' matches a single one,
+// and '...' matches anything, including '/', like in go package patterns.
+// Test patterns match subtests too, ignoring TestFoo ignores TestFoo/subtest.
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Exclusion is a package or test that was left out, and the rule that left it out
+type Exclusion struct {
+	Package string `json:"package"`
+	// Test is empty if the whole package was left out
+	Test string `json:"test,omitempty"`
+	Rule string `json:"rule"`
+}
+
+func (e Exclusion) String() string {
+	if e.Test == "" {
+		return fmt.Sprintf("%s: %s", e.Package, e.Rule)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Package, e.Test, e.Rule)
+}
+
+// Filter holds the ignore and focus lists. A nil Filter leaves nothing out.
+type Filter struct {
+	ignorePackages []pattern
+	focusPackages  []pattern
+	ignoreTests    []pattern
+	focusTests     []pattern
+}
+
+type pattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// New creates a filter from lists of glob patterns for package import paths and test names
+func New(ignorePackages, focusPackages, ignoreTests, focusTests []string) (*Filter, error) {
+	var (
+		f   Filter
+		err error
+	)
+	if f.ignorePackages, err = compile(ignorePackages); err != nil {
+		return nil, err
+	}
+	if f.focusPackages, err = compile(focusPackages); err != nil {
+		return nil, err
+	}
+	if f.ignoreTests, err = compile(ignoreTests); err != nil {
+		return nil, err
+	}
+	if f.focusTests, err = compile(focusTests); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func compile(globs []string) ([]pattern, error) {
+	patterns := make([]pattern, 0, len(globs))
+	for _, glob := range globs {
+		if glob == "" {
+			return nil, fmt.Errorf("empty filter pattern")
+		}
+		re, err := regexp.Compile("^" + globRegexp(glob) + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter pattern %q: %w", glob, err)
+		}
+		patterns = append(patterns, pattern{glob: glob, re: re})
+	}
+	return patterns, nil
+}
+
+// globRegexp translates a glob pattern to an unanchored regular expression
+func globRegexp(glob string) string {
+	var re strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case glob[i:] == "/...":
+			// Like in go package patterns, x/... matches x itself too
+			re.WriteString("(/.*)?")
+			i += 3
+		case strings.HasPrefix(glob[i:], "..."):
+			re.WriteString(".*")
+			i += 2
+		case glob[i] == '*':
+			re.WriteString("[^/]*")
+		case glob[i] == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return re.String()
+}
+
+// HasPackageRules is true if the filter can leave out whole packages
+func (f *Filter) HasPackageRules() bool {
+	return f != nil && (len(f.ignorePackages) > 0 || len(f.focusPackages) > 0)
+}
+
+// HasTestRules is true if the filter can leave out single tests
+func (f *Filter) HasTestRules() bool {
+	return f != nil && (len(f.ignoreTests) > 0 || len(f.focusTests) > 0)
+}
+
+// Package decides if a package is left out, and returns the exclusion if it is
+func (f *Filter) Package(pkg string) (Exclusion, bool) {
+	if f == nil {
+		return Exclusion{}, false
+	}
+	if p, ok := match(f.ignorePackages, pkg); ok {
+		return Exclusion{Package: pkg, Rule: fmt.Sprintf("ignored by package pattern %q", p.glob)}, true
+	}
+	if _, ok := match(f.focusPackages, pkg); len(f.focusPackages) > 0 && !ok {
+		return Exclusion{Package: pkg, Rule: "not matched by any focus package pattern"}, true
+	}
+	return Exclusion{}, false
+}
+
+// Test decides if a test is left out, either on its own or because of its package, and returns the exclusion if it is
+func (f *Filter) Test(pkg, test string) (Exclusion, bool) {
+	if f == nil {
+		return Exclusion{}, false
+	}
+	if exclusion, excluded := f.Package(pkg); excluded {
+		exclusion.Test = test
+		return exclusion, true
+	}
+	if p, ok := matchTest(f.ignoreTests, test); ok {
+		return Exclusion{Package: pkg, Test: test, Rule: fmt.Sprintf("ignored by test pattern %q", p.glob)}, true
+	}
+	if _, ok := matchTest(f.focusTests, test); len(f.focusTests) > 0 && !ok {
+		return Exclusion{Package: pkg, Test: test, Rule: "not matched by any focus test pattern"}, true
+	}
+	return Exclusion{}, false
+}
+
+// SkipPattern is a go test -skip pattern that skips the ignored top-level tests, or "" if there are none.
+// Patterns for subtests can't be combined into one -skip pattern, they're left to Test.
+func (f *Filter) SkipPattern() string {
+	if f == nil {
+		return ""
+	}
+	return topLevelPattern(f.ignoreTests)
+}
+
+// RunPattern is a go test -run pattern that only runs the focused top-level tests, or "" if there are none.
+// It's only set if every focus test pattern is for top-level tests, as they can't be combined into one -run pattern
+// otherwise.
+func (f *Filter) RunPattern() string {
+	if f == nil {
+		return ""
+	}
+	for _, p := range f.focusTests {
+		if strings.Contains(p.glob, "/") {
+			return ""
+		}
+	}
+	return topLevelPattern(f.focusTests)
+}
+
+func topLevelPattern(patterns []pattern) string {
+	res := []string{}
+	for _, p := range patterns {
+		if !strings.Contains(p.glob, "/") {
+			res = append(res, globRegexp(p.glob))
+		}
+	}
+	if len(res) == 0 {
+		return ""
+	}
+	return "^(" + strings.Join(res, "|") + ")$"
+}
+
+func match(patterns []pattern, s string) (pattern, bool) {
+	for _, p := range patterns {
+		if p.re.MatchString(s) {
+			return p, true
+		}
+	}
+	return pattern{}, false
+}
+
+// matchTest matches a test, or any of the tests it's a subtest of
+func matchTest(patterns []pattern, test string) (pattern, bool) {
+	for i := range test {
+		if test[i] == '/' {
+			if p, ok := match(patterns, test[:i]); ok {
+				return p, true
+			}
+		}
+	}
+	return match(patterns, test)
+}
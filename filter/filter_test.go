@@ -0,0 +1,77 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+
+	f, err := New(
+		[]string{"github.com/org/repo/e2e/..."},
+		[]string{"github.com/org/repo/..."},
+		[]string{"TestKnownBad*", "TestTable/slow_*"},
+		nil,
+	)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		pkg, test string
+		excluded  bool
+		rule      string
+	}{
+		{pkg: "github.com/org/repo/pkg", test: "TestGood"},
+		{pkg: "github.com/org/repo/e2e", test: "TestGood", excluded: true, rule: `ignored by package pattern "github.com/org/repo/e2e/..."`},
+		{pkg: "github.com/org/repo/e2e/smoke", test: "TestGood", excluded: true, rule: `ignored by package pattern "github.com/org/repo/e2e/..."`},
+		{pkg: "github.com/org/other", test: "TestGood", excluded: true, rule: "not matched by any focus package pattern"},
+		{pkg: "github.com/org/repo/pkg", test: "TestKnownBadThing", excluded: true, rule: `ignored by test pattern "TestKnownBad*"`},
+		{pkg: "github.com/org/repo/pkg", test: "TestKnownBadThing/subtest", excluded: true, rule: `ignored by test pattern "TestKnownBad*"`},
+		{pkg: "github.com/org/repo/pkg", test: "TestTable/slow_case", excluded: true, rule: `ignored by test pattern "TestTable/slow_*"`},
+		{pkg: "github.com/org/repo/pkg", test: "TestTable/fast_case"},
+		{pkg: "github.com/org/repo/pkg", test: "TestTable"},
+	}
+	for _, tc := range testCases {
+		exclusion, excluded := f.Test(tc.pkg, tc.test)
+		assert.Equal(t, tc.excluded, excluded, "%s %s", tc.pkg, tc.test)
+		assert.Equal(t, tc.rule, exclusion.Rule, "%s %s", tc.pkg, tc.test)
+	}
+
+	assert.Equal(t, "^(TestKnownBad[^/]*)$", f.SkipPattern(), "subtest patterns can't be part of -skip")
+	assert.Empty(t, f.RunPattern())
+}
+
+func TestFilterFocusTests(t *testing.T) {
+	t.Parallel()
+
+	f, err := New(nil, nil, nil, []string{"TestA", "TestB?"})
+	require.NoError(t, err)
+	assert.False(t, f.HasPackageRules())
+	assert.True(t, f.HasTestRules())
+
+	_, excluded := f.Test("pkg", "TestA/sub")
+	assert.False(t, excluded, "subtests of focused tests should be kept")
+	_, excluded = f.Test("pkg", "TestB1")
+	assert.False(t, excluded)
+	exclusion, excluded := f.Test("pkg", "TestC")
+	assert.True(t, excluded)
+	assert.Equal(t, "pkg TestC: not matched by any focus test pattern", exclusion.String())
+	assert.Equal(t, "^(TestA|TestB[^/])$", f.RunPattern())
+
+	f, err = New(nil, nil, nil, []string{"TestA/sub"})
+	require.NoError(t, err)
+	assert.Empty(t, f.RunPattern(), "subtest patterns can't be part of -run")
+}
+
+func TestNilFilter(t *testing.T) {
+	t.Parallel()
+
+	var f *Filter
+	_, excluded := f.Test("pkg", "TestA")
+	assert.False(t, excluded)
+	assert.False(t, f.HasPackageRules())
+	assert.False(t, f.HasTestRules())
+	assert.Empty(t, f.SkipPattern())
+}
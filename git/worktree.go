@@ -0,0 +1,210 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/rs/zerolog"
+)
+
+// Commit is a commit in the history of a repository
+type Commit struct {
+	Hash    string `json:"hash"`
+	Subject string `json:"subject"`
+}
+
+// ShortHash is the abbreviated hash of the commit
+func (c Commit) ShortHash() string {
+	if len(c.Hash) < 12 {
+		return c.Hash
+	}
+	return c.Hash[:12]
+}
+
+func (c Commit) String() string {
+	return fmt.Sprintf("%s %s", c.ShortHash(), c.Subject)
+}
+
+// Commits returns the first-parent history from the good revision to the bad one, both included, oldest first.
+// The good revision must be a first-parent ancestor of the bad one, like a commit further down the main branch.
+func Commits(repoPath, good, bad string) ([]Commit, error) {
+	repo, err := openRepo(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	goodHash, err := repo.ResolveRevision(plumbing.Revision(good))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve good revision '%s': %w", good, err)
+	}
+	badHash, err := repo.ResolveRevision(plumbing.Revision(bad))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve bad revision '%s': %w", bad, err)
+	}
+
+	commits := []Commit{}
+	commit, err := repo.CommitObject(*badHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", badHash, err)
+	}
+	for {
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		commits = append(commits, Commit{Hash: commit.Hash.String(), Subject: subject})
+		if commit.Hash == *goodHash {
+			break
+		}
+		if commit.NumParents() == 0 {
+			return nil, fmt.Errorf("good revision '%s' is not a first-parent ancestor of bad revision '%s'", good, bad)
+		}
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read parent of commit %s: %w", commit.Hash, err)
+		}
+		commit = parent
+	}
+
+	// Walked from bad to good, flip to oldest first
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+	return commits, nil
+}
+
+// Worktree is a temporary directory commits of a repository are checked out into.
+// Checking out only writes the commit's files, the repository's own worktree, index, and HEAD are left alone.
+type Worktree struct {
+	l    zerolog.Logger
+	repo *git.Repository
+	// root is the root of the repository's own worktree
+	root string
+	dir  string
+}
+
+// NewWorktree creates a temporary worktree for the repository containing repoPath
+func NewWorktree(l zerolog.Logger, repoPath string) (*Worktree, error) {
+	repo, err := openRepo(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read worktree of %s: %w", repoPath, err)
+	}
+	dir, err := os.MkdirTemp("", "flakeguard-worktree-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary worktree: %w", err)
+	}
+	return &Worktree{
+		l:    l.With().Str("worktree", dir).Logger(),
+		repo: repo,
+		root: wt.Filesystem.Root(),
+		dir:  dir,
+	}, nil
+}
+
+// Dir is where commits are checked out
+func (w *Worktree) Dir() string {
+	return w.dir
+}
+
+// Path maps a path in the repository's own worktree to the same path in the temporary worktree
+func (w *Worktree) Path(path string) (string, error) {
+	rel, err := relativeTo(w.root, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(w.dir, rel), nil
+}
+
+// Checkout replaces the contents of the worktree with the files of the commit.
+// Submodules are left out.
+func (w *Worktree) Checkout(hash string) error {
+	commit, err := w.repo.CommitObject(plumbing.NewHash(hash))
+	if err != nil {
+		return fmt.Errorf("failed to read commit %s: %w", hash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to read tree of commit %s: %w", hash, err)
+	}
+
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read worktree: %w", err)
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(w.dir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to clear worktree: %w", err)
+		}
+	}
+
+	files := 0
+	err = tree.Files().ForEach(func(file *object.File) error {
+		files++
+		return w.writeFile(file)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check out commit %s: %w", hash, err)
+	}
+	w.l.Debug().Str("commit", hash).Int("files", files).Msg("Checked out commit")
+	return nil
+}
+
+func (w *Worktree) writeFile(file *object.File) error {
+	path := filepath.Join(w.dir, filepath.FromSlash(file.Name))
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+
+	reader, err := file.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if file.Mode == filemode.Symlink {
+		target, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(string(target), path)
+	}
+
+	perm := os.FileMode(0644)
+	if file.Mode == filemode.Executable {
+		perm = 0755
+	}
+	//nolint:gosec // G304: the path comes from the repository's own tree
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, reader); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Close removes the worktree
+func (w *Worktree) Close() error {
+	return os.RemoveAll(w.dir)
+}
+
+// openRepo opens the repository containing path
+func openRepo(path string) (*git.Repository, error) {
+	repo, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, fmt.Errorf("%s is not in a git repository", path)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open git repository at %s: %w", path, err)
+	}
+	return repo, nil
+}
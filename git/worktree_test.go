@@ -0,0 +1,95 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/flakeguard/internal/testhelpers"
+)
+
+// commitFiles writes files to the repository's worktree and commits them, returning the commit's hash
+func commitFiles(t *testing.T, repo *git.Repository, message string, files map[string]string) string {
+	t.Helper()
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+	for name, content := range files {
+		path := filepath.Join(wt.Filesystem.Root(), name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0750))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		_, err := wt.Add(name)
+		require.NoError(t, err)
+	}
+	hash, err := wt.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+	return hash.String()
+}
+
+func TestWorktree(t *testing.T) {
+	t.Parallel()
+
+	repoDir := t.TempDir()
+	repo, err := git.PlainInit(repoDir, false)
+	require.NoError(t, err)
+	first := commitFiles(t, repo, "First\n\nWith a body", map[string]string{"go.mod": "module test\n", "pkg/a.go": "package pkg\n"})
+	second := commitFiles(t, repo, "Second", map[string]string{"pkg/a.go": "package pkg // changed\n"})
+	third := commitFiles(t, repo, "Third", map[string]string{"pkg/b.go": "package pkg\n"})
+
+	commits, err := Commits(filepath.Join(repoDir, "pkg"), first, "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, []Commit{
+		{Hash: first, Subject: "First"},
+		{Hash: second, Subject: "Second"},
+		{Hash: third, Subject: "Third"},
+	}, commits)
+	_, err = Commits(repoDir, third, first)
+	require.Error(t, err, "good revision after the bad one")
+
+	wt, err := NewWorktree(testhelpers.Logger(t), repoDir)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, wt.Close()) })
+
+	require.NoError(t, wt.Checkout(third))
+	pkgDir, err := wt.Path(filepath.Join(repoDir, "pkg"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(wt.Dir(), "pkg"), pkgDir)
+	assert.FileExists(t, filepath.Join(pkgDir, "b.go"))
+
+	require.NoError(t, wt.Checkout(first))
+	content, err := os.ReadFile(filepath.Join(pkgDir, "a.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "package pkg\n", string(content))
+	assert.NoFileExists(t, filepath.Join(pkgDir, "b.go"), "files of other commits should be removed")
+
+	head, err := repo.Head()
+	require.NoError(t, err)
+	assert.Equal(t, third, head.Hash().String(), "the repository's HEAD should be left alone")
+
+	_, err = wt.Path(t.TempDir())
+	require.Error(t, err, "path outside of the repository")
+
+	_, err = DefaultBranch(repoDir)
+	require.Error(t, err, "no remote")
+	_, err = repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"https://github.com/owner/repo.git"}})
+	require.NoError(t, err)
+	require.NoError(t, repo.Storer.SetReference(plumbing.NewSymbolicReference(
+		plumbing.NewRemoteHEADReferenceName("origin"), plumbing.NewRemoteReferenceName("origin", "trunk"),
+	)))
+	defaultBranch, err := DefaultBranch(repoDir)
+	require.NoError(t, err)
+	assert.Equal(t, "trunk", defaultBranch)
+
+	rel, err := RelativePath(filepath.Join(repoDir, "pkg", "a.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "pkg/a.go", rel)
+}
@@ -0,0 +1,184 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/rs/zerolog"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// appJWTLifetime is how long the JWTs authenticating as the app are valid. GitHub accepts at most 10 minutes.
+	appJWTLifetime = 9 * time.Minute
+	// appJWTClockSkew backdates JWTs, in case our clock is ahead of GitHub's
+	appJWTClockSkew = time.Minute
+	// installationTokenRefresh is how long before they expire installation tokens are replaced, so a request never
+	// goes out with a token that expires on the way
+	installationTokenRefresh = 5 * time.Minute
+)
+
+// AppAuth authenticates as a GitHub App installation, whose tokens can do things GITHUB_TOKEN can't, like opening
+// pull requests that trigger workflows
+type AppAuth struct {
+	// AppID is the ID of the GitHub App, not its client ID
+	AppID int64
+	// PrivateKey is a PEM encoded private key of the app
+	PrivateKey []byte
+	// InstallationID is the app's installation to get tokens for. If it's 0, the installation on Owner/Repo is used.
+	InstallationID int64
+	Owner          string
+	Repo           string
+}
+
+// WithAppAuth authenticates as a GitHub App installation instead of with a token. Installation tokens are fetched
+// when first needed, and replaced before they expire.
+func WithAppAuth(app AppAuth) ClientOption {
+	return func(o *clientOptions) {
+		o.app = &app
+	}
+}
+
+// appTokenSource exchanges JWTs signed with the app's private key for installation tokens
+type appTokenSource struct {
+	l              zerolog.Logger
+	appClient      *github.Client
+	installationID int64
+	owner          string
+	repo           string
+}
+
+// newAppTokenSource creates a token source for the app's installation. API requests to get installation tokens are
+// sent through next, to the enterprise API if restURL is set.
+func newAppTokenSource(l zerolog.Logger, app AppAuth, next http.RoundTripper, restURL string) (oauth2.TokenSource, error) {
+	if app.AppID == 0 {
+		return nil, errors.New("GitHub App ID must be set to authenticate as an app")
+	}
+	if app.InstallationID == 0 && (app.Owner == "" || app.Repo == "") {
+		return nil, errors.New("GitHub App installation ID, or the repository it's installed on, must be set")
+	}
+	key, err := parsePrivateKey(app.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	appClient := github.NewClient(&http.Client{
+		Transport: &appTransport{appID: app.AppID, key: key, next: next},
+	})
+	if restURL != "" {
+		appClient, err = appClient.WithEnterpriseURLs(restURL, restURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GitHub API URL '%s': %w", restURL, err)
+		}
+	}
+	src := &appTokenSource{
+		l:              l.With().Int64("app_id", app.AppID).Logger(),
+		appClient:      appClient,
+		installationID: app.InstallationID,
+		owner:          app.Owner,
+		repo:           app.Repo,
+	}
+	return oauth2.ReuseTokenSourceWithExpiry(nil, src, installationTokenRefresh), nil
+}
+
+// Token creates a new installation token
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	ctx := context.Background()
+	if s.installationID == 0 {
+		installation, _, err := s.appClient.Apps.FindRepositoryInstallation(ctx, s.owner, s.repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find GitHub App installation on %s/%s: %w", s.owner, s.repo, err)
+		}
+		s.installationID = installation.GetID()
+	}
+	token, _, err := s.appClient.Apps.CreateInstallationToken(ctx, s.installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token for GitHub App installation %d: %w", s.installationID, err)
+	}
+	s.l.Debug().
+		Int64("installation_id", s.installationID).
+		Time("expires_at", token.GetExpiresAt().Time).
+		Msg("Created GitHub App installation token")
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		TokenType:   "Bearer",
+		Expiry:      token.GetExpiresAt().Time,
+	}, nil
+}
+
+// appTransport authenticates requests as the app itself, with a freshly signed JWT
+type appTransport struct {
+	appID int64
+	key   *rsa.PrivateKey
+	next  http.RoundTripper
+}
+
+func (t *appTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	jwt, err := appJWT(t.appID, t.key, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
+}
+
+// appJWT signs a JWT authenticating as the app with RS256
+// https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/generating-a-json-web-token-jwt-for-a-github-app
+func appJWT(appID int64, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-appJWTClockSkew).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": strconv.FormatInt(appID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parsePrivateKey parses an app's private key, in the PKCS #1 format GitHub generates, or PKCS #8
+func parsePrivateKey(pemKey []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("no PEM encoded GitHub App private key found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("GitHub App private key isn't an RSA key")
+	}
+	return rsaKey, nil
+}
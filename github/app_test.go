@@ -0,0 +1,157 @@
+package github
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/flakeguard/internal/testhelpers"
+)
+
+func TestAppAuth(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	var (
+		mu       sync.Mutex
+		tokens   int
+		requests []string
+	)
+	// verifyJWT checks that requests as the app carry a JWT signed by its key
+	verifyJWT := func(r *http.Request) {
+		jwt, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		require.True(t, ok, "app requests should have a bearer JWT")
+		parts := strings.Split(jwt, ".")
+		require.Len(t, parts, 3)
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		require.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature), "JWT should be signed with the app's key")
+		claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+		var claims struct {
+			Iss string
+			Iat int64
+			Exp int64
+		}
+		require.NoError(t, json.Unmarshal(claimsJSON, &claims))
+		assert.Equal(t, "1234", claims.Iss)
+		assert.LessOrEqual(t, claims.Exp-claims.Iat, int64(10*time.Minute/time.Second), "GitHub refuses JWTs valid for over 10 minutes")
+	}
+
+	fake := newFakeGitHub()
+	fake.mux.HandleFunc("GET /repos/owner/repo/installation", func(w http.ResponseWriter, r *http.Request) {
+		verifyJWT(r)
+		writeJSON(t, w, http.StatusOK, github.Installation{ID: github.Ptr(int64(42))})
+	})
+	createToken := func(w http.ResponseWriter, r *http.Request) {
+		verifyJWT(r)
+		mu.Lock()
+		defer mu.Unlock()
+		tokens++
+		// The first token expires within the refresh window, so it's replaced on the next request
+		expiresAt := time.Now().Add(time.Minute)
+		if tokens > 1 {
+			expiresAt = time.Now().Add(time.Hour)
+		}
+		writeJSON(t, w, http.StatusCreated, github.InstallationToken{
+			Token:     github.Ptr(fmt.Sprintf("ghs_%d", tokens)),
+			ExpiresAt: &github.Timestamp{Time: expiresAt},
+		})
+	}
+	fake.mux.HandleFunc("POST /app/installations/42/access_tokens", createToken)
+	fake.mux.HandleFunc("POST github.example.com/api/v3/app/installations/42/access_tokens", createToken)
+	fake.mux.HandleFunc("GET /repos/owner/repo", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.Header.Get("Authorization"))
+		writeJSON(t, w, http.StatusOK, github.Repository{DefaultBranch: github.Ptr("main")})
+	})
+
+	client, err := NewClient(testhelpers.Logger(t), "ignored-token", fake, WithAppAuth(AppAuth{
+		AppID:      1234,
+		PrivateKey: keyPEM,
+		Owner:      "owner",
+		Repo:       "repo",
+	}))
+	require.NoError(t, err)
+	assert.Empty(t, client.token, "app auth should replace the token")
+
+	for range 3 {
+		_, err := RepoInfo(t.Context(), client, "owner", "repo")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"Bearer ghs_1", "Bearer ghs_2", "Bearer ghs_2"}, requests,
+		"tokens should be refreshed before they expire, and reused until then")
+	assert.Equal(t, 2, tokens)
+
+	// GraphQL shares the installation tokens, which are created through the enterprise API
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer ghs_3", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"data":{"viewer":{"login":"flakeguard[bot]"}}}`))
+	}))
+	t.Cleanup(server.Close)
+	client, err = NewClient(testhelpers.Logger(t), "", fake,
+		WithEnterpriseURLs("https://github.example.com/api/v3", server.URL+"/api/graphql"),
+		WithAppAuth(AppAuth{AppID: 1234, PrivateKey: keyPEM, InstallationID: 42}),
+	)
+	require.NoError(t, err)
+	var query struct {
+		Viewer struct {
+			Login string
+		}
+	}
+	require.NoError(t, client.GraphQL.Query(t.Context(), &query, nil))
+	assert.Equal(t, "flakeguard[bot]", query.Viewer.Login)
+}
+
+func TestAppAuthErrors(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+
+	tests := []struct {
+		name    string
+		app     AppAuth
+		wantErr bool
+	}{
+		{name: "PKCS #8 key", app: AppAuth{AppID: 1, PrivateKey: keyPEM, InstallationID: 2}},
+		{name: "no app ID", app: AppAuth{PrivateKey: keyPEM, InstallationID: 2}, wantErr: true},
+		{name: "no installation", app: AppAuth{AppID: 1, PrivateKey: keyPEM}, wantErr: true},
+		{name: "not PEM", app: AppAuth{AppID: 1, PrivateKey: []byte("key"), InstallationID: 2}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := NewClient(testhelpers.Logger(t), "", nil, WithAppAuth(tt.app))
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package github
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/rs/zerolog"
+
+	"github.com/smartcontractkit/flakeguard/history"
+	"github.com/smartcontractkit/flakeguard/report"
+)
+
+const (
+	// DefaultReportArtifact is the name flakeguard's output is expected to be uploaded as. Jobs that run flakeguard
+	// more than once per workflow can add a suffix, like flakeguard-report-integration.
+	DefaultReportArtifact = "flakeguard-report"
+	// maxArtifactRedirects is how many redirects of the artifact download endpoint are followed, like for renamed repos
+	maxArtifactRedirects = 3
+)
+
+// ArtifactHistory fetches the history of test results from the reports detect sessions in GitHub Actions uploaded as
+// artifacts, so teams without Splunk can still judge tests by their history. Downloaded reports are cached, as
+// artifacts never change.
+type ArtifactHistory struct {
+	l            zerolog.Logger
+	client       *Client
+	owner        string
+	repo         string
+	artifactName string
+	cacheDir     string
+}
+
+var _ history.Provider = (*ArtifactHistory)(nil)
+
+// NewArtifactHistory creates a history provider reading the reports uploaded as artifactName by workflow runs of
+// owner/repo, caching them in cacheDir
+func NewArtifactHistory(l zerolog.Logger, client *Client, owner, repo, artifactName, cacheDir string) (*ArtifactHistory, error) {
+	if owner == "" || repo == "" || artifactName == "" {
+		return nil, fmt.Errorf("repository and artifact name must be set to fetch history from GitHub Actions")
+	}
+	if err := os.MkdirAll(cacheDir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create artifact cache directory: %w", err)
+	}
+	return &ArtifactHistory{
+		l:            l.With().Str("history_provider", "github").Logger(),
+		client:       client,
+		owner:        owner,
+		repo:         repo,
+		artifactName: artifactName,
+		cacheDir:     cacheDir,
+	}, nil
+}
+
+// FlakeRates adds up the results in the reports of workflow runs matching the query
+func (a *ArtifactHistory) FlakeRates(ctx context.Context, q history.Query) ([]history.Stats, error) {
+	entries, err := a.Entries(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return history.FlakeRates(entries), nil
+}
+
+// Entries reads the results of every report uploaded by completed workflow runs on the query's branch, or the default
+// branch if it doesn't have one, oldest first. Each report is a session, recorded when its artifact was uploaded.
+func (a *ArtifactHistory) Entries(ctx context.Context, q history.Query) ([]history.Entry, error) {
+	branch := q.Branch
+	if branch == "" {
+		repo, err := RepoInfo(ctx, a.client, a.owner, a.repo)
+		if err != nil {
+			return nil, err
+		}
+		branch = repo.GetDefaultBranch()
+	}
+	opts := &github.ListWorkflowRunsOptions{
+		Branch:      branch,
+		Status:      "completed",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	if !q.Since.IsZero() {
+		opts.Created = ">=" + q.Since.UTC().Format(time.RFC3339)
+	}
+	start := time.Now()
+
+	var (
+		entries  []history.Entry
+		sessions int
+		runCount int
+	)
+	// Runs are listed newest first, so the last sessions are found first
+	for q.LastSessions == 0 || sessions < q.LastSessions {
+		runs, resp, err := a.client.Rest.Actions.ListRepositoryWorkflowRuns(ctx, a.owner, a.repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workflow runs on %s: %w", branch, err)
+		}
+		for _, run := range runs.WorkflowRuns {
+			runCount++
+			runEntries, runSessions, err := a.runEntries(ctx, run)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, runEntries...)
+			sessions += runSessions
+			if q.LastSessions > 0 && sessions >= q.LastSessions {
+				break
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.ListOptions.Page = resp.NextPage
+	}
+	slices.SortStableFunc(entries, func(x, y history.Entry) int { return x.Recorded.Compare(y.Recorded) })
+	a.l.Debug().
+		Str("branch", branch).
+		Int("workflow_runs", runCount).
+		Int("sessions", sessions).
+		Str("duration", time.Since(start).String()).
+		Msg("Read history from GitHub Actions artifacts")
+	return entries, nil
+}
+
+// runEntries reads the reports a workflow run uploaded, returning their results and how many reports there were
+func (a *ArtifactHistory) runEntries(ctx context.Context, run *github.WorkflowRun) ([]history.Entry, int, error) {
+	var (
+		entries  []history.Entry
+		sessions int
+		opts     = &github.ListOptions{PerPage: 100}
+	)
+	for {
+		artifacts, resp, err := a.client.Rest.Actions.ListWorkflowRunArtifacts(ctx, a.owner, a.repo, run.GetID(), opts)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to list artifacts of workflow run %d: %w", run.GetID(), err)
+		}
+		for _, artifact := range artifacts.Artifacts {
+			if artifact.GetExpired() || !strings.HasPrefix(artifact.GetName(), a.artifactName) {
+				continue
+			}
+			results, err := a.report(ctx, artifact)
+			if errors.Is(err, errNoReport) {
+				a.l.Debug().Int64("artifact_id", artifact.GetID()).Str("artifact", artifact.GetName()).Msg("Artifact has no report")
+				continue
+			} else if err != nil {
+				return nil, 0, err
+			}
+			sessions++
+			for _, result := range results {
+				// Older reports were made on a detached HEAD, the run knows which branch it was on
+				result.TestRunInfo.HeadBranch = run.GetHeadBranch()
+				result.Outputs = nil
+				result.Durations = nil
+				entries = append(entries, history.Entry{Recorded: artifact.GetCreatedAt().Time, Result: *result})
+			}
+		}
+		if resp.NextPage == 0 {
+			return entries, sessions, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// errNoReport is returned for artifacts without a JSON report in them
+var errNoReport = errors.New("no report in artifact")
+
+// report reads the results of the report in an artifact, from the cache if it was downloaded before
+func (a *ArtifactHistory) report(ctx context.Context, artifact *github.Artifact) ([]*report.TestResult, error) {
+	cached := filepath.Join(a.cacheDir, strconv.FormatInt(artifact.GetID(), 10)+".json")
+	//nolint:gosec // G304: the path is made of the cache dir and an artifact ID
+	content, err := os.ReadFile(cached)
+	if errors.Is(err, os.ErrNotExist) {
+		content, err = a.download(ctx, artifact)
+		if err != nil {
+			return nil, err
+		}
+		// Write the cache atomically, so a cancelled download doesn't leave half a report behind
+		if err := os.WriteFile(cached+".tmp", content, 0600); err != nil {
+			return nil, fmt.Errorf("failed to cache artifact %d: %w", artifact.GetID(), err)
+		}
+		if err := os.Rename(cached+".tmp", cached); err != nil {
+			return nil, fmt.Errorf("failed to cache artifact %d: %w", artifact.GetID(), err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read cached artifact %d: %w", artifact.GetID(), err)
+	}
+	if len(content) == 0 {
+		return nil, errNoReport
+	}
+
+	var jsonReport struct {
+		Results []*report.TestResult `json:"results"`
+	}
+	if err := json.Unmarshal(content, &jsonReport); err != nil {
+		return nil, fmt.Errorf("failed to parse report of artifact %d: %w", artifact.GetID(), err)
+	}
+	return jsonReport.Results, nil
+}
+
+// download downloads an artifact and returns the report in it. Artifacts without a report return an empty report, so
+// they're cached and not downloaded again.
+func (a *ArtifactHistory) download(ctx context.Context, artifact *github.Artifact) ([]byte, error) {
+	a.l.Debug().Int64("artifact_id", artifact.GetID()).Str("artifact", artifact.GetName()).Msg("Downloading artifact")
+	location, _, err := a.client.Rest.Actions.DownloadArtifact(ctx, a.owner, a.repo, artifact.GetID(), maxArtifactRedirects)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get download URL of artifact %d: %w", artifact.GetID(), err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.client.download.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download artifact %d: %w", artifact.GetID(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download artifact %d: %s", artifact.GetID(), resp.Status)
+	}
+	archive, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download artifact %d: %w", artifact.GetID(), err)
+	}
+
+	zipReader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unzip artifact %d: %w", artifact.GetID(), err)
+	}
+	for _, file := range zipReader.File {
+		if path.Base(file.Name) != report.DefaultJSONFile {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to unzip %s from artifact %d: %w", file.Name, artifact.GetID(), err)
+		}
+		defer reader.Close()
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unzip %s from artifact %d: %w", file.Name, artifact.GetID(), err)
+		}
+		return content, nil
+	}
+	return []byte{}, nil
+}
@@ -0,0 +1,125 @@
+package github
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/flakeguard/history"
+	"github.com/smartcontractkit/flakeguard/internal/testhelpers"
+	"github.com/smartcontractkit/flakeguard/report"
+)
+
+// reportArtifact zips a flakeguard report with the results, the way upload-artifact would upload the output dir
+func reportArtifact(t *testing.T, results ...report.TestResult) []byte {
+	t.Helper()
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	file, err := writer.Create("flakeguard-output/" + report.DefaultJSONFile)
+	require.NoError(t, err)
+	require.NoError(t, json.NewEncoder(file).Encode(map[string]any{"results": results}))
+	require.NoError(t, writer.Close())
+	return archive.Bytes()
+}
+
+func TestArtifactHistory(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	flaky := func(runs, failures int) report.TestResult {
+		return report.TestResult{
+			Package:     "pkg",
+			Name:        "TestFlaky",
+			Runs:        runs,
+			Failures:    failures,
+			Successes:   runs - failures,
+			TestRunInfo: report.TestRunInfo{HeadBranch: "HEAD"},
+		}
+	}
+	artifacts := map[int64]*github.Artifact{
+		1: {ID: github.Ptr(int64(1)), Name: github.Ptr("flakeguard-report"), CreatedAt: &github.Timestamp{Time: now.Add(-2 * time.Hour)}},
+		2: {ID: github.Ptr(int64(2)), Name: github.Ptr("flakeguard-report-integration"), CreatedAt: &github.Timestamp{Time: now.Add(-2 * time.Hour)}},
+		3: {ID: github.Ptr(int64(3)), Name: github.Ptr("coverage"), CreatedAt: &github.Timestamp{Time: now.Add(-2 * time.Hour)}},
+		4: {ID: github.Ptr(int64(4)), Name: github.Ptr("flakeguard-report"), CreatedAt: &github.Timestamp{Time: now.Add(-time.Hour)}},
+		5: {ID: github.Ptr(int64(5)), Name: github.Ptr("flakeguard-report"), Expired: github.Ptr(true)},
+	}
+	zips := map[int64][]byte{
+		1: reportArtifact(t, flaky(10, 1)),
+		2: reportArtifact(t, flaky(10, 0)),
+		4: reportArtifact(t, flaky(10, 2)),
+	}
+	runArtifacts := map[string][]int64{"100": {1, 2, 3}, "101": {4, 5}}
+
+	fake := newFakeGitHub()
+	var downloads atomic.Int32
+	fake.mux.HandleFunc("GET /repos/owner/repo", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, http.StatusOK, github.Repository{DefaultBranch: github.Ptr("main")})
+	})
+	fake.mux.HandleFunc("GET /repos/owner/repo/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "main", r.URL.Query().Get("branch"))
+		assert.Equal(t, "completed", r.URL.Query().Get("status"))
+		writeJSON(t, w, http.StatusOK, github.WorkflowRuns{WorkflowRuns: []*github.WorkflowRun{
+			{ID: github.Ptr(int64(101)), HeadBranch: github.Ptr("main")},
+			{ID: github.Ptr(int64(100)), HeadBranch: github.Ptr("main")},
+		}})
+	})
+	fake.mux.HandleFunc("GET /repos/owner/repo/actions/runs/{id}/artifacts", func(w http.ResponseWriter, r *http.Request) {
+		list := github.ArtifactList{}
+		for _, id := range runArtifacts[r.PathValue("id")] {
+			list.Artifacts = append(list.Artifacts, artifacts[id])
+		}
+		writeJSON(t, w, http.StatusOK, list)
+	})
+	fake.mux.HandleFunc("GET /repos/owner/repo/actions/artifacts/{id}/zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "https://blob.example.com/artifacts/"+r.PathValue("id")+".zip?sig=signed")
+		w.WriteHeader(http.StatusFound)
+	})
+	fake.mux.HandleFunc("GET blob.example.com/artifacts/{file}", func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"), "token shouldn't be sent to pre-signed URLs")
+		downloads.Add(1)
+		id, _ := strconv.ParseInt(r.PathValue("file")[:len(r.PathValue("file"))-len(".zip")], 10, 64)
+		_, _ = w.Write(zips[id])
+	})
+	client := fake.client(t)
+	ctx := context.Background()
+
+	cacheDir := t.TempDir()
+	provider, err := NewArtifactHistory(testhelpers.Logger(t), client, "owner", "repo", DefaultReportArtifact, cacheDir)
+	require.NoError(t, err)
+	stats, err := provider.FlakeRates(ctx, history.Query{Since: now.Add(-24 * time.Hour)})
+	require.NoError(t, err)
+	require.Equal(t, []history.Stats{{
+		Package:     "pkg",
+		Test:        "TestFlaky",
+		Branch:      "main",
+		Sessions:    3,
+		Runs:        30,
+		Failures:    3,
+		LastFailure: now.Add(-time.Hour),
+	}}, stats)
+	assert.EqualValues(t, 3, downloads.Load(), "only reports that haven't expired should be downloaded")
+	assert.FileExists(t, filepath.Join(cacheDir, "4.json"))
+
+	entries, err := provider.Entries(ctx, history.Query{Branch: "main", LastSessions: 1})
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "only the newest run should be read")
+	assert.Equal(t, 2, entries[0].Result.Failures)
+	assert.EqualValues(t, 3, downloads.Load(), "reports should be read from the cache")
+
+	require.NoError(t, os.Remove(filepath.Join(cacheDir, "4.json")))
+	_, err = provider.Entries(ctx, history.Query{Branch: "main", LastSessions: 1})
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, downloads.Load())
+}
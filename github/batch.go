@@ -0,0 +1,110 @@
+package github
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v72/github"
+)
+
+// ReadFunc reads a file of the repository, by path relative to its root
+type ReadFunc func(path string) ([]byte, error)
+
+// BatchEdit changes files of the repository, reading them with read. It returns the new contents of the files it
+// changed, by path, and the body of the pull request describing the changes.
+type BatchEdit func(read ReadFunc) (files map[string][]byte, body string, err error)
+
+// BatchPullRequest is a pull request flakeguard keeps open from its own branch, adding commits to it as it finds
+// more changes to make, instead of opening a new pull request every time
+type BatchPullRequest struct {
+	Owner string
+	Repo  string
+	// Base is the branch the pull request merges into
+	Base string
+	// Branch is the branch flakeguard commits to
+	Branch        string
+	Title         string
+	CommitMessage string
+	Edit          BatchEdit
+}
+
+// UpsertBatchPullRequest makes the batch's edits and commits them to its branch, opening the pull request if it isn't
+// already open. An open pull request gets the edits on top of its branch, and its body updated, so changes pushed to
+// it by hand are kept. Otherwise the branch is reset to the base branch before committing.
+// It returns nil if there's no open pull request and nothing to change.
+func UpsertBatchPullRequest(ctx context.Context, client *Client, batch BatchPullRequest) (*github.PullRequest, error) {
+	existing, err := findPullRequest(ctx, client, batch)
+	if err != nil {
+		return nil, err
+	}
+	var parent string
+	if existing != nil {
+		parent = existing.GetHead().GetSHA()
+	} else {
+		parent, err = BranchHead(ctx, client, batch.Owner, batch.Repo, batch.Base)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	files, body, err := batch.Edit(func(path string) ([]byte, error) {
+		return ReadFile(ctx, client, batch.Owner, batch.Repo, parent, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil && len(files) == 0 {
+		return nil, nil
+	}
+
+	if len(files) > 0 {
+		sha, err := CommitFiles(ctx, client, batch.Owner, batch.Repo, parent, batch.CommitMessage, files)
+		if err != nil {
+			return nil, err
+		}
+		// The branch of a pull request that's no longer open is stale, start it over from the base branch
+		if err := SetBranch(ctx, client, batch.Owner, batch.Repo, batch.Branch, sha, existing == nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if existing == nil {
+		created, _, err := client.Rest.PullRequests.Create(ctx, batch.Owner, batch.Repo, &github.NewPullRequest{
+			Title: github.Ptr(batch.Title),
+			Head:  github.Ptr(batch.Branch),
+			Base:  github.Ptr(batch.Base),
+			Body:  github.Ptr(body),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to open pull request from '%s' into '%s': %w", batch.Branch, batch.Base, err)
+		}
+		return created, nil
+	}
+	if existing.GetTitle() == batch.Title && existing.GetBody() == body {
+		return existing, nil
+	}
+	updated, _, err := client.Rest.PullRequests.Edit(ctx, batch.Owner, batch.Repo, existing.GetNumber(), &github.PullRequest{
+		Title: github.Ptr(batch.Title),
+		Body:  github.Ptr(body),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update pull request #%d: %w", existing.GetNumber(), err)
+	}
+	return updated, nil
+}
+
+// findPullRequest returns the open pull request from the batch's branch into its base, or nil if there isn't one
+func findPullRequest(ctx context.Context, client *Client, batch BatchPullRequest) (*github.PullRequest, error) {
+	prs, _, err := client.Rest.PullRequests.List(ctx, batch.Owner, batch.Repo, &github.PullRequestListOptions{
+		State: "open",
+		Head:  batch.Owner + ":" + batch.Branch,
+		Base:  batch.Base,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pull requests from '%s': %w", batch.Branch, err)
+	}
+	if len(prs) == 0 {
+		return nil, nil
+	}
+	return prs[0], nil
+}
@@ -0,0 +1,77 @@
+package github
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// appendLine is a batch edit that appends a line to each file, leaving files that already have it alone
+func appendLine(line string, paths ...string) BatchEdit {
+	return func(read ReadFunc) (map[string][]byte, string, error) {
+		files := map[string][]byte{}
+		for _, path := range paths {
+			content, err := read(path)
+			if err != nil {
+				return nil, "", err
+			}
+			if !strings.Contains(string(content), line) {
+				files[path] = append(content, []byte(line+"\n")...)
+			}
+		}
+		return files, "Added " + line, nil
+	}
+}
+
+func TestUpsertBatchPullRequest(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeGitHub()
+	repo := newFakeRepo(map[string]string{"a.go": "a\n", "b.go": "b\n"})
+	repo.register(t, fake)
+	client := fake.client(t)
+	ctx := context.Background()
+
+	batch := BatchPullRequest{
+		Owner:         "owner",
+		Repo:          "repo",
+		Base:          "main",
+		Branch:        "flakeguard/quarantine",
+		Title:         "Quarantine flaky tests",
+		CommitMessage: "Quarantine flaky tests",
+		Edit:          appendLine("one", "a.go"),
+	}
+	pr, err := UpsertBatchPullRequest(ctx, client, batch)
+	require.NoError(t, err)
+	require.NotNil(t, pr)
+	assert.Equal(t, 1, pr.GetNumber())
+	assert.Equal(t, "Added one", pr.GetBody())
+	assert.Equal(t, "a\none\n", repo.files("flakeguard/quarantine")["a.go"])
+	assert.Equal(t, "a\n", repo.files("main")["a.go"], "base branch should be left alone")
+
+	batch.Edit = appendLine("two", "a.go", "b.go")
+	pr, err = UpsertBatchPullRequest(ctx, client, batch)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pr.GetNumber(), "open pull request should be updated, not duplicated")
+	assert.Len(t, repo.pulls, 1)
+	assert.Equal(t, "Added two", pr.GetBody())
+	assert.Equal(t, "a\none\ntwo\n", repo.files("flakeguard/quarantine")["a.go"], "should build on the open pull request")
+	assert.Equal(t, "b\ntwo\n", repo.files("flakeguard/quarantine")["b.go"])
+
+	// Once the pull request is closed, the next batch starts over from the base branch
+	repo.pulls[0].State = github.Ptr("closed")
+	batch.Edit = appendLine("a", "a.go")
+	pr, err = UpsertBatchPullRequest(ctx, client, batch)
+	require.NoError(t, err)
+	assert.Nil(t, pr, "nothing to change, no pull request should be opened")
+
+	batch.Edit = appendLine("three", "b.go")
+	pr, err = UpsertBatchPullRequest(ctx, client, batch)
+	require.NoError(t, err)
+	assert.Equal(t, 2, pr.GetNumber())
+	assert.Equal(t, map[string]string{"a.go": "a\n", "b.go": "b\nthree\n"}, repo.files("flakeguard/quarantine"))
+}
@@ -0,0 +1,102 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v72/github"
+)
+
+const (
+	// CheckRunName is the name of the check run flakeguard publishes
+	CheckRunName = "Flakeguard"
+
+	// GitHub accepts at most 50 annotations per request, more are added by updating the check run
+	maxAnnotationsPerRequest = 50
+	// GitHub rejects check run summaries longer than this
+	maxSummaryLength = 65535
+)
+
+// CheckRun is a completed check run on a commit
+type CheckRun struct {
+	Owner   string
+	Repo    string
+	HeadSHA string
+	// Conclusion is one of success, failure, neutral, cancelled, skipped, timed_out, or action_required
+	Conclusion  string
+	Title       string
+	Summary     string
+	Annotations []Annotation
+}
+
+// Annotation points at a line of a file in the check run's commit
+type Annotation struct {
+	// Path relative to the root of the repository
+	Path    string
+	Line    int
+	Title   string
+	Message string
+	// RawDetails are shown when the annotation is expanded
+	RawDetails string
+}
+
+func (a Annotation) toGitHub() *github.CheckRunAnnotation {
+	annotation := &github.CheckRunAnnotation{
+		Path:            github.Ptr(a.Path),
+		StartLine:       github.Ptr(a.Line),
+		EndLine:         github.Ptr(a.Line),
+		AnnotationLevel: github.Ptr("warning"),
+		Message:         github.Ptr(a.Message),
+		Title:           github.Ptr(a.Title),
+	}
+	if a.RawDetails != "" {
+		annotation.RawDetails = github.Ptr(a.RawDetails)
+	}
+	return annotation
+}
+
+// PublishCheckRun creates the check run on its commit, with all of its annotations
+func PublishCheckRun(ctx context.Context, client *Client, run CheckRun) (*github.CheckRun, error) {
+	summary := run.Summary
+	if len(summary) > maxSummaryLength {
+		summary = summary[:maxSummaryLength-len("\n...")] + "\n..."
+	}
+	annotations := make([]*github.CheckRunAnnotation, 0, len(run.Annotations))
+	for _, annotation := range run.Annotations {
+		annotations = append(annotations, annotation.toGitHub())
+	}
+	output := func(batch []*github.CheckRunAnnotation) *github.CheckRunOutput {
+		return &github.CheckRunOutput{
+			Title:       github.Ptr(run.Title),
+			Summary:     github.Ptr(summary),
+			Annotations: batch,
+		}
+	}
+
+	first := annotations[:min(len(annotations), maxAnnotationsPerRequest)]
+	created, _, err := client.Rest.Checks.CreateCheckRun(ctx, run.Owner, run.Repo, github.CreateCheckRunOptions{
+		Name:        CheckRunName,
+		HeadSHA:     run.HeadSHA,
+		Status:      github.Ptr("completed"),
+		Conclusion:  github.Ptr(run.Conclusion),
+		CompletedAt: &github.Timestamp{Time: time.Now()},
+		Output:      output(first),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create check run on commit '%s': %w", run.HeadSHA, err)
+	}
+
+	// Annotations of updates are added to the ones already on the check run
+	for start := len(first); start < len(annotations); start += maxAnnotationsPerRequest {
+		batch := annotations[start:min(len(annotations), start+maxAnnotationsPerRequest)]
+		created, _, err = client.Rest.Checks.UpdateCheckRun(ctx, run.Owner, run.Repo, created.GetID(), github.UpdateCheckRunOptions{
+			Name:   CheckRunName,
+			Output: output(batch),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add annotations to check run %d: %w", created.GetID(), err)
+		}
+	}
+	return created, nil
+}
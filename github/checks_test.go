@@ -0,0 +1,72 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishCheckRun(t *testing.T) {
+	t.Parallel()
+
+	var (
+		created     github.CreateCheckRunOptions
+		updates     []github.UpdateCheckRunOptions
+		annotations []*github.CheckRunAnnotation
+	)
+	fake := newFakeGitHub()
+	fake.mux.HandleFunc("POST /repos/owner/repo/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+		annotations = append(annotations, created.Output.Annotations...)
+		writeJSON(t, w, http.StatusCreated, github.CheckRun{ID: github.Ptr(int64(42)), Name: github.Ptr(created.Name)})
+	})
+	fake.mux.HandleFunc("PATCH /repos/owner/repo/check-runs/42", func(w http.ResponseWriter, r *http.Request) {
+		var update github.UpdateCheckRunOptions
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&update))
+		updates = append(updates, update)
+		annotations = append(annotations, update.Output.Annotations...)
+		writeJSON(t, w, http.StatusOK, github.CheckRun{ID: github.Ptr(int64(42)), Name: github.Ptr(update.Name)})
+	})
+
+	run := CheckRun{
+		Owner:      "owner",
+		Repo:       "repo",
+		HeadSHA:    "abc123",
+		Conclusion: "neutral",
+		Title:      "120 flaky tests",
+		Summary:    "summary",
+	}
+	for i := range 120 {
+		run.Annotations = append(run.Annotations, Annotation{
+			Path:    "pkg/flaky_test.go",
+			Line:    i + 1,
+			Title:   fmt.Sprintf("TestFlaky%d is flaky", i),
+			Message: "Passed 9 of 10 runs",
+		})
+	}
+
+	checkRun, err := PublishCheckRun(context.Background(), fake.client(t), run)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), checkRun.GetID())
+
+	assert.Equal(t, CheckRunName, created.Name)
+	assert.Equal(t, "abc123", created.HeadSHA)
+	assert.Equal(t, "completed", created.GetStatus())
+	assert.Equal(t, "neutral", created.GetConclusion())
+	require.Len(t, updates, 2, "annotations should be sent in batches of 50")
+	for _, update := range updates {
+		assert.Equal(t, "120 flaky tests", update.Output.GetTitle(), "every update needs the output title")
+		assert.Equal(t, "summary", update.Output.GetSummary(), "every update needs the output summary")
+	}
+	require.Len(t, annotations, 120)
+	for i, annotation := range annotations {
+		assert.Equal(t, i+1, annotation.GetStartLine(), "annotations should be sent in order")
+		assert.Equal(t, "warning", annotation.GetAnnotationLevel())
+	}
+}
@@ -1,11 +1,13 @@
 package github
 
 import (
-	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofri/go-github-ratelimit/v2/github_ratelimit"
@@ -20,6 +22,8 @@ import (
 const (
 	// TokenEnvVar is the environment variable that contains the GitHub token.
 	TokenEnvVar = "GITHUB_TOKEN"
+	// DefaultAPIURL is the REST API URL of github.com
+	DefaultAPIURL = "https://api.github.com"
 	// RateLimitWarningThreshold is the number of remaining requests before a warning is logged.
 	RateLimitWarningThreshold = 5
 	// RateLimitWarningMsg is the message logged when the number of remaining requests is below the warning threshold.
@@ -33,16 +37,102 @@ type Client struct {
 	Rest    *github.Client
 	GraphQL *gh_graphql.Client
 	token   string
+	// download fetches files GitHub redirects to, like artifacts. It's rate limited and logged like the API, but
+	// doesn't send the token, as the redirects are to pre-signed URLs that refuse other credentials.
+	download *http.Client
+}
+
+// clientOptions configure where the client sends requests to
+type clientOptions struct {
+	restURL    string
+	graphQLURL string
+	caFile     string
+	app        *AppAuth
+}
+
+// ClientOption configures the GitHub client
+type ClientOption func(*clientOptions)
+
+// WithEnterpriseURLs sends requests to a GitHub Enterprise Server, or GitHub Enterprise Cloud with data residency,
+// instead of github.com. An empty graphQLURL is derived from restURL.
+func WithEnterpriseURLs(restURL, graphQLURL string) ClientOption {
+	return func(o *clientOptions) {
+		o.restURL = restURL
+		o.graphQLURL = graphQLURL
+	}
+}
+
+// WithCACertFile trusts the PEM encoded certificates in the file on top of the system's, for on-prem installs using
+// their own certificate authority
+func WithCACertFile(path string) ClientOption {
+	return func(o *clientOptions) {
+		o.caFile = path
+	}
+}
+
+// EnterpriseURLs returns the REST and GraphQL API URLs of a GitHub host recognized as an enterprise install, like
+// github.example.com or example.ghe.com. Hosts that don't look like GitHub, and github.com itself, aren't recognized,
+// so tokens are never sent to some other git host.
+func EnterpriseURLs(host string) (restURL, graphQLURL string, ok bool) {
+	host = strings.ToLower(host)
+	switch {
+	case host == "github.com" || host == "www.github.com":
+		return "", "", false
+	case strings.HasSuffix(host, ".ghe.com"):
+		return "https://api." + host + "/", "https://api." + host + "/graphql", true
+	case strings.HasPrefix(host, "github.") || strings.Contains(host, ".github.") ||
+		strings.HasPrefix(host, "ghe.") || strings.Contains(host, ".ghe."):
+		return "https://" + host + "/api/v3/", "https://" + host + "/api/graphql", true
+	}
+	return "", "", false
+}
+
+// graphQLURLFor derives the GraphQL API URL from a REST API URL, like https://github.example.com/api/v3 to
+// https://github.example.com/api/graphql
+func graphQLURLFor(restURL string) string {
+	restURL = strings.TrimSuffix(restURL, "/")
+	if base, ok := strings.CutSuffix(restURL, "/api/v3"); ok {
+		return base + "/api/graphql"
+	}
+	return restURL + "/graphql"
+}
+
+// caTransport returns a transport trusting the certificates in caFile along with the system's
+func caTransport(caFile string) (http.RoundTripper, error) {
+	//nolint:gosec // G304: the path comes from the user
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM encoded certificates found in %s", caFile)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return transport, nil
 }
 
 // NewClient creates a new GitHub REST and GraphQL API client with the provided token and logger.
-// If optionalNext is provided, it will be used as the base client for both REST and GraphQL, handy for testing.
+// If optionalNext is provided, it will be used as the base client for REST, handy for testing.
 func NewClient(
 	l zerolog.Logger,
 	githubToken string,
 	optionalNext http.RoundTripper,
+	opts ...ClientOption,
 ) (*Client, error) {
+	options := &clientOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	switch {
+	case options.app != nil:
+		githubToken = ""
+		l.Debug().Int64("app_id", options.app.AppID).Msg("Using GitHub App installation tokens")
 	case githubToken != "":
 		l.Debug().Msg("Using GitHub token from flag")
 	case os.Getenv(TokenEnvVar) != "":
@@ -54,9 +144,19 @@ func NewClient(
 
 	var (
 		next   http.RoundTripper
+		base   http.RoundTripper
 		client = &Client{}
 	)
 
+	if options.caFile != "" {
+		var err error
+		base, err = caTransport(options.caFile)
+		if err != nil {
+			return nil, err
+		}
+		next = base
+		l.Debug().Str("ca_file", options.caFile).Msg("Trusting custom CA certificates for GitHub")
+	}
 	if optionalNext != nil {
 		next = optionalNext
 	}
@@ -101,18 +201,48 @@ func NewClient(
 		github_secondary_ratelimit.WithLimitDetectedCallback(onSecondaryRateLimitHit),
 	)
 
-	client.Rest = github.NewClient(rateLimiter)
+	var (
+		restClient                     = rateLimiter
+		tokenSource oauth2.TokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: githubToken})
+	)
+	if options.app != nil {
+		var err error
+		tokenSource, err = newAppTokenSource(l, *options.app, rateLimiter.Transport, options.restURL)
+		if err != nil {
+			return nil, err
+		}
+		restClient = &http.Client{Transport: &oauth2.Transport{Source: tokenSource, Base: rateLimiter.Transport}}
+	}
+
+	client.Rest = github.NewClient(restClient)
+	client.download = rateLimiter
+	if options.restURL != "" {
+		var err error
+		client.Rest, err = client.Rest.WithEnterpriseURLs(options.restURL, options.restURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GitHub API URL '%s': %w", options.restURL, err)
+		}
+		if options.graphQLURL == "" {
+			options.graphQLURL = graphQLURLFor(options.restURL)
+		}
+		l.Debug().
+			Str("rest_url", client.Rest.BaseURL.String()).
+			Str("graphql_url", options.graphQLURL).
+			Msg("Using GitHub Enterprise API")
+	}
 	if githubToken != "" {
 		client.Rest = client.Rest.WithAuthToken(githubToken)
 		client.token = githubToken
 	}
 
-	src := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: githubToken},
-	)
-	graphqlClient := oauth2.NewClient(context.Background(), src)
-	graphqlClient.Transport = clientRoundTripper("GraphQL", l, graphqlClient.Transport)
-	client.GraphQL = gh_graphql.NewClient(graphqlClient)
+	graphqlClient := &http.Client{
+		Transport: clientRoundTripper("GraphQL", l, &oauth2.Transport{Source: tokenSource, Base: base}),
+	}
+	if options.graphQLURL != "" {
+		client.GraphQL = gh_graphql.NewEnterpriseClient(options.graphQLURL, graphqlClient)
+	} else {
+		client.GraphQL = gh_graphql.NewClient(graphqlClient)
+	}
 
 	return client, nil
 }
@@ -151,13 +281,16 @@ func (lt *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error)
 
 	resp, err := lt.transport.RoundTrip(req)
 	duration := time.Since(start)
+	if err != nil {
+		return resp, err
+	}
 
 	l = l.With().
 		Int("status", resp.StatusCode).
 		Str("duration", duration.String()).
 		Logger()
 
-	if err != nil || resp.StatusCode != http.StatusOK {
+	if resp.StatusCode != http.StatusOK {
 		// Probably a rate limit error, let the rate limit library handle it
 		return resp, err
 	}
@@ -3,11 +3,14 @@ package github
 import (
 	"bytes"
 	"context"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -76,6 +79,106 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
+func TestNewClientEnterprise(t *testing.T) {
+	t.Parallel()
+
+	var paths []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"), "requests should be authenticated")
+		switch r.URL.Path {
+		case "/api/v3/repos/owner/repo":
+			_, _ = w.Write([]byte(`{"default_branch":"trunk"}`))
+		case "/api/graphql":
+			_, _ = w.Write([]byte(`{"data":{"viewer":{"login":"flakeguard"}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0600))
+
+	client, err := NewClient(testhelpers.Logger(t), "test-token", nil,
+		WithEnterpriseURLs(server.URL+"/api/v3", ""),
+		WithCACertFile(caFile),
+	)
+	require.NoError(t, err)
+
+	repo, err := RepoInfo(t.Context(), client, "owner", "repo")
+	require.NoError(t, err, "REST requests should go to the enterprise server and trust its certificate")
+	assert.Equal(t, "trunk", repo.GetDefaultBranch())
+
+	var query struct {
+		Viewer struct {
+			Login string
+		}
+	}
+	require.NoError(t, client.GraphQL.Query(t.Context(), &query, nil), "GraphQL requests should go to the enterprise server")
+	assert.Equal(t, "flakeguard", query.Viewer.Login)
+	assert.Equal(t, []string{"/api/v3/repos/owner/repo", "/api/graphql"}, paths)
+
+	_, err = NewClient(testhelpers.Logger(t), "test-token", nil, WithCACertFile(filepath.Join(t.TempDir(), "missing.pem")))
+	require.Error(t, err, "missing CA file should fail")
+	notPEM := filepath.Join(t.TempDir(), "not.pem")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0600))
+	_, err = NewClient(testhelpers.Logger(t), "test-token", nil, WithCACertFile(notPEM))
+	require.Error(t, err, "CA file without certificates should fail")
+}
+
+func TestEnterpriseURLs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		host           string
+		wantRESTURL    string
+		wantGraphQLURL string
+		wantOK         bool
+	}{
+		{host: "github.com"},
+		{host: "gitlab.com"},
+		{host: "git.example.com"},
+		{
+			host:           "github.example.com",
+			wantRESTURL:    "https://github.example.com/api/v3/",
+			wantGraphQLURL: "https://github.example.com/api/graphql",
+			wantOK:         true,
+		},
+		{
+			host:           "code.github.example.com",
+			wantRESTURL:    "https://code.github.example.com/api/v3/",
+			wantGraphQLURL: "https://code.github.example.com/api/graphql",
+			wantOK:         true,
+		},
+		{
+			host:           "ghe.example.com",
+			wantRESTURL:    "https://ghe.example.com/api/v3/",
+			wantGraphQLURL: "https://ghe.example.com/api/graphql",
+			wantOK:         true,
+		},
+		{
+			host:           "example.ghe.com",
+			wantRESTURL:    "https://api.example.ghe.com/",
+			wantGraphQLURL: "https://api.example.ghe.com/graphql",
+			wantOK:         true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			t.Parallel()
+			restURL, graphQLURL, ok := EnterpriseURLs(tt.host)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantRESTURL, restURL)
+			assert.Equal(t, tt.wantGraphQLURL, graphQLURL)
+		})
+	}
+
+	assert.Equal(t, "https://github.example.com/api/graphql", graphQLURLFor("https://github.example.com/api/v3/"))
+	assert.Equal(t, "https://api.example.ghe.com/graphql", graphQLURLFor("https://api.example.ghe.com"))
+}
+
 func TestRateLimit(t *testing.T) {
 	t.Parallel()
 	if testing.Short() {
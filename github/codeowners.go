@@ -0,0 +1,110 @@
+package github
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// codeOwnersPaths are where GitHub looks for the CODEOWNERS file, in order
+var codeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// CodeOwners are the rules of a CODEOWNERS file
+// https://docs.github.com/en/repositories/managing-your-repositorys-settings-and-features/customizing-your-repository/about-code-owners
+type CodeOwners struct {
+	rules []codeOwnersRule
+}
+
+type codeOwnersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// ReadCodeOwners reads the CODEOWNERS file of the repository at repoRoot, from the first place GitHub looks for it.
+// A repository without one has no owners for any path.
+func ReadCodeOwners(repoRoot string) (*CodeOwners, error) {
+	for _, path := range codeOwnersPaths {
+		//nolint:gosec // G304: the path is in the repository
+		content, err := os.ReadFile(filepath.Join(repoRoot, path))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		codeOwners, err := ParseCodeOwners(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		return codeOwners, nil
+	}
+	return &CodeOwners{}, nil
+}
+
+// ParseCodeOwners parses the content of a CODEOWNERS file
+func ParseCodeOwners(content []byte) (*CodeOwners, error) {
+	codeOwners := &CodeOwners{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		pattern, err := regexp.Compile(codeOwnersRegexp(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s' on line %d: %w", fields[0], lineNumber, err)
+		}
+		codeOwners.rules = append(codeOwners.rules, codeOwnersRule{pattern: pattern, owners: fields[1:]})
+	}
+	return codeOwners, scanner.Err()
+}
+
+// Owners returns the owners of a path relative to the root of the repository.
+// Like on GitHub, the last rule matching the path wins, even if it has no owners.
+func (c *CodeOwners) Owners(path string) []string {
+	path = strings.TrimPrefix(filepath.ToSlash(path), "/")
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		if c.rules[i].pattern.MatchString(path) {
+			return c.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// codeOwnersRegexp turns a CODEOWNERS pattern, which follows most gitignore rules, into a regexp matching the paths
+// it applies to
+func codeOwnersRegexp(pattern string) string {
+	// Patterns with a slash at the start or in the middle are relative to the root, others match at any depth
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.Trim(pattern, "/")
+
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	// A pattern matching a directory applies to everything in it
+	re.WriteString("(?:/.*)?$")
+	return re.String()
+}
@@ -0,0 +1,42 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodeOwners(t *testing.T) {
+	t.Parallel()
+
+	codeOwners, err := ParseCodeOwners([]byte(`# Default owners
+*                @org/everyone
+*.md             @org/docs # inline comment
+/core/           @org/core
+core/services/** @org/services
+**/testdata      @org/testers
+/core/vendored/
+`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		path   string
+		owners []string
+	}{
+		{"main.go", []string{"@org/everyone"}},
+		{"docs/README.md", []string{"@org/docs"}},
+		{"core/chain/chain_test.go", []string{"@org/core"}},
+		{"other/core/chain_test.go", []string{"@org/everyone"}},
+		{"core/services/a/b/c_test.go", []string{"@org/services"}},
+		{"pkg/testdata/fixture.json", []string{"@org/testers"}},
+		{"core/vendored/lib.go", []string{}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.owners, codeOwners.Owners(test.path), test.path)
+	}
+
+	empty, err := ReadCodeOwners(t.TempDir())
+	require.NoError(t, err)
+	assert.Nil(t, empty.Owners("main.go"))
+}
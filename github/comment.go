@@ -0,0 +1,83 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v72/github"
+)
+
+// StickyComment is a pull request comment flakeguard keeps up to date across runs, instead of adding a new one every
+// time. It's found again by a hidden marker in its body, so different workflows can each keep their own.
+type StickyComment struct {
+	Owner  string
+	Repo   string
+	Number int
+	// Key tells apart sticky comments on the same pull request, e.g. by workflow and job
+	Key string
+}
+
+func (c StickyComment) marker() string {
+	return fmt.Sprintf("<!-- flakeguard:%s -->", c.Key)
+}
+
+// UpsertComment creates the sticky comment with the body, or updates it if it already exists
+func UpsertComment(ctx context.Context, client *Client, comment StickyComment, body string) (*github.IssueComment, error) {
+	existing, err := findComment(ctx, client, comment)
+	if err != nil {
+		return nil, err
+	}
+	body = comment.marker() + "\n" + body
+	if existing == nil {
+		created, _, err := client.Rest.Issues.CreateComment(ctx, comment.Owner, comment.Repo, comment.Number,
+			&github.IssueComment{Body: github.Ptr(body)},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create comment on pull request #%d: %w", comment.Number, err)
+		}
+		return created, nil
+	}
+	if existing.GetBody() == body {
+		return existing, nil
+	}
+	updated, _, err := client.Rest.Issues.EditComment(ctx, comment.Owner, comment.Repo, existing.GetID(),
+		&github.IssueComment{Body: github.Ptr(body)},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update comment %d on pull request #%d: %w", existing.GetID(), comment.Number, err)
+	}
+	return updated, nil
+}
+
+// DeleteComment deletes the sticky comment if it exists, and reports whether it did
+func DeleteComment(ctx context.Context, client *Client, comment StickyComment) (bool, error) {
+	existing, err := findComment(ctx, client, comment)
+	if err != nil || existing == nil {
+		return false, err
+	}
+	if _, err := client.Rest.Issues.DeleteComment(ctx, comment.Owner, comment.Repo, existing.GetID()); err != nil {
+		return false, fmt.Errorf("failed to delete comment %d on pull request #%d: %w", existing.GetID(), comment.Number, err)
+	}
+	return true, nil
+}
+
+// findComment returns the sticky comment, or nil if there isn't one
+func findComment(ctx context.Context, client *Client, comment StickyComment) (*github.IssueComment, error) {
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := client.Rest.Issues.ListComments(ctx, comment.Owner, comment.Repo, comment.Number, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list comments on pull request #%d: %w", comment.Number, err)
+		}
+		for _, c := range comments {
+			if strings.HasPrefix(c.GetBody(), comment.marker()) {
+				return c, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,107 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeComments fakes the comments of a single pull request
+type fakeComments struct {
+	comments []*github.IssueComment
+	nextID   int64
+}
+
+func (f *fakeComments) register(t *testing.T, fake *fakeGitHub) {
+	t.Helper()
+	fake.mux.HandleFunc("GET /repos/owner/repo/issues/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		// One comment per page, to exercise pagination
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		page = max(page, 1)
+		if page < len(f.comments) {
+			w.Header().Set("Link", fmt.Sprintf(`<https://api.github.com/repos/owner/repo/issues/7/comments?page=%d>; rel="next"`, page+1))
+		}
+		if page > len(f.comments) {
+			writeJSON(t, w, http.StatusOK, []*github.IssueComment{})
+			return
+		}
+		writeJSON(t, w, http.StatusOK, f.comments[page-1:page])
+	})
+	fake.mux.HandleFunc("POST /repos/owner/repo/issues/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		var comment github.IssueComment
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+		f.nextID++
+		comment.ID = github.Ptr(f.nextID)
+		f.comments = append(f.comments, &comment)
+		writeJSON(t, w, http.StatusCreated, comment)
+	})
+	fake.mux.HandleFunc("PATCH /repos/owner/repo/issues/comments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		var edit github.IssueComment
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&edit))
+		for _, comment := range f.comments {
+			if comment.GetID() == id {
+				comment.Body = edit.Body
+				writeJSON(t, w, http.StatusOK, comment)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	fake.mux.HandleFunc("DELETE /repos/owner/repo/issues/comments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		for i, comment := range f.comments {
+			if comment.GetID() == id {
+				f.comments = append(f.comments[:i], f.comments[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+}
+
+func TestStickyComment(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeGitHub()
+	comments := &fakeComments{
+		comments: []*github.IssueComment{{ID: github.Ptr(int64(100)), Body: github.Ptr("LGTM")}},
+		nextID:   100,
+	}
+	comments.register(t, fake)
+	client := fake.client(t)
+	ctx := context.Background()
+
+	sticky := StickyComment{Owner: "owner", Repo: "repo", Number: 7, Key: "ci/test"}
+	other := StickyComment{Owner: "owner", Repo: "repo", Number: 7, Key: "ci/e2e"}
+
+	created, err := UpsertComment(ctx, client, sticky, "1 flaky test")
+	require.NoError(t, err)
+	assert.Equal(t, "<!-- flakeguard:ci/test -->\n1 flaky test", created.GetBody())
+	_, err = UpsertComment(ctx, client, other, "other job")
+	require.NoError(t, err)
+
+	updated, err := UpsertComment(ctx, client, sticky, "2 flaky tests")
+	require.NoError(t, err)
+	assert.Equal(t, created.GetID(), updated.GetID(), "existing comment should be updated")
+	require.Len(t, comments.comments, 3, "no duplicate comments")
+	assert.Equal(t, "<!-- flakeguard:ci/test -->\n2 flaky tests", comments.comments[1].GetBody())
+
+	deleted, err := DeleteComment(ctx, client, sticky)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = DeleteComment(ctx, client, sticky)
+	require.NoError(t, err)
+	assert.False(t, deleted, "nothing left to delete")
+	require.Len(t, comments.comments, 2, "other comments should be left alone")
+	assert.Equal(t, "LGTM", comments.comments[0].GetBody())
+	assert.Equal(t, "<!-- flakeguard:ci/e2e -->\nother job", comments.comments[1].GetBody())
+}
@@ -0,0 +1,250 @@
+package github
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/flakeguard/internal/testhelpers"
+)
+
+// fakeGitHub serves GitHub API requests from handlers registered on its mux, without any network.
+// Pass it to NewClient as the transport.
+type fakeGitHub struct {
+	mux *http.ServeMux
+}
+
+func newFakeGitHub() *fakeGitHub {
+	return &fakeGitHub{mux: http.NewServeMux()}
+}
+
+func (f *fakeGitHub) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	f.mux.ServeHTTP(recorder, req)
+	resp := recorder.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+// client creates a GitHub client that sends its requests to the fake
+func (f *fakeGitHub) client(t *testing.T) *Client {
+	t.Helper()
+	client, err := NewClient(testhelpers.Logger(t), "test-token", f)
+	require.NoError(t, err)
+	return client
+}
+
+// writeJSON responds to a fake request with a JSON body
+func writeJSON(t *testing.T, w http.ResponseWriter, status int, body any) {
+	t.Helper()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	require.NoError(t, json.NewEncoder(w).Encode(body))
+}
+
+// fakeRepo fakes the git data, contents, and pull requests of owner/repo.
+// Commits are snapshots of every file, keyed by SHA.
+type fakeRepo struct {
+	mu      sync.Mutex
+	commits map[string]map[string]string
+	trees   map[string]map[string]string
+	refs    map[string]string
+	// Parents and messages of commits created through the API
+	parents  map[string]string
+	messages map[string]string
+	pulls    []*github.PullRequest
+	nextSHA  int
+	// beforeUpdateRef runs before a branch is moved, to fake someone else pushing to it
+	beforeUpdateRef func(branch string)
+}
+
+// newFakeRepo creates a repository with a main branch holding the files
+func newFakeRepo(files map[string]string) *fakeRepo {
+	repo := &fakeRepo{
+		commits:  map[string]map[string]string{},
+		trees:    map[string]map[string]string{},
+		refs:     map[string]string{},
+		parents:  map[string]string{},
+		messages: map[string]string{},
+	}
+	repo.refs["main"] = repo.commit(files)
+	return repo
+}
+
+func (f *fakeRepo) sha() string {
+	f.nextSHA++
+	return fmt.Sprintf("%040d", f.nextSHA)
+}
+
+// commit snapshots the files as a new commit, and returns its SHA
+func (f *fakeRepo) commit(files map[string]string) string {
+	sha := f.sha()
+	f.commits[sha] = maps.Clone(files)
+	f.trees["tree-"+sha] = f.commits[sha]
+	return sha
+}
+
+// files returns the files of a branch
+func (f *fakeRepo) files(branch string) map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.commits[f.refs[branch]]
+}
+
+func (f *fakeRepo) register(t *testing.T, fake *fakeGitHub) {
+	t.Helper()
+	fake.mux.HandleFunc("GET /repos/owner/repo/git/ref/heads/{branch...}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		sha, ok := f.refs[r.PathValue("branch")]
+		if !ok {
+			writeJSON(t, w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		writeJSON(t, w, http.StatusOK, github.Reference{
+			Ref:    github.Ptr("refs/heads/" + r.PathValue("branch")),
+			Object: &github.GitObject{SHA: github.Ptr(sha)},
+		})
+	})
+	fake.mux.HandleFunc("POST /repos/owner/repo/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var ref struct{ Ref, SHA string }
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&ref))
+		f.refs[strings.TrimPrefix(ref.Ref, "refs/heads/")] = ref.SHA
+		writeJSON(t, w, http.StatusCreated, github.Reference{Ref: github.Ptr(ref.Ref)})
+	})
+	fake.mux.HandleFunc("PATCH /repos/owner/repo/git/refs/heads/{branch...}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var update struct {
+			SHA   string
+			Force bool
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&update))
+		branch := r.PathValue("branch")
+		if f.beforeUpdateRef != nil {
+			f.beforeUpdateRef(branch)
+		}
+		if !update.Force && f.parents[update.SHA] != f.refs[branch] {
+			writeJSON(t, w, http.StatusUnprocessableEntity, map[string]string{"message": "Update is not a fast forward"})
+			return
+		}
+		f.refs[branch] = update.SHA
+		writeJSON(t, w, http.StatusOK, github.Reference{Ref: github.Ptr("refs/heads/" + branch)})
+	})
+	fake.mux.HandleFunc("GET /repos/owner/repo/git/commits/{sha}", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, http.StatusOK, github.Commit{
+			SHA:  github.Ptr(r.PathValue("sha")),
+			Tree: &github.Tree{SHA: github.Ptr("tree-" + r.PathValue("sha"))},
+		})
+	})
+	fake.mux.HandleFunc("POST /repos/owner/repo/git/trees", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var tree struct {
+			BaseTree string              `json:"base_tree"`
+			Tree     []*github.TreeEntry `json:"tree"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&tree))
+		files := maps.Clone(f.trees[tree.BaseTree])
+		for _, entry := range tree.Tree {
+			files[entry.GetPath()] = entry.GetContent()
+		}
+		sha := "tree-" + f.sha()
+		f.trees[sha] = files
+		writeJSON(t, w, http.StatusCreated, github.Tree{SHA: github.Ptr(sha)})
+	})
+	fake.mux.HandleFunc("POST /repos/owner/repo/git/commits", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var commit struct {
+			Message string
+			Tree    string
+			Parents []string
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&commit))
+		sha := f.sha()
+		f.commits[sha] = f.trees[commit.Tree]
+		f.trees["tree-"+sha] = f.trees[commit.Tree]
+		f.parents[sha] = commit.Parents[0]
+		f.messages[sha] = commit.Message
+		writeJSON(t, w, http.StatusCreated, github.Commit{SHA: github.Ptr(sha)})
+	})
+	fake.mux.HandleFunc("GET /repos/owner/repo/contents/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		ref := r.URL.Query().Get("ref")
+		if sha, ok := f.refs[ref]; ok {
+			ref = sha
+		}
+		content, ok := f.commits[ref][r.PathValue("path")]
+		if !ok {
+			writeJSON(t, w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		writeJSON(t, w, http.StatusOK, github.RepositoryContent{
+			Type:     github.Ptr("file"),
+			Encoding: github.Ptr("base64"),
+			Content:  github.Ptr(base64.StdEncoding.EncodeToString([]byte(content))),
+		})
+	})
+	fake.mux.HandleFunc("GET /repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		pulls := []*github.PullRequest{}
+		for _, pr := range f.pulls {
+			if pr.GetState() == "open" && "owner:"+pr.GetHead().GetRef() == r.URL.Query().Get("head") {
+				pr.Head.SHA = github.Ptr(f.refs[pr.GetHead().GetRef()])
+				pulls = append(pulls, pr)
+			}
+		}
+		writeJSON(t, w, http.StatusOK, pulls)
+	})
+	fake.mux.HandleFunc("GET /repos/owner/repo/pulls/{number}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		number, _ := strconv.Atoi(r.PathValue("number"))
+		pr := f.pulls[number-1]
+		if sha, ok := f.refs[pr.GetHead().GetRef()]; ok && pr.GetHead().GetRepo().GetFullName() == "owner/repo" {
+			pr.Head.SHA = github.Ptr(sha)
+		}
+		writeJSON(t, w, http.StatusOK, pr)
+	})
+	fake.mux.HandleFunc("POST /repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var pr github.NewPullRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&pr))
+		created := &github.PullRequest{
+			Number: github.Ptr(len(f.pulls) + 1),
+			State:  github.Ptr("open"),
+			Title:  pr.Title,
+			Body:   pr.Body,
+			Head:   &github.PullRequestBranch{Ref: pr.Head, Repo: &github.Repository{FullName: github.Ptr("owner/repo")}},
+			Base:   &github.PullRequestBranch{Ref: pr.Base},
+		}
+		f.pulls = append(f.pulls, created)
+		writeJSON(t, w, http.StatusCreated, created)
+	})
+	fake.mux.HandleFunc("PATCH /repos/owner/repo/pulls/{number}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		number, _ := strconv.Atoi(r.PathValue("number"))
+		var edit github.PullRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&edit))
+		pr := f.pulls[number-1]
+		pr.Title, pr.Body = edit.Title, edit.Body
+		writeJSON(t, w, http.StatusOK, pr)
+	})
+}
@@ -0,0 +1,114 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/google/go-github/v72/github"
+)
+
+// ErrBranchNotFound is returned when a branch doesn't exist in the repository.
+var ErrBranchNotFound = errors.New("branch not found")
+
+// ReadFile reads a file of the repository at a commit, branch, or tag
+func ReadFile(ctx context.Context, client *Client, owner, repo, ref, path string) ([]byte, error) {
+	file, _, _, err := client.Rest.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{Ref: ref})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s' at '%s': %w", path, ref, err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("'%s' at '%s' is a directory", path, ref)
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode '%s' at '%s': %w", path, ref, err)
+	}
+	return []byte(content), nil
+}
+
+// CommitFiles creates a commit on top of parentSHA that changes the files to the given contents, by path relative to
+// the root of the repository. Commits are created through the Git Data API, so no local checkout or push credentials
+// are needed, and GitHub signs them. No branch is moved to the commit, use SetBranch for that.
+func CommitFiles(
+	ctx context.Context,
+	client *Client,
+	owner, repo, parentSHA, message string,
+	files map[string][]byte,
+) (string, error) {
+	parent, _, err := client.Rest.Git.GetCommit(ctx, owner, repo, parentSHA)
+	if err != nil {
+		return "", fmt.Errorf("failed to get commit '%s': %w", parentSHA, err)
+	}
+
+	// Sorted, so the same changes always make the same tree
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	entries := make([]*github.TreeEntry, 0, len(files))
+	for _, path := range paths {
+		entries = append(entries, &github.TreeEntry{
+			Path:    github.Ptr(path),
+			Mode:    github.Ptr("100644"),
+			Type:    github.Ptr("blob"),
+			Content: github.Ptr(string(files[path])),
+		})
+	}
+	tree, _, err := client.Rest.Git.CreateTree(ctx, owner, repo, parent.GetTree().GetSHA(), entries)
+	if err != nil {
+		return "", fmt.Errorf("failed to create tree on top of commit '%s': %w", parentSHA, err)
+	}
+
+	commit, _, err := client.Rest.Git.CreateCommit(ctx, owner, repo, &github.Commit{
+		Message: github.Ptr(message),
+		Tree:    &github.Tree{SHA: tree.SHA},
+		Parents: []*github.Commit{{SHA: github.Ptr(parentSHA)}},
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create commit on top of '%s': %w", parentSHA, err)
+	}
+	return commit.GetSHA(), nil
+}
+
+// BranchHead returns the SHA of the latest commit of a branch, or ErrBranchNotFound if there's no such branch
+func BranchHead(ctx context.Context, client *Client, owner, repo, branch string) (string, error) {
+	ref, resp, err := client.Rest.Git.GetRef(ctx, owner, repo, "heads/"+branch)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%w: '%s'", ErrBranchNotFound, branch)
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get branch '%s': %w", branch, err)
+	}
+	return ref.GetObject().GetSHA(), nil
+}
+
+// SetBranch points a branch at a commit, creating the branch if it doesn't exist.
+// Without force, GitHub only moves an existing branch if the commit comes after its current head, so anything pushed
+// to it in the meantime is never thrown away.
+func SetBranch(ctx context.Context, client *Client, owner, repo, branch, sha string, force bool) error {
+	_, err := BranchHead(ctx, client, owner, repo, branch)
+	if errors.Is(err, ErrBranchNotFound) {
+		_, _, err = client.Rest.Git.CreateRef(ctx, owner, repo, &github.Reference{
+			Ref:    github.Ptr("refs/heads/" + branch),
+			Object: &github.GitObject{SHA: github.Ptr(sha)},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create branch '%s': %w", branch, err)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	_, _, err = client.Rest.Git.UpdateRef(ctx, owner, repo, &github.Reference{
+		Ref:    github.Ptr("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: github.Ptr(sha)},
+	}, force)
+	if err != nil {
+		return fmt.Errorf("failed to move branch '%s' to '%s': %w", branch, sha, err)
+	}
+	return nil
+}
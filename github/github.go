@@ -3,17 +3,20 @@ package github
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
 
 	"github.com/caarlos0/env/v11"
+	"github.com/google/go-github/v72/github"
 )
 
 var (
 	// ErrNotInActions is returned when the code is not running in a GitHub Actions environment.
 	ErrNotInActions = errors.New("not in GitHub Actions environment")
+	// ErrNotPullRequest is returned when the workflow wasn't triggered by a pull request.
+	ErrNotPullRequest = errors.New("not triggered by a pull request")
 )
 
 // ActionsEnv tracks GitHub Actions environment variables
@@ -80,17 +83,78 @@ func GetActionsEnv() (ActionsEnv, error) {
 	return envVars, nil
 }
 
-// RepoInfo gets the repository information from the GitHub API.
-func RepoInfo(client *Client, repoOwner, repoName string) error {
-	repo, resp, err := client.Rest.Repositories.Get(context.Background(), repoOwner, repoName)
+// Event is the part of the GitHub Actions event payload at GITHUB_EVENT_PATH that flakeguard uses.
+// Only the fields of the event that triggered the workflow are set.
+// https://docs.github.com/en/webhooks/webhook-events-and-payloads
+type Event struct {
+	PullRequest *PullRequest `json:"pull_request"`
+	MergeGroup  *MergeGroup  `json:"merge_group"`
+	Repository  struct {
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+}
+
+// PullRequest is the pull request that triggered a workflow
+type PullRequest struct {
+	Number int `json:"number"`
+	Head   struct {
+		Ref  string `json:"ref"`
+		SHA  string `json:"sha"`
+		Repo struct {
+			FullName string `json:"full_name"`
+		} `json:"repo"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"base"`
+}
+
+// MergeGroup is the merge queue group that triggered a workflow
+type MergeGroup struct {
+	HeadSHA string `json:"head_sha"`
+	// HeadRef is the merge queue's temporary branch, like refs/heads/gh-readonly-queue/main/pr-1-abc
+	HeadRef string `json:"head_ref"`
+	BaseSHA string `json:"base_sha"`
+	// BaseRef is the branch the group merges into, like refs/heads/main
+	BaseRef string `json:"base_ref"`
+}
+
+// ReadEvent reads the Actions event payload at GITHUB_EVENT_PATH
+func ReadEvent(eventPath string) (Event, error) {
+	//nolint:gosec // G304: the path comes from GitHub Actions
+	payload, err := os.ReadFile(eventPath)
 	if err != nil {
-		return fmt.Errorf("failed to get GitHub repo info: %w", err)
+		return Event{}, fmt.Errorf("failed to read GitHub Actions event payload: %w", err)
+	}
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return Event{}, fmt.Errorf("failed to parse GitHub Actions event payload: %w", err)
 	}
+	return event, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to get GitHub repo info: %s", resp.Status)
+// ReadPullRequest reads the pull request that triggered the workflow from the Actions event payload at
+// GITHUB_EVENT_PATH. It returns ErrNotPullRequest for other events.
+func ReadPullRequest(eventPath string) (PullRequest, error) {
+	if eventPath == "" {
+		return PullRequest{}, ErrNotPullRequest
+	}
+	event, err := ReadEvent(eventPath)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	if event.PullRequest == nil || event.PullRequest.Number == 0 {
+		return PullRequest{}, ErrNotPullRequest
 	}
-	repo.GetDefaultBranch()
+	return *event.PullRequest, nil
+}
 
-	return nil
+// RepoInfo gets the repository from the GitHub API
+func RepoInfo(ctx context.Context, client *Client, repoOwner, repoName string) (*github.Repository, error) {
+	repo, _, err := client.Rest.Repositories.Get(ctx, repoOwner, repoName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GitHub repo info of %s/%s: %w", repoOwner, repoName, err)
+	}
+	return repo, nil
 }
@@ -1,5 +1,36 @@
 package github
 
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPullRequest(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	prEvent := filepath.Join(dir, "pull_request.json")
+	require.NoError(t, os.WriteFile(prEvent, []byte(`{"action":"synchronize","number":42,"pull_request":{"number":42,"head":{"ref":"feature","sha":"abc123","repo":{"full_name":"fork/repo"}},"base":{"ref":"main"}}}`), 0600))
+	pushEvent := filepath.Join(dir, "push.json")
+	require.NoError(t, os.WriteFile(pushEvent, []byte(`{"ref":"refs/heads/main"}`), 0600))
+
+	pr, err := ReadPullRequest(prEvent)
+	require.NoError(t, err)
+	assert.Equal(t, 42, pr.Number)
+	assert.Equal(t, "abc123", pr.Head.SHA)
+	assert.Equal(t, "fork/repo", pr.Head.Repo.FullName)
+	assert.Equal(t, "main", pr.Base.Ref)
+
+	_, err = ReadPullRequest(pushEvent)
+	require.ErrorIs(t, err, ErrNotPullRequest)
+	_, err = ReadPullRequest("")
+	require.ErrorIs(t, err, ErrNotPullRequest)
+}
+
 // This test doesn't work in CI, because we're running in GHA. Not sure if it's worth fixing.
 // func TestActionsEnvVars(t *testing.T) {
 
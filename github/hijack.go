@@ -0,0 +1,115 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/rs/zerolog"
+)
+
+var (
+	// ErrCannotPush is returned when flakeguard can't push to the branch of a pull request, like branches of forks.
+	ErrCannotPush = errors.New("can't push to pull request branch")
+	// ErrNothingToCommit is returned when the edits to a pull request don't change anything.
+	ErrNothingToCommit = errors.New("nothing to commit")
+)
+
+// maxPushAttempts is how many times committing to a pull request is tried when its branch keeps moving
+const maxPushAttempts = 3
+
+// FileEdit changes files of the repository, reading them with read. It returns the new contents of the files it
+// changed, by path.
+type FileEdit func(read ReadFunc) (map[string][]byte, error)
+
+// PullRequestCommit is a commit flakeguard adds to the head branch of a pull request
+type PullRequestCommit struct {
+	Owner  string
+	Repo   string
+	Number int
+	// ExpectedHeadSHA is the head commit the edits were decided on, usually the one the workflow tested
+	ExpectedHeadSHA string
+	Message         string
+	Edit            FileEdit
+}
+
+// PushedCommit is a commit pushed to a pull request
+type PushedCommit struct {
+	SHA    string
+	Branch string
+	// Reapplied is true if the branch moved past the expected head, and the edits were made again on top of it
+	Reapplied bool
+}
+
+// CommitToPullRequest commits the edits on top of the pull request's head branch.
+// Pull requests from forks are refused with ErrCannotPush, the workflow's token can't push to them.
+// The edits are made on the files at the branch's current head, so if it moved past the expected head they're applied
+// to the new code, not the code that was tested. Branches are never force pushed: if someone pushes while the commit
+// is being made, GitHub rejects it and the edits are made again on top of their push, a few times at most.
+func CommitToPullRequest(
+	ctx context.Context,
+	l zerolog.Logger,
+	client *Client,
+	commit PullRequestCommit,
+) (PushedCommit, error) {
+	l = l.With().Int("pull_request", commit.Number).Logger()
+	for attempt := 1; ; attempt++ {
+		pr, _, err := client.Rest.PullRequests.Get(ctx, commit.Owner, commit.Repo, commit.Number)
+		if err != nil {
+			return PushedCommit{}, fmt.Errorf("failed to get pull request #%d: %w", commit.Number, err)
+		}
+		if pr.GetState() != "open" {
+			return PushedCommit{}, fmt.Errorf("%w: pull request #%d is %s", ErrCannotPush, commit.Number, pr.GetState())
+		}
+		head := pr.GetHead()
+		if repo := commit.Owner + "/" + commit.Repo; head.GetRepo().GetFullName() != repo {
+			return PushedCommit{}, fmt.Errorf("%w: #%d is from the fork '%s'", ErrCannotPush, commit.Number, head.GetRepo().GetFullName())
+		}
+
+		pushed := PushedCommit{Branch: head.GetRef(), Reapplied: head.GetSHA() != commit.ExpectedHeadSHA}
+		if pushed.Reapplied {
+			l.Info().
+				Str("expected_head_sha", commit.ExpectedHeadSHA).
+				Str("head_sha", head.GetSHA()).
+				Msg("Pull request branch moved since it was tested, making edits on top of its new head")
+		}
+		files, err := commit.Edit(func(path string) ([]byte, error) {
+			return ReadFile(ctx, client, commit.Owner, commit.Repo, head.GetSHA(), path)
+		})
+		if err != nil {
+			return PushedCommit{}, err
+		}
+		if len(files) == 0 {
+			return PushedCommit{}, ErrNothingToCommit
+		}
+		pushed.SHA, err = CommitFiles(ctx, client, commit.Owner, commit.Repo, head.GetSHA(), commit.Message, files)
+		if err != nil {
+			return PushedCommit{}, err
+		}
+
+		_, resp, err := client.Rest.Git.UpdateRef(ctx, commit.Owner, commit.Repo, &github.Reference{
+			Ref:    github.Ptr("refs/heads/" + head.GetRef()),
+			Object: &github.GitObject{SHA: github.Ptr(pushed.SHA)},
+		}, false)
+		if err == nil {
+			return pushed, nil
+		}
+		// Not a fast forward, someone pushed to the branch since we read it
+		if resp != nil && resp.StatusCode == http.StatusUnprocessableEntity && attempt < maxPushAttempts {
+			l.Warn().Int("attempt", attempt).Msg("Pull request branch moved while committing, trying again")
+			continue
+		}
+		return PushedCommit{}, fmt.Errorf("failed to push to '%s' of pull request #%d: %w", head.GetRef(), commit.Number, err)
+	}
+}
+
+// CreateComment adds a comment to a pull request or issue
+func CreateComment(ctx context.Context, client *Client, owner, repo string, number int, body string) (*github.IssueComment, error) {
+	comment, _, err := client.Rest.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: github.Ptr(body)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to comment on #%d: %w", number, err)
+	}
+	return comment, nil
+}
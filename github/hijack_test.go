@@ -0,0 +1,71 @@
+package github
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/flakeguard/internal/testhelpers"
+)
+
+func TestCommitToPullRequest(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeGitHub()
+	repo := newFakeRepo(map[string]string{"a.go": "a\n"})
+	repo.register(t, fake)
+	client := fake.client(t)
+	ctx := context.Background()
+	l := testhelpers.Logger(t)
+
+	tested := repo.refs["main"]
+	repo.refs["feature"] = tested
+	repo.pulls = []*github.PullRequest{
+		{
+			Number: github.Ptr(1),
+			State:  github.Ptr("open"),
+			Head:   &github.PullRequestBranch{Ref: github.Ptr("feature"), Repo: &github.Repository{FullName: github.Ptr("owner/repo")}},
+		},
+		{
+			Number: github.Ptr(2),
+			State:  github.Ptr("open"),
+			Head:   &github.PullRequestBranch{Ref: github.Ptr("feature"), Repo: &github.Repository{FullName: github.Ptr("someone/repo")}},
+		},
+	}
+	commit := PullRequestCommit{
+		Owner:           "owner",
+		Repo:            "repo",
+		Number:          1,
+		ExpectedHeadSHA: tested,
+		Message:         "Quarantine flaky tests",
+		Edit: func(read ReadFunc) (map[string][]byte, error) {
+			files, _, err := appendLine("quarantined", "a.go")(read)
+			return files, err
+		},
+	}
+
+	// The developer pushes while flakeguard is committing, and once more before it tries again
+	pushes := 0
+	repo.beforeUpdateRef = func(branch string) {
+		if pushes < 2 {
+			pushes++
+			repo.refs[branch] = repo.commit(map[string]string{"a.go": repo.commits[repo.refs[branch]]["a.go"] + "push\n"})
+		}
+	}
+	pushed, err := CommitToPullRequest(ctx, l, client, commit)
+	require.NoError(t, err)
+	assert.Equal(t, "feature", pushed.Branch)
+	assert.True(t, pushed.Reapplied, "edits should be made on top of the developer's pushes")
+	assert.Equal(t, pushed.SHA, repo.refs["feature"])
+	assert.Equal(t, "a\npush\npush\nquarantined\n", repo.files("feature")["a.go"], "no pushes should be lost")
+
+	_, err = CommitToPullRequest(ctx, l, client, commit)
+	require.ErrorIs(t, err, ErrNothingToCommit)
+
+	commit.Number = 2
+	_, err = CommitToPullRequest(ctx, l, client, commit)
+	require.ErrorIs(t, err, ErrCannotPush, "branches of forks can't be pushed to")
+}
@@ -0,0 +1,284 @@
+package github
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/rs/zerolog"
+
+	"github.com/smartcontractkit/flakeguard/ticket"
+)
+
+const (
+	// FlakyTestLabel labels every issue flakeguard opens
+	FlakyTestLabel = "flaky-test"
+	// QuarantinedLabel labels the issues of tests that are quarantined on the base branch
+	QuarantinedLabel = "quarantined"
+	// maxLabelLength is the longest label name GitHub accepts
+	maxLabelLength = 50
+)
+
+// issueMarkerRe finds the test an issue tracks from the hidden marker in its body
+var issueMarkerRe = regexp.MustCompile(`^<!-- flakeguard:test (\S+) (\S+) -->`)
+
+// IssueTicketer tracks flaky tests with GitHub Issues, one issue per test. Issues are found again by a hidden marker
+// in their body, so their titles and labels can be edited freely.
+type IssueTicketer struct {
+	l      zerolog.Logger
+	client *Client
+	owner  string
+	repo   string
+	// issues flakeguard opened, by marker, listed on first use
+	issues map[string]*github.Issue
+	// assignable caches whether users can be assigned issues in the repository
+	assignable map[string]bool
+}
+
+var _ ticket.Ticketer = (*IssueTicketer)(nil)
+
+// NewIssueTicketer creates a ticketer opening issues in owner/repo
+func NewIssueTicketer(l zerolog.Logger, client *Client, owner, repo string) *IssueTicketer {
+	return &IssueTicketer{
+		l:          l.With().Str("ticketer", "github").Logger(),
+		client:     client,
+		owner:      owner,
+		repo:       repo,
+		assignable: map[string]bool{},
+	}
+}
+
+func issueMarker(pkg, test string) string {
+	return fmt.Sprintf("<!-- flakeguard:test %s %s -->", pkg, test)
+}
+
+// Report opens an issue for the flaky test, labeled and assigned to its code owners, or comments the occurrence on
+// its existing issue, reopening it if it was closed
+func (t *IssueTicketer) Report(ctx context.Context, o ticket.Occurrence) (ticket.Ticket, error) {
+	if err := t.listIssues(ctx); err != nil {
+		return ticket.Ticket{}, err
+	}
+	marker := issueMarker(o.Package, o.Test)
+	l := t.l.With().Str("package", o.Package).Str("test", o.Test).Logger()
+
+	issue, ok := t.issues[marker]
+	if !ok {
+		assignees, err := t.assignees(ctx, o.Owners)
+		if err != nil {
+			return ticket.Ticket{}, err
+		}
+		issue, _, err = t.client.Rest.Issues.Create(ctx, t.owner, t.repo, &github.IssueRequest{
+			Title:     github.Ptr(fmt.Sprintf("Flaky test: %s (%s)", o.Test, o.Package)),
+			Body:      github.Ptr(marker + "\n" + issueBody(o)),
+			Labels:    &[]string{FlakyTestLabel, packageLabel(o.Package)},
+			Assignees: &assignees,
+		})
+		if err != nil {
+			return ticket.Ticket{}, fmt.Errorf("failed to open issue for %s in %s: %w", o.Test, o.Package, err)
+		}
+		t.issues[marker] = issue
+		l.Info().Int("issue", issue.GetNumber()).Strs("assignees", assignees).Msg("Opened issue for flaky test")
+		created := issueTicket(o.Package, o.Test, issue)
+		created.Created = true
+		return created, nil
+	}
+
+	comment := "Still flaky: " + occurrenceSummary(o)
+	if issue.GetState() == "closed" {
+		comment = "Flaky again: " + occurrenceSummary(o)
+		reopened, _, err := t.client.Rest.Issues.Edit(ctx, t.owner, t.repo, issue.GetNumber(),
+			&github.IssueRequest{State: github.Ptr("open")},
+		)
+		if err != nil {
+			return ticket.Ticket{}, fmt.Errorf("failed to reopen issue #%d: %w", issue.GetNumber(), err)
+		}
+		issue = reopened
+		t.issues[marker] = issue
+		l.Info().Int("issue", issue.GetNumber()).Msg("Reopened issue for flaky test")
+	}
+	if _, err := CreateComment(ctx, t.client, t.owner, t.repo, issue.GetNumber(), comment); err != nil {
+		return ticket.Ticket{}, err
+	}
+	return issueTicket(o.Package, o.Test, issue), nil
+}
+
+// Open lists the open issues flakeguard opened
+func (t *IssueTicketer) Open(ctx context.Context) ([]ticket.Ticket, error) {
+	if err := t.listIssues(ctx); err != nil {
+		return nil, err
+	}
+	var open []ticket.Ticket
+	for _, issue := range t.issues {
+		if issue.GetState() != "open" {
+			continue
+		}
+		match := issueMarkerRe.FindStringSubmatch(issue.GetBody())
+		open = append(open, issueTicket(match[1], match[2], issue))
+	}
+	slices.SortFunc(open, func(a, b ticket.Ticket) int {
+		return cmp.Or(cmp.Compare(a.Package, b.Package), cmp.Compare(a.Test, b.Test))
+	})
+	return open, nil
+}
+
+// MarkQuarantined labels the test's issue as quarantined
+func (t *IssueTicketer) MarkQuarantined(ctx context.Context, tk ticket.Ticket) error {
+	if err := t.listIssues(ctx); err != nil {
+		return err
+	}
+	issue, ok := t.issues[issueMarker(tk.Package, tk.Test)]
+	if !ok || hasLabel(issue, QuarantinedLabel) {
+		return nil
+	}
+	labels, _, err := t.client.Rest.Issues.AddLabelsToIssue(ctx, t.owner, t.repo, issue.GetNumber(), []string{QuarantinedLabel})
+	if err != nil {
+		return fmt.Errorf("failed to label issue #%d as quarantined: %w", issue.GetNumber(), err)
+	}
+	issue.Labels = labels
+	t.l.Info().Str("package", tk.Package).Str("test", tk.Test).Int("issue", issue.GetNumber()).Msg("Labeled issue of quarantined test")
+	return nil
+}
+
+// Close comments the reason on the test's issue and closes it as completed. The quarantined label is removed, so the
+// issue isn't taken for quarantined if the test is flaky again.
+func (t *IssueTicketer) Close(ctx context.Context, tk ticket.Ticket, reason string) error {
+	if err := t.listIssues(ctx); err != nil {
+		return err
+	}
+	marker := issueMarker(tk.Package, tk.Test)
+	issue, ok := t.issues[marker]
+	if !ok || issue.GetState() == "closed" {
+		return nil
+	}
+	if _, err := CreateComment(ctx, t.client, t.owner, t.repo, issue.GetNumber(), reason); err != nil {
+		return err
+	}
+	if hasLabel(issue, QuarantinedLabel) {
+		if _, err := t.client.Rest.Issues.RemoveLabelForIssue(ctx, t.owner, t.repo, issue.GetNumber(), QuarantinedLabel); err != nil {
+			return fmt.Errorf("failed to remove quarantined label from issue #%d: %w", issue.GetNumber(), err)
+		}
+	}
+	closed, _, err := t.client.Rest.Issues.Edit(ctx, t.owner, t.repo, issue.GetNumber(),
+		&github.IssueRequest{State: github.Ptr("closed"), StateReason: github.Ptr("completed")},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to close issue #%d: %w", issue.GetNumber(), err)
+	}
+	t.issues[marker] = closed
+	t.l.Info().Str("package", tk.Package).Str("test", tk.Test).Int("issue", issue.GetNumber()).Msg("Closed issue for flaky test")
+	return nil
+}
+
+// listIssues lists every issue with the flaky test label that has flakeguard's marker, open or closed, once
+func (t *IssueTicketer) listIssues(ctx context.Context) error {
+	if t.issues != nil {
+		return nil
+	}
+	issues := map[string]*github.Issue{}
+	opts := &github.IssueListByRepoOptions{
+		State:       "all",
+		Labels:      []string{FlakyTestLabel},
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		page, resp, err := t.client.Rest.Issues.ListByRepo(ctx, t.owner, t.repo, opts)
+		if err != nil {
+			return fmt.Errorf("failed to list issues labeled '%s': %w", FlakyTestLabel, err)
+		}
+		for _, issue := range page {
+			match := issueMarkerRe.FindStringSubmatch(issue.GetBody())
+			if issue.IsPullRequest() || match == nil {
+				continue
+			}
+			marker := issueMarker(match[1], match[2])
+			// Keep the newest issue if a test somehow has several
+			if existing, ok := issues[marker]; !ok || existing.GetNumber() < issue.GetNumber() {
+				issues[marker] = issue
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.ListOptions.Page = resp.NextPage
+	}
+	t.issues = issues
+	return nil
+}
+
+// assignees picks the users among the code owners that can be assigned issues. Teams and emails can't be assigned.
+func (t *IssueTicketer) assignees(ctx context.Context, owners []string) ([]string, error) {
+	assignees := []string{}
+	for _, owner := range owners {
+		user, ok := strings.CutPrefix(owner, "@")
+		if !ok || strings.Contains(user, "/") {
+			continue
+		}
+		assignable, ok := t.assignable[user]
+		if !ok {
+			var err error
+			assignable, _, err = t.client.Rest.Issues.IsAssignee(ctx, t.owner, t.repo, user)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check whether %s can be assigned issues: %w", user, err)
+			}
+			t.assignable[user] = assignable
+		}
+		if assignable {
+			assignees = append(assignees, user)
+		}
+	}
+	return assignees, nil
+}
+
+// packageLabel labels issues by the test's package, dropping leading path elements that don't fit in a label
+func packageLabel(pkg string) string {
+	for len(pkg) > maxLabelLength {
+		_, rest, ok := strings.Cut(pkg, "/")
+		if !ok {
+			return pkg[len(pkg)-maxLabelLength:]
+		}
+		pkg = rest
+	}
+	return pkg
+}
+
+func issueTicket(pkg, test string, issue *github.Issue) ticket.Ticket {
+	return ticket.Ticket{
+		Package:     pkg,
+		Test:        test,
+		ID:          fmt.Sprintf("#%d", issue.GetNumber()),
+		URL:         issue.GetHTMLURL(),
+		Quarantined: hasLabel(issue, QuarantinedLabel),
+	}
+}
+
+func hasLabel(issue *github.Issue, name string) bool {
+	return slices.ContainsFunc(issue.Labels, func(label *github.Label) bool { return label.GetName() == name })
+}
+
+func issueBody(o ticket.Occurrence) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### :snowflake: `%s` is flaky\n\n", o.Test)
+	fmt.Fprintf(&b, "`%s` in `%s`", o.Test, o.Package)
+	if o.Path != "" {
+		fmt.Fprintf(&b, " (`%s`)", o.Path)
+	}
+	fmt.Fprintf(&b, " %s\n\n", occurrenceSummary(o))
+	if len(o.Owners) > 0 {
+		fmt.Fprintf(&b, "Code owners: %s\n\n", strings.Join(o.Owners, " "))
+	}
+	b.WriteString("Flakeguard comments here when the test is flaky again, and closes this issue once the test is reinstated.\n")
+	return b.String()
+}
+
+// occurrenceSummary describes how flaky the test was, like "failed 10.00% of 50 runs on `main`."
+func occurrenceSummary(o ticket.Occurrence) string {
+	summary := fmt.Sprintf("failed %.2f%% of %d runs on `%s`.", o.FlakeRate*100, o.Runs, o.Branch)
+	if o.Link != "" {
+		summary += fmt.Sprintf(" [Details](%s)", o.Link)
+	}
+	return summary
+}
@@ -0,0 +1,203 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/flakeguard/internal/testhelpers"
+	"github.com/smartcontractkit/flakeguard/ticket"
+)
+
+// fakeIssues fakes the issues of owner/repo and their comments
+type fakeIssues struct {
+	issues   []*github.Issue
+	comments map[int][]string
+	// assignable users of the repository
+	assignable []string
+}
+
+func (f *fakeIssues) register(t *testing.T, fake *fakeGitHub) {
+	t.Helper()
+	fake.mux.HandleFunc("GET /repos/owner/repo/issues", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "all", r.URL.Query().Get("state"))
+		labeled := []*github.Issue{}
+		for _, issue := range f.issues {
+			for _, label := range issue.Labels {
+				if label.GetName() == r.URL.Query().Get("labels") {
+					labeled = append(labeled, issue)
+				}
+			}
+		}
+		// One issue per page, to exercise pagination
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		page = max(page, 1)
+		if page < len(labeled) {
+			w.Header().Set("Link", fmt.Sprintf(`<https://api.github.com/repos/owner/repo/issues?page=%d>; rel="next"`, page+1))
+		}
+		if page > len(labeled) {
+			writeJSON(t, w, http.StatusOK, []*github.Issue{})
+			return
+		}
+		writeJSON(t, w, http.StatusOK, labeled[page-1:page])
+	})
+	fake.mux.HandleFunc("POST /repos/owner/repo/issues", func(w http.ResponseWriter, r *http.Request) {
+		var request github.IssueRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		issue := &github.Issue{
+			Number:  github.Ptr(len(f.issues) + 1),
+			State:   github.Ptr("open"),
+			Title:   request.Title,
+			Body:    request.Body,
+			HTMLURL: github.Ptr(fmt.Sprintf("https://github.com/owner/repo/issues/%d", len(f.issues)+1)),
+		}
+		for _, label := range request.GetLabels() {
+			issue.Labels = append(issue.Labels, &github.Label{Name: github.Ptr(label)})
+		}
+		for _, assignee := range request.GetAssignees() {
+			issue.Assignees = append(issue.Assignees, &github.User{Login: github.Ptr(assignee)})
+		}
+		f.issues = append(f.issues, issue)
+		writeJSON(t, w, http.StatusCreated, issue)
+	})
+	fake.mux.HandleFunc("PATCH /repos/owner/repo/issues/{number}", func(w http.ResponseWriter, r *http.Request) {
+		number, _ := strconv.Atoi(r.PathValue("number"))
+		var request github.IssueRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		issue := f.issues[number-1]
+		issue.State = request.State
+		issue.StateReason = request.StateReason
+		writeJSON(t, w, http.StatusOK, issue)
+	})
+	fake.mux.HandleFunc("POST /repos/owner/repo/issues/{number}/comments", func(w http.ResponseWriter, r *http.Request) {
+		number, _ := strconv.Atoi(r.PathValue("number"))
+		var comment github.IssueComment
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+		f.comments[number] = append(f.comments[number], comment.GetBody())
+		writeJSON(t, w, http.StatusCreated, comment)
+	})
+	fake.mux.HandleFunc("POST /repos/owner/repo/issues/{number}/labels", func(w http.ResponseWriter, r *http.Request) {
+		number, _ := strconv.Atoi(r.PathValue("number"))
+		var labels []string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&labels))
+		issue := f.issues[number-1]
+		for _, label := range labels {
+			issue.Labels = append(issue.Labels, &github.Label{Name: github.Ptr(label)})
+		}
+		writeJSON(t, w, http.StatusOK, issue.Labels)
+	})
+	fake.mux.HandleFunc("DELETE /repos/owner/repo/issues/{number}/labels/{name}", func(w http.ResponseWriter, r *http.Request) {
+		number, _ := strconv.Atoi(r.PathValue("number"))
+		issue := f.issues[number-1]
+		issue.Labels = slices.DeleteFunc(issue.Labels, func(label *github.Label) bool { return label.GetName() == r.PathValue("name") })
+		writeJSON(t, w, http.StatusOK, issue.Labels)
+	})
+	fake.mux.HandleFunc("GET /repos/owner/repo/assignees/{user}", func(w http.ResponseWriter, r *http.Request) {
+		for _, user := range f.assignable {
+			if user == r.PathValue("user") {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+}
+
+func TestIssueTicketer(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeGitHub()
+	issues := &fakeIssues{
+		issues: []*github.Issue{
+			{
+				Number: github.Ptr(1),
+				State:  github.Ptr("open"),
+				Body:   github.Ptr("Someone else's issue about flaky tests"),
+				Labels: []*github.Label{{Name: github.Ptr(FlakyTestLabel)}},
+			},
+		},
+		comments:   map[int][]string{},
+		assignable: []string{"alice"},
+	}
+	issues.register(t, fake)
+	client := fake.client(t)
+	ctx := context.Background()
+
+	occurrence := ticket.Occurrence{
+		Package:   "github.com/owner/repo/pkg",
+		Test:      "TestFlaky",
+		Branch:    "main",
+		FlakeRate: 0.1,
+		Runs:      50,
+		Path:      "pkg/flaky_test.go",
+		Owners:    []string{"@alice", "@bob", "@owner/team", "dev@example.com"},
+		Link:      "https://github.com/owner/repo/pull/3",
+	}
+	ticketer := NewIssueTicketer(testhelpers.Logger(t), client, "owner", "repo")
+	reported, err := ticketer.Report(ctx, occurrence)
+	require.NoError(t, err)
+	assert.True(t, reported.Created)
+	assert.Equal(t, "#2", reported.ID)
+	assert.Equal(t, "https://github.com/owner/repo/issues/2", reported.URL)
+	created := issues.issues[1]
+	assert.True(t, strings.HasPrefix(created.GetBody(), "<!-- flakeguard:test github.com/owner/repo/pkg TestFlaky -->\n"))
+	assert.Contains(t, created.GetBody(), "failed 10.00% of 50 runs on `main`")
+	assert.Equal(t, []*github.Label{{Name: github.Ptr(FlakyTestLabel)}, {Name: github.Ptr("github.com/owner/repo/pkg")}}, created.Labels)
+	assert.Equal(t, []*github.User{{Login: github.Ptr("alice")}}, created.Assignees, "only code owners that can be assigned should be")
+
+	// A new ticketer finds the issue again by its marker
+	ticketer = NewIssueTicketer(testhelpers.Logger(t), client, "owner", "repo")
+	reported, err = ticketer.Report(ctx, occurrence)
+	require.NoError(t, err)
+	assert.False(t, reported.Created)
+	assert.Equal(t, "#2", reported.ID)
+	assert.Len(t, issues.issues, 2, "issue shouldn't be duplicated")
+	assert.Equal(t, []string{"Still flaky: failed 10.00% of 50 runs on `main`. [Details](https://github.com/owner/repo/pull/3)"}, issues.comments[2])
+
+	open, err := ticketer.Open(ctx)
+	require.NoError(t, err)
+	require.Len(t, open, 1)
+	assert.Equal(t, "github.com/owner/repo/pkg", open[0].Package)
+	assert.Equal(t, "TestFlaky", open[0].Test)
+	assert.False(t, open[0].Quarantined)
+
+	require.NoError(t, ticketer.MarkQuarantined(ctx, open[0]))
+	require.NoError(t, ticketer.MarkQuarantined(ctx, open[0]), "marking twice should be a no-op")
+	assert.True(t, hasLabel(created, QuarantinedLabel))
+	assert.Len(t, created.Labels, 3)
+	open, err = NewIssueTicketer(testhelpers.Logger(t), client, "owner", "repo").Open(ctx)
+	require.NoError(t, err)
+	require.Len(t, open, 1)
+	assert.True(t, open[0].Quarantined, "quarantined label should be read back")
+
+	require.NoError(t, ticketer.Close(ctx, open[0], "Reinstated"))
+	assert.Equal(t, "closed", created.GetState())
+	assert.Equal(t, "completed", created.GetStateReason())
+	assert.False(t, hasLabel(created, QuarantinedLabel), "closed issues shouldn't stay labeled as quarantined")
+	open, err = ticketer.Open(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, open)
+
+	reported, err = ticketer.Report(ctx, occurrence)
+	require.NoError(t, err)
+	assert.Equal(t, "#2", reported.ID)
+	assert.Equal(t, "open", created.GetState(), "issue should be reopened when the test is flaky again")
+	assert.Len(t, issues.comments[2], 3)
+}
+
+func TestPackageLabel(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "github.com/owner/repo/pkg", packageLabel("github.com/owner/repo/pkg"))
+	assert.Equal(t, "core/services/ocr2/plugins/ccip/internal/ccipdata", packageLabel("github.com/smartcontractkit/chainlink/v2/core/services/ocr2/plugins/ccip/internal/ccipdata"))
+	assert.Len(t, packageLabel(strings.Repeat("a", 60)), maxLabelLength)
+}
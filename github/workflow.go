@@ -0,0 +1,81 @@
+package github
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Levels of workflow command annotations
+const (
+	AnnotationError   = "error"
+	AnnotationWarning = "warning"
+	AnnotationNotice  = "notice"
+)
+
+// Workflow commands are written to stdout for the runner to pick up, their data and properties escaped
+// https://docs.github.com/en/actions/writing-workflows/choosing-what-your-workflow-does/workflow-commands-for-github-actions
+var (
+	dataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	propertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// StartGroup starts a collapsible group in the workflow log, and returns the function that ends it
+func StartGroup(w io.Writer, title string) (end func()) {
+	_, _ = fmt.Fprintf(w, "::group::%s\n", dataEscaper.Replace(title))
+	return func() {
+		_, _ = fmt.Fprintln(w, "::endgroup::")
+	}
+}
+
+// WriteAnnotation writes a workflow command annotating a line of a file at the level, shown in the workflow run's
+// summary and in pull request diffs
+func WriteAnnotation(w io.Writer, level string, annotation Annotation) error {
+	properties := []string{"file=" + propertyEscaper.Replace(annotation.Path)}
+	if annotation.Line > 0 {
+		properties = append(properties, fmt.Sprintf("line=%d", annotation.Line))
+	}
+	if annotation.Title != "" {
+		properties = append(properties, "title="+propertyEscaper.Replace(annotation.Title))
+	}
+	message := annotation.Message
+	if annotation.RawDetails != "" {
+		message += "\n\n" + annotation.RawDetails
+	}
+	_, err := fmt.Fprintf(w, "::%s %s::%s\n", level, strings.Join(properties, ","), dataEscaper.Replace(message))
+	return err
+}
+
+// SetOutputs sets the outputs of the workflow step by appending them to the GITHUB_OUTPUT file, so later steps can
+// use them. Values spanning several lines are written between delimiters.
+func SetOutputs(outputPath string, outputs map[string]string) error {
+	var b strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(outputs)) {
+		value := outputs[name]
+		if !strings.ContainsAny(value, "\r\n") {
+			fmt.Fprintf(&b, "%s=%s\n", name, value)
+			continue
+		}
+		delimiter := make([]byte, 8)
+		if _, err := rand.Read(delimiter); err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s<<ghadelimiter_%[2]s\n%s\nghadelimiter_%[2]s\n", name, hex.EncodeToString(delimiter), value)
+	}
+
+	//nolint:gosec // G304: the path comes from GitHub Actions
+	file, err := os.OpenFile(outputPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open GITHUB_OUTPUT file: %w", err)
+	}
+	if _, err := file.WriteString(b.String()); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write step outputs: %w", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,47 @@
+package github
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkflowCommands(t *testing.T) {
+	t.Parallel()
+
+	var b strings.Builder
+	end := StartGroup(&b, "Run 1")
+	b.WriteString("output\n")
+	end()
+	require.NoError(t, WriteAnnotation(&b, AnnotationWarning, Annotation{
+		Path:       "pkg/a_test.go",
+		Line:       12,
+		Title:      "TestFlaky is flaky (timeout)",
+		Message:    "Passed 9 of 10 runs (90.00%)\na_test.go:14: 100% broken",
+		RawDetails: "Reproduce:\ngo test -run TestFlaky",
+	}))
+	assert.Equal(t, "::group::Run 1\noutput\n::endgroup::\n"+
+		"::warning file=pkg/a_test.go,line=12,title=TestFlaky is flaky (timeout)::"+
+		"Passed 9 of 10 runs (90.00%25)%0Aa_test.go:14: 100%25 broken%0A%0AReproduce:%0Ago test -run TestFlaky\n",
+		b.String())
+
+	b.Reset()
+	require.NoError(t, WriteAnnotation(&b, AnnotationError, Annotation{Path: "a,b:c.go", Title: "x, y: z", Message: "m"}))
+	assert.Equal(t, "::error file=a%2Cb%3Ac.go,title=x%2C y%3A z::m\n", b.String())
+}
+
+func TestSetOutputs(t *testing.T) {
+	t.Parallel()
+
+	outputPath := filepath.Join(t.TempDir(), "output")
+	require.NoError(t, os.WriteFile(outputPath, []byte("earlier=step\n"), 0600))
+	require.NoError(t, SetOutputs(outputPath, map[string]string{"verdict": "flaky", "flaky_tests": "2", "summary": "a\nb"}))
+	content, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^earlier=step\nflaky_tests=2\nsummary<<(ghadelimiter_[0-9a-f]{16})\na\nb\n(ghadelimiter_[0-9a-f]{16})\nverdict=flaky\n$`), string(content))
+}
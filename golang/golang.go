@@ -2,66 +2,279 @@
 package golang
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/parser"
 	"go/token"
+	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/rs/zerolog"
+	"golang.org/x/mod/modfile"
 	"golang.org/x/tools/go/packages"
 )
 
-// Absolute path to root directory -> PackageInfo
+// flakeguardImportPath is the package with the Quarantine function
+const flakeguardImportPath = "github.com/smartcontractkit/flakeguard"
+
+// Absolute path to root directory and build flags -> PackageInfo
 var (
 	packagesCache      = map[string][]PackageInfo{}
 	packagesCacheMutex = sync.RWMutex{}
 
 	// ErrTestNotFound is returned when a test is not found in the go code.
 	ErrTestNotFound = errors.New("test not found")
+	// ErrAlreadyQuarantined is returned when a test already calls flakeguard.Quarantine.
+	ErrAlreadyQuarantined = errors.New("test already quarantined")
+	// ErrCannotQuarantine is returned when a test can't be quarantined automatically.
+	ErrCannotQuarantine = errors.New("test can't be quarantined automatically")
 )
 
-// QuarantineTest adds a quarantine call to a test.
-// TODO: Implement to add the quarantine call to a test function
-func QuarantineTest() error {
-	// TODO: See if we can borrow gotestsum's approach: https://github.com/gotestyourself/gotestsum/tree/v1.12.2/cmd/tool/slowest
-	return errors.New("not implemented")
+// QuarantineTest adds a flakeguard.Quarantine call to the start of a top-level test function in the source of a Go
+// file, importing flakeguard if needed, and returns the formatted source. Only top-level tests can be quarantined
+// this way, subtests have to be quarantined by hand.
+func QuarantineTest(src []byte, testName, message string) ([]byte, error) {
+	if strings.Contains(testName, "/") {
+		return nil, fmt.Errorf("%w: '%s' is a subtest", ErrCannotQuarantine, testName)
+	}
+	fset := token.NewFileSet()
+	fileAst, err := parser.ParseFile(fset, "", src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing source: %w", err)
+	}
+
+	fn := findTestFunc(fileAst, testName)
+	if fn == nil {
+		return nil, fmt.Errorf("%w: '%s'", ErrTestNotFound, testName)
+	}
+	params := fn.Type.Params.List
+	if len(params) != 1 || len(params[0].Names) != 1 || params[0].Names[0].Name == "_" {
+		return nil, fmt.Errorf("%w: '%s' doesn't take a named *testing.T", ErrCannotQuarantine, testName)
+	}
+	t := params[0].Names[0].Name
+
+	pkgName, imported := importName(fileAst, flakeguardImportPath)
+	if pkgName == "" {
+		pkgName = "flakeguard"
+	}
+	if imported {
+		for _, stmt := range fn.Body.List {
+			if isQuarantineCall(stmt, pkgName) {
+				return nil, fmt.Errorf("%w: '%s'", ErrAlreadyQuarantined, testName)
+			}
+		}
+	}
+
+	// Edit the source as text and format it after, so the rest of the file is left as it was
+	edits := []textEdit{{
+		offset: fset.Position(fn.Body.Lbrace).Offset + 1,
+		text:   fmt.Sprintf("\n%s.Quarantine(%s, %s);", pkgName, t, strconv.Quote(message)),
+	}}
+	if !imported {
+		edits = append(edits, addImport(src, fset, fileAst, flakeguardImportPath)...)
+	}
+	edited := applyEdits(src, edits)
+	formatted, err := format.Source(edited)
+	if err != nil {
+		return nil, fmt.Errorf("error formatting quarantined source: %w", err)
+	}
+	return formatted, nil
+}
+
+// IsQuarantined reports whether a top-level test function in the source of a Go file starts with a
+// flakeguard.Quarantine call
+func IsQuarantined(src []byte, testName string) (bool, error) {
+	fileAst, err := parser.ParseFile(token.NewFileSet(), "", src, parser.SkipObjectResolution)
+	if err != nil {
+		return false, fmt.Errorf("error parsing source: %w", err)
+	}
+	fn := findTestFunc(fileAst, testName)
+	if fn == nil {
+		return false, fmt.Errorf("%w: '%s'", ErrTestNotFound, testName)
+	}
+	pkgName, imported := importName(fileAst, flakeguardImportPath)
+	if !imported {
+		return false, nil
+	}
+	return slices.ContainsFunc(fn.Body.List, func(stmt ast.Stmt) bool {
+		return isQuarantineCall(stmt, cmp.Or(pkgName, "flakeguard"))
+	}), nil
+}
+
+// RequiresFlakeguard reports whether the module dir is in requires flakeguard, or is flakeguard itself, so its tests
+// can be quarantined without breaking the build. Directories outside of any module don't.
+func RequiresFlakeguard(dir string) (bool, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+	for {
+		goModPath := filepath.Join(dir, "go.mod")
+		//nolint:gosec // G304: reading the go.mod of the code being quarantined
+		content, err := os.ReadFile(goModPath)
+		if err == nil {
+			modFile, err := modfile.ParseLax(goModPath, content, nil)
+			if err != nil {
+				return false, fmt.Errorf("failed to parse %s: %w", goModPath, err)
+			}
+			if modFile.Module != nil && modFile.Module.Mod.Path == flakeguardImportPath {
+				return true, nil
+			}
+			return slices.ContainsFunc(modFile.Require, func(r *modfile.Require) bool {
+				return r.Mod.Path == flakeguardImportPath
+			}), nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Errorf("failed to read %s: %w", goModPath, err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false, nil
+		}
+		dir = parent
+	}
+}
+
+// findTestFunc returns the top-level function with a body named testName, or nil if there isn't one
+func findTestFunc(fileAst *ast.File, testName string) *ast.FuncDecl {
+	for _, decl := range fileAst.Decls {
+		if d, ok := decl.(*ast.FuncDecl); ok && d.Recv == nil && d.Name.Name == testName && d.Body != nil {
+			return d
+		}
+	}
+	return nil
+}
+
+// importName returns the name the file refers to the imported package by, and whether it imports it at all
+func importName(fileAst *ast.File, importPath string) (string, bool) {
+	for _, spec := range fileAst.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err != nil || path != importPath {
+			continue
+		}
+		if spec.Name != nil {
+			return spec.Name.Name, true
+		}
+		return "", true
+	}
+	return "", false
+}
+
+// isQuarantineCall reports whether the statement is a pkgName.Quarantine(...) call
+func isQuarantineCall(stmt ast.Stmt, pkgName string) bool {
+	expr, ok := stmt.(*ast.ExprStmt)
+	if !ok {
+		return false
+	}
+	call, ok := expr.X.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	return ok && ident.Name == pkgName && sel.Sel.Name == "Quarantine"
+}
+
+// textEdit inserts text at a byte offset of a file
+type textEdit struct {
+	offset int
+	text   string
+}
+
+// addImport adds the import to the last import group if it already has third-party imports, or in a new group after
+// the standard library ones. format.Source sorts it into place within its group.
+func addImport(src []byte, fset *token.FileSet, fileAst *ast.File, importPath string) []textEdit {
+	spec := strconv.Quote(importPath)
+	var last *ast.GenDecl
+	for _, decl := range fileAst.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			last = d
+		}
+	}
+	if last == nil {
+		return []textEdit{{offset: fset.Position(fileAst.Name.End()).Offset, text: "\n\nimport " + spec}}
+	}
+	if !last.Lparen.IsValid() {
+		// Turn the single import into a block
+		return []textEdit{
+			{offset: fset.Position(last.Specs[0].Pos()).Offset, text: "(\n"},
+			{offset: fset.Position(last.End()).Offset, text: "\n\n" + spec + "\n)"},
+		}
+	}
+
+	thirdParty := false
+	for _, s := range last.Specs {
+		path, _ := strconv.Unquote(s.(*ast.ImportSpec).Path.Value)
+		if first, _, _ := strings.Cut(path, "/"); strings.Contains(first, ".") {
+			thirdParty = true
+		}
+	}
+	rparen := fset.Position(last.Rparen).Offset
+	text := spec + "\n"
+	if !thirdParty {
+		text = "\n" + text
+	}
+	if rparen == 0 || src[rparen-1] != '\n' {
+		text = "\n" + text
+	}
+	return []textEdit{{offset: rparen, text: text}}
+}
+
+// applyEdits inserts the edits into the source, in any order
+func applyEdits(src []byte, edits []textEdit) []byte {
+	slices.SortFunc(edits, func(a, b textEdit) int { return b.offset - a.offset })
+	out := slices.Clone(src)
+	for _, edit := range edits {
+		out = slices.Insert(out, edit.offset, []byte(edit.text)...)
+	}
+	return out
 }
 
 // TestLocation contains information about where a test function is located
 type TestLocation struct {
-	FilePath   string // Relative path to the file containing the test
+	FilePath   string // Absolute path to the file containing the test
 	LineNumber int    // Line number where the test function is defined
 }
 
-// FindTestLocation finds the location of a test function in a package
-func FindTestLocation(l zerolog.Logger, rootDir, pkgImportPath, testName string) (*TestLocation, error) {
+// FindTestLocation finds the location of a test function in a package.
+// Subtests are located at the test function they belong to.
+func FindTestLocation(l zerolog.Logger, rootDir, pkgImportPath, testName string, buildFlags ...string) (*TestLocation, error) {
 	l = l.With().Str("rootDir", rootDir).Str("pkgImportPath", pkgImportPath).Str("testName", testName).Logger()
 	l.Trace().Msg("Finding test location")
 	start := time.Now()
 
-	pkgs, err := Packages(l, rootDir)
+	pkgs, err := Packages(l, rootDir, buildFlags...)
 	if err != nil {
 		return nil, err
 	}
 
 	var testLocation *TestLocation
+	testFunc, _, _ := strings.Cut(testName, "/")
 
+pkgLoop:
 	for _, pkg := range pkgs {
-		if pkg.ImportPath == pkgImportPath {
-			for _, testFile := range pkg.TestGoFiles {
-				testLocation, err = findTestInFile(testFile, testName)
-				if err != nil {
-					return nil, fmt.Errorf("error finding test '%s' in file '%s': %w", testName, testFile, err)
-				}
-				if testLocation != nil {
-					break
-				}
+		if pkg.ImportPath != pkgImportPath {
+			continue
+		}
+		for _, testFile := range pkg.TestGoFiles {
+			testLocation, err = findTestInFile(testFile, testFunc)
+			if err != nil {
+				return nil, fmt.Errorf("error finding test '%s' in file '%s': %w", testName, testFile, err)
+			}
+			if testLocation != nil {
+				break pkgLoop
 			}
 		}
 	}
@@ -127,15 +340,17 @@ type PackageInfo struct {
 	IsCommand    bool     // True if this is a main package
 }
 
-// Packages finds all Go packages in the given directory and subdirectories
-func Packages(l zerolog.Logger, rootDir string) ([]PackageInfo, error) {
+// Packages finds all Go packages in the given directory and subdirectories.
+// Build flags (e.g. -tags=integration) decide which files are part of the packages, the same way they do for go build.
+func Packages(l zerolog.Logger, rootDir string, buildFlags ...string) ([]PackageInfo, error) {
 	absRootDir, err := filepath.Abs(rootDir)
 	if err != nil {
 		return nil, err
 	}
+	cacheKey := strings.Join(append([]string{absRootDir}, buildFlags...), " ")
 
 	packagesCacheMutex.RLock()
-	cachedPackages, ok := packagesCache[absRootDir]
+	cachedPackages, ok := packagesCache[cacheKey]
 	packagesCacheMutex.RUnlock()
 	if ok {
 		return cachedPackages, nil
@@ -145,9 +360,10 @@ func Packages(l zerolog.Logger, rootDir string) ([]PackageInfo, error) {
 	l.Trace().Msg("Loading packages")
 	start := time.Now()
 	config := &packages.Config{
-		Mode:  packages.NeedName | packages.NeedModule | packages.NeedFiles,
-		Dir:   rootDir,
-		Tests: true,
+		Mode:       packages.NeedName | packages.NeedModule | packages.NeedFiles,
+		Dir:        rootDir,
+		Tests:      true,
+		BuildFlags: buildFlags,
 	}
 
 	// Use "./..." pattern to find all packages recursively
@@ -196,7 +412,7 @@ func Packages(l zerolog.Logger, rootDir string) ([]PackageInfo, error) {
 	})
 
 	packagesCacheMutex.Lock()
-	packagesCache[absRootDir] = result
+	packagesCache[cacheKey] = result
 	packagesCacheMutex.Unlock()
 
 	for _, pkg := range result {
@@ -215,3 +431,60 @@ func Packages(l zerolog.Logger, rootDir string) ([]PackageInfo, error) {
 	l.Trace().Str("duration", time.Since(start).String()).Msg("Loaded packages")
 	return result, nil
 }
+
+// TestNames lists the top-level test functions of a package in the order go test runs them:
+// tests in the package's own _test.go files first, then tests in its external _test package, each in file and
+// declaration order.
+func TestNames(l zerolog.Logger, rootDir, pkgImportPath string, buildFlags ...string) ([]string, error) {
+	pkgs, err := Packages(l, rootDir, buildFlags...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Test variants of the same package list the same test files, only look at each once
+	testFiles := []string{}
+	for _, pkg := range pkgs {
+		if pkg.ImportPath != pkgImportPath {
+			continue
+		}
+		for _, testFile := range pkg.TestGoFiles {
+			if !slices.Contains(testFiles, testFile) {
+				testFiles = append(testFiles, testFile)
+			}
+		}
+	}
+	if len(testFiles) == 0 {
+		return nil, fmt.Errorf("%w: no test files in package '%s'", ErrTestNotFound, pkgImportPath)
+	}
+	sort.Strings(testFiles)
+
+	var internalTests, externalTests []string
+	for _, testFile := range testFiles {
+		fileAst, err := parser.ParseFile(token.NewFileSet(), testFile, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing file '%s': %w", testFile, err)
+		}
+		for _, decl := range fileAst.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || !isGoTest(fn.Name.Name) {
+				continue
+			}
+			if strings.HasSuffix(fileAst.Name.Name, "_test") {
+				externalTests = append(externalTests, fn.Name.Name)
+			} else {
+				internalTests = append(internalTests, fn.Name.Name)
+			}
+		}
+	}
+	return append(internalTests, externalTests...), nil
+}
+
+// isGoTest reports whether name is a test function go test runs, e.g. TestFoo or Test_foo but not Testfoo or TestMain
+func isGoTest(name string) bool {
+	suffix, ok := strings.CutPrefix(name, "Test")
+	if !ok || name == "TestMain" {
+		return false
+	}
+	first, _ := utf8.DecodeRuneInString(suffix)
+	return suffix == "" || !unicode.IsLower(first)
+}
@@ -1,6 +1,9 @@
 package golang
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -17,3 +20,116 @@ func TestPackages(t *testing.T) {
 	require.NoError(t, err)
 	require.NotEmpty(t, packages)
 }
+
+func TestTestNames(t *testing.T) {
+	t.Parallel()
+
+	l := testhelpers.Logger(t)
+	const orderPkg = "github.com/smartcontractkit/flakeguard/example_tests/order"
+	tests, err := TestNames(l, "../example_tests", orderPkg, "-tags=examples")
+	require.NoError(t, err)
+	require.Equal(t, []string{"TestFirst", "TestPolluter", "TestInnocent", "TestVictim"}, tests, "tests should be in declaration order")
+
+	_, err = TestNames(l, "../example_tests", orderPkg)
+	require.ErrorIs(t, err, ErrTestNotFound, "test files behind build tags are left out without the tags")
+	_, err = TestNames(l, ".", "github.com/smartcontractkit/flakeguard/missing")
+	require.ErrorIs(t, err, ErrTestNotFound)
+}
+
+func TestFindTestLocation(t *testing.T) {
+	t.Parallel()
+
+	l := testhelpers.Logger(t)
+	const flakyPkg = "github.com/smartcontractkit/flakeguard/example_tests/flaky"
+	location, err := FindTestLocation(l, "../example_tests", flakyPkg, "TestFlakeTwentyFivePercent/subtest", "-tags=examples")
+	require.NoError(t, err)
+	require.True(t, filepath.IsAbs(location.FilePath), "file path should be absolute")
+	require.Equal(t, "flaky_test.go", filepath.Base(location.FilePath))
+	require.Equal(t, 22, location.LineNumber)
+
+	_, err = FindTestLocation(l, "../example_tests", flakyPkg, "TestFlakeTwentyFivePercent")
+	require.ErrorIs(t, err, ErrTestNotFound, "test files behind build tags are left out without the tags")
+}
+
+func TestQuarantineTest(t *testing.T) {
+	t.Parallel()
+
+	src := []byte(`package pkg
+
+import (
+	"testing"
+)
+
+// TestFlaky is flaky
+func TestFlaky(tt *testing.T) {
+	tt.Log("flaky") // sometimes
+}
+
+func TestOther(t *testing.T) {}
+`)
+	quarantined, err := QuarantineTest(src, "TestFlaky", `Flaky, see "issue"`)
+	require.NoError(t, err)
+	require.Equal(t, `package pkg
+
+import (
+	"testing"
+
+	"github.com/smartcontractkit/flakeguard"
+)
+
+// TestFlaky is flaky
+func TestFlaky(tt *testing.T) {
+	flakeguard.Quarantine(tt, "Flaky, see \"issue\"")
+	tt.Log("flaky") // sometimes
+}
+
+func TestOther(t *testing.T) {}
+`, string(quarantined))
+
+	_, err = QuarantineTest(quarantined, "TestFlaky", "again")
+	require.ErrorIs(t, err, ErrAlreadyQuarantined)
+	isQuarantined, err := IsQuarantined(quarantined, "TestFlaky")
+	require.NoError(t, err)
+	require.True(t, isQuarantined)
+	isQuarantined, err = IsQuarantined(quarantined, "TestOther")
+	require.NoError(t, err)
+	require.False(t, isQuarantined)
+	both, err := QuarantineTest(quarantined, "TestOther", "other")
+	require.NoError(t, err)
+	require.Contains(t, string(both), "func TestOther(t *testing.T) {\n\tflakeguard.Quarantine(t, \"other\")\n}")
+	require.Equal(t, 1, strings.Count(string(both), flakeguardImportPath), "import should only be added once")
+
+	_, err = QuarantineTest(src, "TestFlaky/subtest", "sub")
+	require.ErrorIs(t, err, ErrCannotQuarantine)
+	_, err = QuarantineTest(src, "TestMissing", "missing")
+	require.ErrorIs(t, err, ErrTestNotFound)
+}
+
+func TestRequiresFlakeguard(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0750))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(content), 0600))
+	}
+	write("requires/go.mod", "module example.com/requires\n\ngo 1.24\n\nrequire github.com/smartcontractkit/flakeguard v0.1.0\n")
+	write("requires/pkg/pkg_test.go", "package pkg\n")
+	write("missing/go.mod", "module example.com/missing\n\ngo 1.24\n\nrequire github.com/stretchr/testify v1.10.0\n")
+	write("missing/pkg/pkg_test.go", "package pkg\n")
+
+	tests := []struct {
+		dir  string
+		want bool
+	}{
+		{dir: filepath.Join(dir, "requires", "pkg"), want: true},
+		{dir: filepath.Join(dir, "missing", "pkg"), want: false},
+		{dir: ".", want: true},
+	}
+	for _, tt := range tests {
+		requires, err := RequiresFlakeguard(tt.dir)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, requires, tt.dir)
+	}
+}
@@ -0,0 +1,135 @@
+// Package history keeps a local, file-based history of test results, so flakeguard can tell how flaky tests are over
+// time instead of only within a single detect session.
+// Results are appended to a JSON lines file, one line per test per session, along with the info of the run that
+// produced them (commit, branch, CI run).
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/smartcontractkit/flakeguard/report"
+)
+
+// Entry is the result of a single test in a single session
+type Entry struct {
+	// Recorded is when the session's results were added to the history, it's shared by every entry of the session
+	Recorded time.Time         `json:"recorded"`
+	Result   report.TestResult `json:"result"`
+}
+
+// Branch is the branch the session ran on
+func (e Entry) Branch() string {
+	return e.Result.TestRunInfo.HeadBranch
+}
+
+// Failures is how many runs of the test failed. Runs that panicked, raced, or timed out count as failures too, but
+// report.TestResult.Failures only counts plain failures.
+func (e Entry) Failures() int {
+	return max(e.Result.Runs-e.Result.Successes, 0)
+}
+
+// Store is a history of test results kept in a JSON lines file
+type Store struct {
+	path string
+}
+
+// Open opens the history file at path, creating its directory if needed. The file itself is created on the first
+// Append.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	return &Store{path: path}, nil
+}
+
+// Path is the path of the history file
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Append adds the results of a session to the history. Test outputs are left out to keep the history small.
+func (s *Store) Append(recorded time.Time, results []*report.TestResult) error {
+	var lines []byte
+	for _, result := range results {
+		trimmed := *result
+		trimmed.Outputs = nil
+		trimmed.Durations = nil
+		line, err := json.Marshal(Entry{Recorded: recorded, Result: trimmed})
+		if err != nil {
+			return fmt.Errorf("failed to marshal history entry: %w", err)
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	//nolint:gosec // G304: the path comes from the user
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	// A single write keeps a session's entries together, even if another session appends at the same time
+	if _, err := file.Write(lines); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to append to history file: %w", err)
+	}
+	return file.Close()
+}
+
+// Query selects entries from the history. Zero values don't filter anything.
+type Query struct {
+	// Since leaves out sessions recorded before it
+	Since time.Time
+	// LastSessions only keeps the latest sessions
+	LastSessions int
+	// Branch only keeps sessions that ran on the branch
+	Branch string
+}
+
+// Entries reads the entries matching the query, oldest first. A missing history file has no entries.
+func (s *Store) Entries(q Query) ([]Entry, error) {
+	//nolint:gosec // G304: the path comes from the user
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	entries := []Entry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to read history file %s:%d: %w", s.path, line, err)
+		}
+		if entry.Recorded.Before(q.Since) || (q.Branch != "" && entry.Branch() != q.Branch) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+	slices.SortStableFunc(entries, func(a, b Entry) int { return a.Recorded.Compare(b.Recorded) })
+
+	if q.LastSessions > 0 {
+		sessions := 0
+		for i := len(entries) - 1; i >= 0; i-- {
+			if i == len(entries)-1 || !entries[i].Recorded.Equal(entries[i+1].Recorded) {
+				sessions++
+			}
+			if sessions > q.LastSessions {
+				return entries[i+1:], nil
+			}
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,124 @@
+package history
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/flakeguard/report"
+)
+
+func result(branch, name string, runs, failures int) *report.TestResult {
+	return &report.TestResult{
+		Package:     "pkg",
+		Name:        name,
+		TestRunInfo: report.TestRunInfo{HeadBranch: branch},
+		Runs:        runs,
+		Failures:    failures,
+		Successes:   runs - failures,
+		Outputs:     map[int][]string{1: {"output"}},
+	}
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	store, err := Open(filepath.Join(t.TempDir(), "nested", "history.jsonl"))
+	require.NoError(t, err)
+	entries, err := store.Entries(Query{})
+	require.NoError(t, err)
+	assert.Empty(t, entries, "missing history should have no entries")
+
+	day := 24 * time.Hour
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, store.Append(start, []*report.TestResult{result("main", "TestA", 10, 1)}))
+	require.NoError(t, store.Append(start.Add(day), []*report.TestResult{
+		result("main", "TestA", 10, 0),
+		result("main", "TestB", 10, 0),
+	}))
+	require.NoError(t, store.Append(start.Add(2*day), []*report.TestResult{result("feature", "TestA", 10, 5)}))
+
+	entries, err = store.Entries(Query{})
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	assert.Nil(t, entries[0].Result.Outputs, "outputs should be left out of the history")
+
+	entries, err = store.Entries(Query{Since: start.Add(day)})
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	entries, err = store.Entries(Query{LastSessions: 2})
+	require.NoError(t, err)
+	assert.Len(t, entries, 3, "the latest 2 sessions have 3 entries")
+
+	entries, err = store.Entries(Query{Branch: "main"})
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	entries, err = store.Entries(Query{Branch: "main", LastSessions: 1})
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestTrends(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entry := func(session int, result *report.TestResult) Entry {
+		return Entry{Recorded: start.Add(time.Duration(session) * time.Hour), Result: *result}
+	}
+	entries := []Entry{
+		entry(0, result("main", "TestStabilized", 10, 3)),
+		entry(0, result("main", "TestNew", 10, 0)),
+		entry(0, result("main", "TestFlaky", 10, 2)),
+		entry(1, result("main", "TestStabilized", 10, 0)),
+		entry(1, result("main", "TestNew", 10, 4)),
+		entry(1, result("main", "TestFlaky", 10, 1)),
+		entry(1, result("feature", "TestNew", 10, 0)),
+	}
+
+	rates := FlakeRates(entries)
+	require.Len(t, rates, 4, "tests should be split by branch")
+	assert.Equal(t, "TestNew", rates[0].Test)
+	assert.Equal(t, "main", rates[0].Branch)
+	assert.InDelta(t, 0.2, rates[0].FlakeRate(), 0.0001)
+	assert.Equal(t, start.Add(time.Hour), rates[0].LastFailure)
+
+	split := SplitSessions(entries)
+	assert.Equal(t, start.Add(time.Hour), split)
+	newlyFlaky, stabilized := []string{}, []string{}
+	for _, trend := range Trends(entries, split) {
+		if trend.NewlyFlaky() {
+			newlyFlaky = append(newlyFlaky, trend.After.Test+"@"+trend.After.Branch)
+		}
+		if trend.Stabilized() {
+			stabilized = append(stabilized, trend.Before.Test+"@"+trend.Before.Branch)
+		}
+	}
+	assert.Equal(t, []string{"TestNew@main"}, newlyFlaky)
+	assert.Equal(t, []string{"TestStabilized@main"}, stabilized)
+
+	// Panics and races aren't counted in TestResult.Failures, but they're failures all the same
+	racy := result("main", "TestRacy", 10, 0)
+	racy.Successes, racy.Race, racy.FailingRunNumbers = 5, true, []int{1, 3, 5, 7, 9}
+	panicky := result("main", "TestPanicky", 4, 1)
+	panicky.Successes, panicky.Panic, panicky.FailingRunNumbers = 2, true, []int{1, 2}
+	unstable := FlakeRates([]Entry{entry(0, racy), entry(1, panicky)})
+	require.Len(t, unstable, 2)
+	assert.Equal(t, "TestPanicky", unstable[0].Test)
+	assert.Equal(t, 2, unstable[0].Failures)
+	assert.InDelta(t, 0.5, unstable[0].FlakeRate(), 0.0001)
+	assert.Equal(t, "TestRacy", unstable[1].Test)
+	assert.Equal(t, 5, unstable[1].Failures)
+	assert.Equal(t, start, unstable[1].LastFailure)
+
+	var out bytes.Buffer
+	require.NoError(t, WriteReport(&out, entries))
+	assert.Contains(t, out.String(), "2 sessions since 2026-01-01 00:00:00")
+	assert.Contains(t, out.String(), "Newly flaky:\n  pkg TestNew (main)\n")
+	assert.Contains(t, out.String(), "Recently stabilized:\n  pkg TestStabilized (main)\n")
+}
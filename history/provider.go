@@ -0,0 +1,21 @@
+package history
+
+import (
+	"context"
+)
+
+// Provider fetches the past results of tests, from the local store or from wherever results were reported to.
+// Detect and guard combine them with the results of the current session.
+type Provider interface {
+	// FlakeRates adds up the past results of every test on every branch matching the query
+	FlakeRates(ctx context.Context, q Query) ([]Stats, error)
+}
+
+// FlakeRates adds up the results in the history file matching the query
+func (s *Store) FlakeRates(_ context.Context, q Query) ([]Stats, error) {
+	entries, err := s.Entries(q)
+	if err != nil {
+		return nil, err
+	}
+	return FlakeRates(entries), nil
+}
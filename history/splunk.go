@@ -0,0 +1,199 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// splunkEvent is the event name test results are reported to Splunk with
+	splunkEvent = "flakeguard_test_result"
+	// splunkPollInterval is how often a search job is checked for completion
+	splunkPollInterval = time.Second
+)
+
+// Splunk fetches the history of test results reported to Splunk through HTTP Event Collector, by running search jobs
+// through Splunk's REST API. The search API is served separately from HEC, usually on port 8089, and needs its own
+// token.
+type Splunk struct {
+	l            zerolog.Logger
+	client       *resty.Client
+	index        string
+	sourceType   string
+	pollInterval time.Duration
+}
+
+// NewSplunk creates a history provider searching the index and source type test results are reported to
+func NewSplunk(l zerolog.Logger, searchURL, token, index, sourceType string) (*Splunk, error) {
+	if searchURL == "" || token == "" || index == "" || sourceType == "" {
+		return nil, fmt.Errorf("search URL, token, index, and source type must be set to fetch history from Splunk")
+	}
+	client := resty.New().
+		SetBaseURL(strings.TrimSuffix(searchURL, "/")).
+		SetAuthToken(token).
+		SetRetryCount(3).
+		SetRetryWaitTime(100 * time.Millisecond).
+		SetRetryMaxWaitTime(1 * time.Second)
+	return &Splunk{
+		l:            l.With().Str("history_provider", "splunk").Logger(),
+		client:       client,
+		index:        index,
+		sourceType:   sourceType,
+		pollInterval: splunkPollInterval,
+	}, nil
+}
+
+// FlakeRates runs a search job adding up the results of every test per branch, and waits for it to finish.
+// Query.LastSessions isn't supported, as sessions aren't tracked in Splunk.
+func (s *Splunk) FlakeRates(ctx context.Context, q Query) ([]Stats, error) {
+	search := s.search(q)
+	s.l.Debug().Str("search", search).Msg("Starting Splunk search job")
+	start := time.Now()
+
+	var job struct {
+		SID string `json:"sid"`
+	}
+	resp, err := s.client.R().
+		SetContext(ctx).
+		SetFormData(map[string]string{"search": search, "output_mode": "json"}).
+		SetResult(&job).
+		Post("/services/search/jobs")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start Splunk search job: %w", err)
+	}
+	if resp.IsError() || job.SID == "" {
+		return nil, fmt.Errorf("failed to start Splunk search job: %s: %s", resp.Status(), resp.String())
+	}
+
+	if err := s.waitForJob(ctx, job.SID); err != nil {
+		return nil, err
+	}
+
+	var results struct {
+		Results []map[string]string `json:"results"`
+	}
+	resp, err = s.client.R().
+		SetContext(ctx).
+		SetQueryParams(map[string]string{"output_mode": "json", "count": "0"}).
+		SetResult(&results).
+		Get("/services/search/jobs/" + job.SID + "/results")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Splunk search results: %w", err)
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("failed to get Splunk search results: %s: %s", resp.Status(), resp.String())
+	}
+
+	stats := make([]Stats, 0, len(results.Results))
+	for _, result := range results.Results {
+		stat, err := splunkStats(result)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+	s.l.Debug().
+		Int("tests", len(stats)).
+		Str("duration", time.Since(start).String()).
+		Msg("Fetched history from Splunk")
+	return stats, nil
+}
+
+// search builds the SPL query adding up test results per test and branch
+func (s *Splunk) search(q Query) string {
+	filters := []string{
+		"search",
+		"index=" + splunkQuote(s.index),
+		"sourcetype=" + splunkQuote(s.sourceType),
+		"event=" + splunkQuote(splunkEvent),
+	}
+	if !q.Since.IsZero() {
+		filters = append(filters, "earliest="+strconv.FormatInt(q.Since.Unix(), 10))
+	}
+	if q.Branch != "" {
+		filters = append(filters, "data.test_run_info.head_branch="+splunkQuote(q.Branch))
+	}
+	return strings.Join([]string{
+		strings.Join(filters, " "),
+		// data.failures only counts plain failures, runs that panicked, raced, or timed out failed too
+		`eval failed_runs=max('data.runs' - coalesce('data.successes', 0), 0)`,
+		`eval failed_time=if(failed_runs > 0, _time, null())`,
+		`stats count as sessions, sum(data.runs) as runs, sum(failed_runs) as failures, max(failed_time) as last_failure` +
+			` by data.package, data.name, data.test_run_info.head_branch`,
+		`rename data.package as package, data.name as test, data.test_run_info.head_branch as branch`,
+	}, " | ")
+}
+
+// waitForJob polls a search job until it's done
+func (s *Splunk) waitForJob(ctx context.Context, sid string) error {
+	for {
+		var status struct {
+			Entry []struct {
+				Content struct {
+					DispatchState string `json:"dispatchState"`
+					IsDone        bool   `json:"isDone"`
+					IsFailed      bool   `json:"isFailed"`
+				} `json:"content"`
+			} `json:"entry"`
+		}
+		resp, err := s.client.R().
+			SetContext(ctx).
+			SetQueryParam("output_mode", "json").
+			SetResult(&status).
+			Get("/services/search/jobs/" + sid)
+		if err != nil {
+			return fmt.Errorf("failed to check Splunk search job: %w", err)
+		}
+		if resp.IsError() || len(status.Entry) == 0 {
+			return fmt.Errorf("failed to check Splunk search job: %s: %s", resp.Status(), resp.String())
+		}
+		content := status.Entry[0].Content
+		switch {
+		case content.IsFailed || content.DispatchState == "FAILED":
+			return fmt.Errorf("splunk search job %s failed", sid)
+		case content.IsDone || content.DispatchState == "DONE":
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.pollInterval):
+		}
+	}
+}
+
+// splunkStats reads a row of search results, Splunk returns every value as a string
+func splunkStats(result map[string]string) (Stats, error) {
+	stats := Stats{Package: result["package"], Test: result["test"], Branch: result["branch"]}
+	for field, value := range map[string]*int{"sessions": &stats.Sessions, "runs": &stats.Runs, "failures": &stats.Failures} {
+		if result[field] == "" {
+			continue
+		}
+		// Sums come back as floats, e.g. "10" or "10.0"
+		f, err := strconv.ParseFloat(result[field], 64)
+		if err != nil {
+			return Stats{}, fmt.Errorf("invalid %s %q for %s in Splunk search results: %w", field, result[field], stats.Test, err)
+		}
+		*value = int(f)
+	}
+	if lastFailure := result["last_failure"]; lastFailure != "" {
+		seconds, err := strconv.ParseFloat(lastFailure, 64)
+		if err != nil {
+			return Stats{}, fmt.Errorf("invalid last failure %q for %s in Splunk search results: %w", lastFailure, stats.Test, err)
+		}
+		stats.LastFailure = time.Unix(0, int64(seconds*float64(time.Second)))
+	}
+	return stats, nil
+}
+
+// splunkQuote quotes a value for use in an SPL search
+func splunkQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
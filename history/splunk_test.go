@@ -0,0 +1,90 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/flakeguard/internal/testhelpers"
+)
+
+// splunkServer fakes Splunk's search API, which responds with JSON when asked for output_mode=json
+func splunkServer(t *testing.T, mux *http.ServeMux) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestSplunk(t *testing.T) {
+	t.Parallel()
+
+	var (
+		search string
+		polls  atomic.Int32
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /services/search/jobs", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+		search = r.FormValue("search")
+		fmt.Fprint(w, `{"sid":"1234.5"}`)
+	})
+	mux.HandleFunc("GET /services/search/jobs/1234.5", func(w http.ResponseWriter, _ *http.Request) {
+		// The job is still running the first time it's checked
+		state := "RUNNING"
+		if polls.Add(1) > 1 {
+			state = "DONE"
+		}
+		fmt.Fprintf(w, `{"entry":[{"content":{"dispatchState":%q}}]}`, state)
+	})
+	mux.HandleFunc("GET /services/search/jobs/1234.5/results", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"results":[
+			{"package":"pkg","test":"TestA","branch":"main","sessions":"3","runs":"30","failures":"3.0","last_failure":"1767225600.000"},
+			{"package":"pkg","test":"TestB","branch":"main","sessions":"3","runs":"30","failures":"0"}
+		]}`)
+	})
+	splunk, err := NewSplunk(testhelpers.Logger(t), splunkServer(t, mux), "test-token", "flakeguard_json", "flakeguard_json")
+	require.NoError(t, err)
+	splunk.pollInterval = time.Millisecond
+
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	stats, err := splunk.FlakeRates(context.Background(), Query{Since: since, Branch: `main"`})
+	require.NoError(t, err)
+	assert.Equal(t, []Stats{
+		{Package: "pkg", Test: "TestA", Branch: "main", Sessions: 3, Runs: 30, Failures: 3, LastFailure: time.Unix(1767225600, 0)},
+		{Package: "pkg", Test: "TestB", Branch: "main", Sessions: 3, Runs: 30},
+	}, stats)
+	assert.Equal(t, int32(2), polls.Load(), "job should be polled until it's done")
+	assert.Contains(t, search, `search index="flakeguard_json" sourcetype="flakeguard_json" event="flakeguard_test_result" earliest=1767225600`)
+	assert.Contains(t, search, `data.test_run_info.head_branch="main\""`, "values should be escaped")
+	assert.Contains(t, search, "by data.package, data.name, data.test_run_info.head_branch")
+	assert.Contains(t, search, `eval failed_runs=max('data.runs' - coalesce('data.successes', 0), 0)`,
+		"failures should include runs that panicked or raced, like the local history")
+	assert.Contains(t, search, "sum(failed_runs) as failures")
+}
+
+func TestSplunkFailedJob(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /services/search/jobs", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"sid":"1234.5"}`)
+	})
+	mux.HandleFunc("GET /services/search/jobs/1234.5", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"entry":[{"content":{"dispatchState":"FAILED","isFailed":true}}]}`)
+	})
+	splunk, err := NewSplunk(testhelpers.Logger(t), splunkServer(t, mux), "test-token", "flakeguard_json", "flakeguard_json")
+	require.NoError(t, err)
+	_, err = splunk.FlakeRates(context.Background(), Query{})
+	require.EqualError(t, err, "splunk search job 1234.5 failed")
+}
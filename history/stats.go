@@ -0,0 +1,235 @@
+package history
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Stats are the results of a test on a branch, added up over sessions
+type Stats struct {
+	Package  string
+	Test     string
+	Branch   string
+	Sessions int
+	Runs     int
+	Failures int
+	// LastFailure is when the latest session the test failed in was recorded
+	LastFailure time.Time
+}
+
+// FlakeRate is the share of runs the test failed in
+func (s Stats) FlakeRate() float64 {
+	if s.Runs == 0 {
+		return 0
+	}
+	return float64(s.Failures) / float64(s.Runs)
+}
+
+type statsKey struct {
+	pkg, test, branch string
+}
+
+func (s *Stats) add(entry Entry) {
+	s.Sessions++
+	s.Runs += entry.Result.Runs
+	s.Failures += entry.Failures()
+	if entry.Failures() > 0 && entry.Recorded.After(s.LastFailure) {
+		s.LastFailure = entry.Recorded
+	}
+}
+
+// FlakeRates adds up the entries of each test on each branch, sorted by flake rate, highest first
+func FlakeRates(entries []Entry) []Stats {
+	byTest := map[statsKey]*Stats{}
+	for _, entry := range entries {
+		key := statsKey{pkg: entry.Result.Package, test: entry.Result.Name, branch: entry.Branch()}
+		stats, ok := byTest[key]
+		if !ok {
+			stats = &Stats{Package: key.pkg, Test: key.test, Branch: key.branch}
+			byTest[key] = stats
+		}
+		stats.add(entry)
+	}
+
+	rates := make([]Stats, 0, len(byTest))
+	for _, stats := range byTest {
+		rates = append(rates, *stats)
+	}
+	slices.SortFunc(rates, func(a, b Stats) int {
+		return cmp.Or(
+			cmp.Compare(b.FlakeRate(), a.FlakeRate()),
+			cmp.Compare(a.Package, b.Package),
+			cmp.Compare(a.Test, b.Test),
+			cmp.Compare(a.Branch, b.Branch),
+		)
+	})
+	return rates
+}
+
+// Trend compares the results of a test on a branch before and after a point in time
+type Trend struct {
+	Before Stats
+	After  Stats
+}
+
+// NewlyFlaky is true if the test failed after the split, but never before it
+func (t Trend) NewlyFlaky() bool {
+	return t.After.Failures > 0 && t.Before.Failures == 0
+}
+
+// Stabilized is true if the test failed before the split, but ran without failing after it
+func (t Trend) Stabilized() bool {
+	return t.Before.Failures > 0 && t.After.Failures == 0 && t.After.Runs > 0
+}
+
+// Trends compares the results of every test on every branch in the sessions recorded before split with the ones
+// recorded at or after it. They're sorted the same way as FlakeRates, by the flake rate after the split.
+func Trends(entries []Entry, split time.Time) []Trend {
+	var before, after []Entry
+	for _, entry := range entries {
+		if entry.Recorded.Before(split) {
+			before = append(before, entry)
+		} else {
+			after = append(after, entry)
+		}
+	}
+
+	byTest := map[statsKey]*Trend{}
+	trends := []*Trend{}
+	trend := func(stats Stats) *Trend {
+		key := statsKey{pkg: stats.Package, test: stats.Test, branch: stats.Branch}
+		t, ok := byTest[key]
+		if !ok {
+			empty := Stats{Package: stats.Package, Test: stats.Test, Branch: stats.Branch}
+			t = &Trend{Before: empty, After: empty}
+			byTest[key] = t
+			trends = append(trends, t)
+		}
+		return t
+	}
+	for _, stats := range FlakeRates(after) {
+		trend(stats).After = stats
+	}
+	for _, stats := range FlakeRates(before) {
+		trend(stats).Before = stats
+	}
+
+	sorted := make([]Trend, 0, len(trends))
+	for _, t := range trends {
+		sorted = append(sorted, *t)
+	}
+	return sorted
+}
+
+// SplitSessions returns the time the newer half of the sessions in entries starts at, to compare them with the older
+// half using Trends. Entries need to be sorted oldest first, like Store.Entries returns them.
+func SplitSessions(entries []Entry) time.Time {
+	sessions := []time.Time{}
+	for _, entry := range entries {
+		if len(sessions) == 0 || !sessions[len(sessions)-1].Equal(entry.Recorded) {
+			sessions = append(sessions, entry.Recorded)
+		}
+	}
+	if len(sessions) == 0 {
+		return time.Time{}
+	}
+	return sessions[len(sessions)/2]
+}
+
+// WriteReport writes the flake rates of the tests that failed in entries, followed by the tests that became flaky and
+// the tests that stabilized in the newer half of the sessions.
+func WriteReport(w io.Writer, entries []Entry) error {
+	sessions := 0
+	for i, entry := range entries {
+		if i == 0 || !entry.Recorded.Equal(entries[i-1].Recorded) {
+			sessions++
+		}
+	}
+	if sessions == 0 {
+		_, err := fmt.Fprintln(w, "No history recorded yet")
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "%d sessions since %s\n\n", sessions, entries[0].Recorded.Format(time.DateTime)); err != nil {
+		return err
+	}
+
+	trends := Trends(entries, SplitSessions(entries))
+	trendsByTest := make(map[statsKey]Trend, len(trends))
+	for _, t := range trends {
+		trendsByTest[statsKey{pkg: t.After.Package, test: t.After.Test, branch: t.After.Branch}] = t
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "Package\tTest\tBranch\tRuns\tFailures\tFlake Rate\tTrend\tLast Failure\t"); err != nil {
+		return err
+	}
+	failing := 0
+	for _, stats := range FlakeRates(entries) {
+		if stats.Failures == 0 {
+			continue
+		}
+		failing++
+		trend := "-"
+		if t, ok := trendsByTest[statsKey{pkg: stats.Package, test: stats.Test, branch: stats.Branch}]; ok && sessions > 1 {
+			trend = fmt.Sprintf("%.2f%% -> %.2f%%", t.Before.FlakeRate()*100, t.After.FlakeRate()*100)
+		}
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%.2f%%\t%s\t%s\t\n",
+			stats.Package,
+			stats.Test,
+			cmp.Or(stats.Branch, "-"),
+			stats.Runs,
+			stats.Failures,
+			stats.FlakeRate()*100,
+			trend,
+			stats.LastFailure.Format(time.DateTime),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if failing == 0 {
+		if _, err := fmt.Fprintln(w, "No test failed"); err != nil {
+			return err
+		}
+	}
+	// Trends need older sessions to compare against
+	if sessions < 2 {
+		return nil
+	}
+
+	newlyFlaky, stabilized := []string{}, []string{}
+	for _, t := range trends {
+		name := fmt.Sprintf("%s %s", t.After.Package, t.After.Test)
+		if t.After.Branch != "" {
+			name += fmt.Sprintf(" (%s)", t.After.Branch)
+		}
+		switch {
+		case t.NewlyFlaky():
+			newlyFlaky = append(newlyFlaky, name)
+		case t.Stabilized():
+			stabilized = append(stabilized, name)
+		}
+	}
+	for _, section := range []struct {
+		title string
+		tests []string
+	}{
+		{"Newly flaky", newlyFlaky},
+		{"Recently stabilized", stabilized},
+	} {
+		if len(section.tests) == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "\n%s:\n  %s\n", section.title, strings.Join(section.tests, "\n  ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
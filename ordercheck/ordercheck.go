@@ -0,0 +1,160 @@
+// Package ordercheck finds out whether a flaky test depends on the tests that run before it,
+// and narrows the tests before it down to the ones that pollute it.
+package ordercheck
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Verdict is the outcome of an order check
+type Verdict string
+
+const (
+	// VerdictFailsAlone means the test fails even when run on its own, so its flakiness isn't about test order
+	VerdictFailsAlone Verdict = "fails_alone"
+	// VerdictNotReproduced means the test never failed, not even after all the tests that run before it
+	VerdictNotReproduced Verdict = "not_reproduced"
+	// VerdictOrderDependent means the test only fails after some of the tests that run before it
+	VerdictOrderDependent Verdict = "order_dependent"
+)
+
+// Trial runs the target test right after the preceding tests, in order, and reports whether the target test failed.
+type Trial func(ctx context.Context, preceding []string) (bool, error)
+
+// Result is the outcome of checking a single test
+type Result struct {
+	Package string  `json:"package"`
+	Test    string  `json:"test"`
+	Verdict Verdict `json:"verdict"`
+	// Polluters is the smallest set of tests found that make the test fail when run before it
+	Polluters []string `json:"polluters,omitempty"`
+	// Trials is how many trials it took to reach the verdict
+	Trials int `json:"trials"`
+}
+
+func (r Result) String() string {
+	switch r.Verdict {
+	case VerdictFailsAlone:
+		return fmt.Sprintf("%s fails when run alone, its flakiness doesn't depend on other tests", r.Test)
+	case VerdictNotReproduced:
+		return fmt.Sprintf("%s didn't fail when run after the rest of its package, no order dependency found", r.Test)
+	default:
+		return fmt.Sprintf("%s fails when run after %s", r.Test, strings.Join(r.Polluters, ", "))
+	}
+}
+
+// Check runs the target test alone, then after all preceding tests, then delta-debugs the preceding tests down to the
+// smallest set that still makes the target fail.
+// Preceding tests need to be in the order go test runs them in.
+func Check(ctx context.Context, l zerolog.Logger, pkg, target string, preceding []string, trial Trial) (Result, error) {
+	l = l.With().Str("package", pkg).Str("test", target).Logger()
+	result := Result{Package: pkg, Test: target}
+
+	// Each subset is only tried once
+	tried := map[string]bool{}
+	fails := func(subset []string) (bool, error) {
+		key := strings.Join(subset, ",")
+		if failed, ok := tried[key]; ok {
+			return failed, nil
+		}
+		result.Trials++
+		failed, err := trial(ctx, subset)
+		if err != nil {
+			return false, err
+		}
+		l.Debug().Strs("preceding", subset).Bool("failed", failed).Int("trial", result.Trials).Msg("Order check trial")
+		tried[key] = failed
+		return failed, nil
+	}
+
+	failed, err := fails(nil)
+	if err != nil {
+		return result, err
+	}
+	if failed {
+		result.Verdict = VerdictFailsAlone
+		return result, nil
+	}
+
+	failed, err = fails(preceding)
+	if err != nil {
+		return result, err
+	}
+	if !failed {
+		result.Verdict = VerdictNotReproduced
+		return result, nil
+	}
+
+	polluters, err := minimize(preceding, fails)
+	if err != nil {
+		return result, err
+	}
+	result.Verdict = VerdictOrderDependent
+	result.Polluters = polluters
+	return result, nil
+}
+
+// minimize is the ddmin delta debugging algorithm. It shrinks tests, which are known to fail,
+// to a subset where removing any single test makes it stop failing.
+func minimize(tests []string, fails func([]string) (bool, error)) ([]string, error) {
+	granularity := 2
+	for len(tests) >= 2 {
+		chunks := split(tests, granularity)
+		reduced := false
+
+		for _, chunk := range chunks {
+			failed, err := fails(chunk)
+			if err != nil {
+				return nil, err
+			}
+			if failed {
+				tests, granularity, reduced = chunk, 2, true
+				break
+			}
+		}
+
+		// With two chunks, the complements are the chunks themselves
+		if !reduced && granularity > 2 {
+			for i := range chunks {
+				complement := make([]string, 0, len(tests)-len(chunks[i]))
+				for j, chunk := range chunks {
+					if i != j {
+						complement = append(complement, chunk...)
+					}
+				}
+				failed, err := fails(complement)
+				if err != nil {
+					return nil, err
+				}
+				if failed {
+					tests, granularity, reduced = complement, max(granularity-1, 2), true
+					break
+				}
+			}
+		}
+
+		if !reduced {
+			if granularity >= len(tests) {
+				break
+			}
+			granularity = min(granularity*2, len(tests))
+		}
+	}
+	return tests, nil
+}
+
+// split splits tests into n chunks of nearly equal size, keeping their order
+func split(tests []string, n int) [][]string {
+	chunks := make([][]string, 0, n)
+	start := 0
+	for i := range n {
+		end := start + (len(tests)-start)/(n-i)
+		chunks = append(chunks, tests[start:end])
+		start = end
+	}
+	return chunks
+}
@@ -0,0 +1,68 @@
+package ordercheck
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/flakeguard/internal/testhelpers"
+)
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	preceding := []string{"TestA", "TestB", "TestC", "TestD", "TestE", "TestF", "TestG"}
+
+	tests := []struct {
+		name              string
+		fails             func(preceding []string) bool
+		expectedVerdict   Verdict
+		expectedPolluters []string
+	}{
+		{
+			name: "single polluter",
+			fails: func(preceding []string) bool {
+				return slices.Contains(preceding, "TestE")
+			},
+			expectedVerdict:   VerdictOrderDependent,
+			expectedPolluters: []string{"TestE"},
+		},
+		{
+			name: "polluters that only fail together",
+			fails: func(preceding []string) bool {
+				return slices.Contains(preceding, "TestB") && slices.Contains(preceding, "TestF")
+			},
+			expectedVerdict:   VerdictOrderDependent,
+			expectedPolluters: []string{"TestB", "TestF"},
+		},
+		{
+			name:            "fails alone",
+			fails:           func(_ []string) bool { return true },
+			expectedVerdict: VerdictFailsAlone,
+		},
+		{
+			name:            "never fails",
+			fails:           func(_ []string) bool { return false },
+			expectedVerdict: VerdictNotReproduced,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			l := testhelpers.Logger(t)
+			result, err := Check(context.Background(), l, "example.com/pkg", "TestVictim", preceding,
+				func(_ context.Context, preceding []string) (bool, error) {
+					return tc.fails(preceding), nil
+				},
+			)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedVerdict, result.Verdict)
+			require.Equal(t, tc.expectedPolluters, result.Polluters)
+			require.Positive(t, result.Trials)
+		})
+	}
+}
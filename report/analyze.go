@@ -3,18 +3,23 @@ package report
 import (
 	"fmt"
 	"regexp"
+	"slices"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
 
 	"github.com/smartcontractkit/flakeguard/exit"
+	"github.com/smartcontractkit/flakeguard/filter"
 )
 
 var (
 	timeoutRe = regexp.MustCompile(`^panic: test timed out after (.*)`)
 	panicRe   = regexp.MustCompile(`^panic:`)
 	raceRe    = regexp.MustCompile(`^WARNING: DATA RACE`)
+	// t.Error and t.Fatal output, e.g. "    foo_test.go:12: expected 1, got 2"
+	testErrorRe = regexp.MustCompile(`^\s*\S+\.go:\d+: `)
 )
 
 func analyzeTestOutput(l zerolog.Logger, lines []*testOutputLine) (*reportSummary, []*TestResult, error) {
@@ -34,8 +39,6 @@ func analyzeTestOutput(l zerolog.Logger, lines []*testOutputLine) (*reportSummar
 
 	// package -> test_name -> TestResult
 	results := map[string]map[string]*TestResult{}
-	// package -> test_name -> current_run_number
-	testRunNumber := map[string]map[string]int{}
 	panickedPackages := []string{}
 
 	for _, line := range lines {
@@ -46,9 +49,6 @@ func analyzeTestOutput(l zerolog.Logger, lines []*testOutputLine) (*reportSummar
 		if _, ok := results[line.Package]; !ok {
 			results[line.Package] = make(map[string]*TestResult)
 		}
-		if _, ok := testRunNumber[line.Package]; !ok {
-			testRunNumber[line.Package] = make(map[string]int)
-		}
 		if line.Test == "" { // This is a package summary line, not a test result
 			continue
 		}
@@ -56,7 +56,6 @@ func analyzeTestOutput(l zerolog.Logger, lines []*testOutputLine) (*reportSummar
 		result, ok := results[line.Package][line.Test]
 		if !ok {
 			summary.UniqueTestsRun++
-			testRunNumber[line.Package][line.Test] = 1
 			result = &TestResult{
 				TimeRun:   line.Time,
 				Name:      line.Test,
@@ -67,10 +66,10 @@ func analyzeTestOutput(l zerolog.Logger, lines []*testOutputLine) (*reportSummar
 			results[line.Package][line.Test] = result
 		}
 
-		result.Outputs[testRunNumber[line.Package][line.Test]] = append(
-			result.Outputs[testRunNumber[line.Package][line.Test]],
-			line.Output,
-		)
+		if !slices.Contains(result.runNumbers, line.Run) {
+			result.runNumbers = append(result.runNumbers, line.Run)
+		}
+		result.Outputs[line.Run] = append(result.Outputs[line.Run], line.Output)
 		if line.Elapsed > 0 {
 			result.Durations = append(result.Durations, time.Duration(line.Elapsed*1000000000))
 		}
@@ -86,9 +85,7 @@ func analyzeTestOutput(l zerolog.Logger, lines []*testOutputLine) (*reportSummar
 			result.Runs++
 			summary.TotalTestRuns++
 			panickedPackages = append(panickedPackages, line.Package)
-			result.FailingRunNumbers = append(result.FailingRunNumbers, testRunNumber[line.Package][line.Test])
-
-			testRunNumber[line.Package][line.Test]++
+			result.FailingRunNumbers = append(result.FailingRunNumbers, line.Run)
 			continue
 		}
 
@@ -99,9 +96,7 @@ func analyzeTestOutput(l zerolog.Logger, lines []*testOutputLine) (*reportSummar
 			result.Runs++
 			summary.TotalTestRuns++
 			panickedPackages = append(panickedPackages, line.Package)
-			result.FailingRunNumbers = append(result.FailingRunNumbers, testRunNumber[line.Package][line.Test])
-
-			testRunNumber[line.Package][line.Test]++
+			result.FailingRunNumbers = append(result.FailingRunNumbers, line.Run)
 			continue
 		}
 
@@ -110,9 +105,7 @@ func analyzeTestOutput(l zerolog.Logger, lines []*testOutputLine) (*reportSummar
 			summary.Races++
 			result.Runs++
 			summary.TotalTestRuns++
-			result.FailingRunNumbers = append(result.FailingRunNumbers, testRunNumber[line.Package][line.Test])
-
-			testRunNumber[line.Package][line.Test]++
+			result.FailingRunNumbers = append(result.FailingRunNumbers, line.Run)
 			continue
 		}
 
@@ -124,21 +117,15 @@ func analyzeTestOutput(l zerolog.Logger, lines []*testOutputLine) (*reportSummar
 			summary.Successes++
 			result.Runs++
 			summary.TotalTestRuns++
-
-			testRunNumber[line.Package][line.Test]++
 		case "fail":
 			result.Failures++
 			summary.Failures++
 			result.Runs++
 			summary.TotalTestRuns++
-			result.FailingRunNumbers = append(result.FailingRunNumbers, testRunNumber[line.Package][line.Test])
-
-			testRunNumber[line.Package][line.Test]++
+			result.FailingRunNumbers = append(result.FailingRunNumbers, line.Run)
 		case "skip":
 			result.Skips++
 			summary.Skips++
-
-			testRunNumber[line.Package][line.Test]++
 		}
 	}
 
@@ -171,3 +158,222 @@ func analyzeTestOutput(l zerolog.Logger, lines []*testOutputLine) (*reportSummar
 	l.Trace().Int("tests", len(resultSlice)).Str("duration", time.Since(start).String()).Msg("Analyzed test output")
 	return summary, resultSlice, nil
 }
+
+// crossProcessConfidence is the confidence needed to claim a test fails more often when runs execute in parallel
+const crossProcessConfidence = 0.95
+
+// compareParallelRuns flags tests that fail significantly more often in runs that executed alongside other runs
+// than in runs that executed alone. Those tests likely share state (files, ports, databases) across processes.
+func compareParallelRuns(results []*TestResult, runs []Run) {
+	parallelRuns := make(map[int]bool, len(runs))
+	hasParallel, hasSequential := false, false
+	for _, run := range runs {
+		parallelRuns[run.Number] = run.Parallel
+		if run.Parallel {
+			hasParallel = true
+		} else {
+			hasSequential = true
+		}
+	}
+	if !hasParallel || !hasSequential {
+		return
+	}
+
+	for _, result := range results {
+		var parallelExecutions, parallelFailures, sequentialExecutions, sequentialFailures int
+		for _, runNumber := range result.runNumbers {
+			failed := slices.Contains(result.FailingRunNumbers, runNumber)
+			if parallelRuns[runNumber] {
+				parallelExecutions++
+				if failed {
+					parallelFailures++
+				}
+			} else {
+				sequentialExecutions++
+				if failed {
+					sequentialFailures++
+				}
+			}
+		}
+		if parallelExecutions > 0 {
+			result.ParallelFailureRate = float64(parallelFailures) / float64(parallelExecutions)
+		}
+		if sequentialExecutions > 0 {
+			result.SequentialFailureRate = float64(sequentialFailures) / float64(sequentialExecutions)
+		}
+		result.CrossProcessInterference = SignificantlyHigher(
+			parallelFailures, parallelExecutions,
+			sequentialFailures, sequentialExecutions,
+			crossProcessConfidence,
+		)
+	}
+}
+
+// settingCorrelationConfidence is the confidence needed to claim a test fails more often with a matrix setting
+const settingCorrelationConfidence = 0.95
+
+// correlateSettings finds matrix settings that tests fail significantly more often with than with other values
+// of the same setting, e.g. a test that only fails with -cpu=1.
+func correlateSettings(results []*TestResult, runs []Run) {
+	runSettings := make(map[int]map[string]string, len(runs))
+	// setting -> values
+	settingValues := map[string][]string{}
+	for _, run := range runs {
+		runSettings[run.Number] = run.Settings
+		for setting, value := range run.Settings {
+			if !slices.Contains(settingValues[setting], value) {
+				settingValues[setting] = append(settingValues[setting], value)
+			}
+		}
+	}
+
+	settings := make([]string, 0, len(settingValues))
+	for setting, values := range settingValues {
+		if len(values) > 1 {
+			settings = append(settings, setting)
+		}
+	}
+	slices.Sort(settings)
+
+	for _, result := range results {
+		if len(result.FailingRunNumbers) == 0 {
+			continue
+		}
+		for _, setting := range settings {
+			values := slices.Clone(settingValues[setting])
+			slices.Sort(values)
+			for _, value := range values {
+				var withRuns, withFailures, otherRuns, otherFailures int
+				for _, runNumber := range result.runNumbers {
+					runValue, ok := runSettings[runNumber][setting]
+					if !ok {
+						continue
+					}
+					failed := slices.Contains(result.FailingRunNumbers, runNumber)
+					if runValue == value {
+						withRuns++
+						if failed {
+							withFailures++
+						}
+					} else {
+						otherRuns++
+						if failed {
+							otherFailures++
+						}
+					}
+				}
+				if !SignificantlyHigher(withFailures, withRuns, otherFailures, otherRuns, settingCorrelationConfidence) {
+					continue
+				}
+				result.SettingCorrelations = append(result.SettingCorrelations, SettingCorrelation{
+					Setting:          setting,
+					Value:            value,
+					FailureRate:      float64(withFailures) / float64(withRuns),
+					OtherFailureRate: float64(otherFailures) / float64(otherRuns),
+				})
+			}
+		}
+	}
+}
+
+// markHungTests marks tests that started but never finished in killed runs as timed out.
+// Killed test binaries never report a result for the tests they were stuck in.
+func markHungTests(summary *reportSummary, results []*TestResult, lines []*testOutputLine, runs []Run) {
+	killedRuns := map[int]bool{}
+	dumps := map[int]string{}
+	for _, run := range runs {
+		if run.Killed {
+			killedRuns[run.Number] = true
+			dumps[run.Number] = run.GoroutineDump
+		}
+	}
+	if len(killedRuns) == 0 {
+		return
+	}
+
+	type testKey struct {
+		run           int
+		pkg, testName string
+	}
+	unfinished := map[testKey]bool{}
+	for _, line := range lines {
+		if line.Test == "" || !killedRuns[line.Run] {
+			continue
+		}
+		key := testKey{run: line.Run, pkg: line.Package, testName: line.Test}
+		switch line.Action {
+		case "run":
+			unfinished[key] = true
+		case "pass", "fail", "skip":
+			delete(unfinished, key)
+		}
+	}
+
+	for _, result := range results {
+		for run := range killedRuns {
+			key := testKey{run: run, pkg: result.Package, testName: result.Name}
+			if !unfinished[key] || slices.Contains(result.FailingRunNumbers, run) {
+				continue
+			}
+			result.Timeout = true
+			result.Runs++
+			result.FailingRunNumbers = append(result.FailingRunNumbers, run)
+			if dumps[run] != "" {
+				result.GoroutineDumps = append(result.GoroutineDumps, dumps[run])
+			}
+			summary.Timeouts++
+			summary.TotalTestRuns++
+		}
+		slices.Sort(result.FailingRunNumbers)
+		slices.Sort(result.GoroutineDumps)
+	}
+}
+
+// excludeLines drops the output of the packages and tests the filter excludes, and lists what it dropped
+func excludeLines(lines []*testOutputLine, f *filter.Filter) ([]*testOutputLine, []filter.Exclusion) {
+	if !f.HasPackageRules() && !f.HasTestRules() {
+		return lines, nil
+	}
+
+	type testKey struct {
+		pkg, testName string
+	}
+	decisions := map[testKey]bool{}
+	exclusions := []filter.Exclusion{}
+	kept := make([]*testOutputLine, 0, len(lines))
+	for _, line := range lines {
+		key := testKey{pkg: line.Package, testName: line.Test}
+		excluded, decided := decisions[key]
+		if !decided {
+			var exclusion filter.Exclusion
+			if line.Test == "" {
+				exclusion, excluded = f.Package(line.Package)
+			} else {
+				exclusion, excluded = f.Test(line.Package, line.Test)
+			}
+			decisions[key] = excluded
+			// Tests of excluded packages are covered by the package's exclusion
+			_, packageExcluded := f.Package(line.Package)
+			if excluded && (line.Test == "" || !packageExcluded) {
+				exclusions = append(exclusions, exclusion)
+			}
+		}
+		if !excluded {
+			kept = append(kept, line)
+		}
+	}
+	return kept, exclusions
+}
+
+// exclusionsNote returns a human-readable list of what was left out of the report, or an empty string if nothing was
+func exclusionsNote(exclusions []filter.Exclusion) string {
+	if len(exclusions) == 0 {
+		return ""
+	}
+	lines := make([]string, 0, len(exclusions)+1)
+	lines = append(lines, "Left out:")
+	for _, exclusion := range exclusions {
+		lines = append(lines, "  "+exclusion.String())
+	}
+	return strings.Join(lines, "\n")
+}
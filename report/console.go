@@ -3,19 +3,30 @@ package report
 import (
 	"fmt"
 	"strings"
+
+	"github.com/smartcontractkit/flakeguard/filter"
 )
 
-func writeToConsole(summary *reportSummary, results []*TestResult) error {
+func writeToConsole(summary *reportSummary, results []*TestResult, runs []Run, exclusions []filter.Exclusion) error {
 	summaryStr := summary.String()
 	fmt.Println(strings.Repeat("-", len(summaryStr)))
 	fmt.Println(summaryStr)
+	if note := killedRunsNote(runs); note != "" {
+		fmt.Println(note)
+	}
 	fmt.Println(strings.Repeat("-", len(summaryStr)))
 
 	for _, result := range results {
-		if result.Failures > 0 || result.Panic {
+		if result.Failures > 0 || result.Panic || result.Timeout {
 			fmt.Println(result.String())
+			for _, note := range result.notes() {
+				fmt.Printf("  %s\n", note)
+			}
 		}
 	}
+	if note := exclusionsNote(exclusions); note != "" {
+		fmt.Println(note)
+	}
 
 	return nil
 }
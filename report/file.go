@@ -9,10 +9,20 @@ import (
 	"time"
 
 	"github.com/rs/zerolog"
+
+	"github.com/smartcontractkit/flakeguard/filter"
 )
 
 // writeToTextFile writes a flakeguard report to a human-readable text file
-func writeToTextFile(l zerolog.Logger, summary *reportSummary, results []*TestResult, dir string, file string) error {
+func writeToTextFile(
+	l zerolog.Logger,
+	summary *reportSummary,
+	results []*TestResult,
+	runs []Run,
+	exclusions []filter.Exclusion,
+	dir string,
+	file string,
+) error {
 	filePath := filepath.Join(dir, file)
 	l.Trace().Str("file", filePath).Msg("Writing report to file")
 	start := time.Now()
@@ -32,13 +42,25 @@ func writeToTextFile(l zerolog.Logger, summary *reportSummary, results []*TestRe
 	if err != nil {
 		return fmt.Errorf("failed to write to report file: %w", err)
 	}
+	if note := killedRunsNote(runs); note != "" {
+		_, err = fmt.Fprintf(reportFile, "%s\n", note)
+		if err != nil {
+			return fmt.Errorf("failed to write to report file: %w", err)
+		}
+	}
+	if note := exclusionsNote(exclusions); note != "" {
+		_, err = fmt.Fprintf(reportFile, "%s\n", note)
+		if err != nil {
+			return fmt.Errorf("failed to write to report file: %w", err)
+		}
+	}
 	_, err = fmt.Fprintf(reportFile, "====================\n")
 	if err != nil {
 		return fmt.Errorf("failed to write to report file: %w", err)
 	}
 
 	for _, result := range results {
-		if result.Failures > 0 || result.Panic {
+		if result.Failures > 0 || result.Panic || result.Timeout {
 			_, err := reportFile.WriteString("--------------------------------\n")
 			if err != nil {
 				return fmt.Errorf("failed to write to report file: %w", err)
@@ -47,6 +69,12 @@ func writeToTextFile(l zerolog.Logger, summary *reportSummary, results []*TestRe
 			if err != nil {
 				return fmt.Errorf("failed to write to report file: %w", err)
 			}
+			for _, note := range result.notes() {
+				_, err = fmt.Fprintf(reportFile, "%s\n", note)
+				if err != nil {
+					return fmt.Errorf("failed to write to report file: %w", err)
+				}
+			}
 			_, err = reportFile.WriteString("--------------------------------\n")
 			if err != nil {
 				return fmt.Errorf("failed to write to report file: %w", err)
@@ -73,19 +101,31 @@ func writeToTextFile(l zerolog.Logger, summary *reportSummary, results []*TestRe
 }
 
 // writeToJSONFile writes a flakeguard report to a JSON file
-func writeToJSONFile(l zerolog.Logger, summary *reportSummary, results []*TestResult, dir string, file string) error {
+func writeToJSONFile(
+	l zerolog.Logger,
+	summary *reportSummary,
+	results []*TestResult,
+	runs []Run,
+	exclusions []filter.Exclusion,
+	dir string,
+	file string,
+) error {
 	filePath := filepath.Join(dir, file)
 	l.Trace().Str("file", filePath).Msg("Writing report to JSON file")
 	start := time.Now()
 
 	type jsonReport struct {
-		Summary *reportSummary `json:"summary"`
-		Results []*TestResult  `json:"results"`
+		Summary    *reportSummary     `json:"summary"`
+		Runs       []Run              `json:"runs"`
+		Results    []*TestResult      `json:"results"`
+		Exclusions []filter.Exclusion `json:"exclusions,omitempty"`
 	}
 
 	json, err := json.Marshal(jsonReport{
-		Summary: summary,
-		Results: results,
+		Summary:    summary,
+		Runs:       runs,
+		Results:    results,
+		Exclusions: exclusions,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to marshal report to JSON: %w", err)
@@ -0,0 +1,67 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FlakyTests returns the results of the tests that both passed and failed
+func FlakyTests(results []*TestResult) []*TestResult {
+	flaky := []*TestResult{}
+	for _, result := range results {
+		if result.Flaky() {
+			flaky = append(flaky, result)
+		}
+	}
+	return flaky
+}
+
+// FailingTests returns the results of the tests that failed every run
+func FailingTests(results []*TestResult) []*TestResult {
+	failing := []*TestResult{}
+	for _, result := range results {
+		if result.Runs > 0 && result.Successes == 0 && result.Failures > 0 {
+			failing = append(failing, result)
+		}
+	}
+	return failing
+}
+
+// WriteMarkdownSummary writes a markdown summary of the flaky tests for pull request comments and check runs: a table
+// of the tests and their classification, followed by the commands to reproduce each of them.
+func WriteMarkdownSummary(w io.Writer, results []*TestResult) error {
+	flaky := FlakyTests(results)
+	var b strings.Builder
+	fmt.Fprintf(&b, "### :snowflake: Flakeguard found %d flaky %s\n\n", len(flaky), plural(len(flaky), "test", "tests"))
+	b.WriteString("| Test | Package | Classification | Pass Ratio | Runs |\n")
+	b.WriteString("| --- | --- | --- | --- | --- |\n")
+	for _, result := range flaky {
+		fmt.Fprintf(&b, "| `%s` | `%s` | %s | %.2f%% | %d |\n",
+			result.Name, result.Package, result.Classification(), result.PassRatio*100, result.Runs)
+	}
+
+	for _, result := range flaky {
+		findings := result.findings()
+		if len(findings) == 0 && len(result.ReproductionCommands) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n<details>\n<summary><code>%s</code></summary>\n\n", result.Name)
+		for _, finding := range findings {
+			fmt.Fprintf(&b, "- %s\n", finding)
+		}
+		for _, command := range result.ReproductionCommands {
+			fmt.Fprintf(&b, "\n%s:\n```sh\n%s\n```\n", command.Description, command.Command)
+		}
+		b.WriteString("\n</details>\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return singular
+	}
+	return pluralForm
+}
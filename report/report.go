@@ -6,10 +6,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
 	"golang.org/x/sync/errgroup"
+
+	"github.com/smartcontractkit/flakeguard/filter"
 )
 
 // TestResult contains the results and outputs of a single test
@@ -40,6 +44,75 @@ type TestResult struct {
 	Durations         []time.Duration `json:"durations,omitempty"`
 	// Run number -> outputs
 	Outputs map[int][]string `json:"outputs,omitempty"`
+
+	// Failure rates of the test in runs that executed alongside other runs, and in runs that executed alone
+	ParallelFailureRate   float64 `json:"parallel_failure_rate,omitempty"`
+	SequentialFailureRate float64 `json:"sequential_failure_rate,omitempty"`
+	// If the test failed significantly more often in parallel runs than in sequential runs,
+	// it likely shares state (files, ports, databases) with other processes.
+	CrossProcessInterference bool `json:"cross_process_interference,omitempty"`
+	// Matrix settings the test fails significantly more often with
+	SettingCorrelations []SettingCorrelation `json:"setting_correlations,omitempty"`
+	// Commands to reproduce the first failing run of the test
+	ReproductionCommands []ReproductionCommand `json:"reproduction_commands,omitempty"`
+	// GoroutineDumps are the files holding the goroutine dumps of runs killed while the test was still running
+	GoroutineDumps []string `json:"goroutine_dumps,omitempty"`
+	// History is how the test did in past sessions, if history was available
+	History *History `json:"history,omitempty"`
+
+	// Numbers of the runs the test executed in
+	runNumbers []int
+}
+
+// History is how a test did in past sessions, within a window of time
+type History struct {
+	Runs     int           `json:"runs"`
+	Failures int           `json:"failures"`
+	Window   time.Duration `json:"window"`
+}
+
+// FailureRate is the share of past runs the test failed in
+func (h History) FailureRate() float64 {
+	if h.Runs == 0 {
+		return 0
+	}
+	return float64(h.Failures) / float64(h.Runs)
+}
+
+// WindowString describes the window to follow "over the last", e.g. "7 days"
+func (h History) WindowString() string {
+	day := 24 * time.Hour
+	switch {
+	case h.Window == day:
+		return "day"
+	case h.Window%day == 0:
+		return fmt.Sprintf("%d days", h.Window/day)
+	default:
+		return h.Window.String()
+	}
+}
+
+// HistoryLookup returns how a test did in past sessions, and false if there's no history of it
+type HistoryLookup func(pkg, test string) (History, bool)
+
+// SettingCorrelation is a matrix setting that a test fails significantly more often with
+type SettingCorrelation struct {
+	// Setting is a go test flag (like -cpu) or env var (like TZ)
+	Setting string `json:"setting"`
+	Value   string `json:"value"`
+	// Failure rates of the test in runs with the value, and in runs with any other value of the setting
+	FailureRate      float64 `json:"failure_rate"`
+	OtherFailureRate float64 `json:"other_failure_rate"`
+}
+
+func (c SettingCorrelation) String() string {
+	if c.OtherFailureRate == 0 {
+		return fmt.Sprintf("Fails only with %s=%s (%.2f%% of runs)", c.Setting, c.Value, c.FailureRate*100)
+	}
+	return fmt.Sprintf(
+		"Fails more often with %s=%s (%.2f%%) than with other values (%.2f%%)",
+		c.Setting, c.Value, c.FailureRate*100, c.OtherFailureRate*100,
+	)
 }
 
 // TestRunInfo details meta information about the code where the tests were run
@@ -67,6 +140,12 @@ type TestRunInfo struct {
 	GitHubRunID string `json:"github_run_id,omitempty"`
 	// If the test was run in a GitHub Actions environment, this is the run number
 	GitHubRunNumber string `json:"github_run_number,omitempty"`
+	// If the test was run in a GitHub Actions environment, this is the attempt of the run, starting at 1
+	GitHubRunAttempt string `json:"github_run_attempt,omitempty"`
+	// If the test was run in a GitHub Actions environment, this is the name of the runner it ran on
+	RunnerName string `json:"runner_name,omitempty"`
+	// If the tests were run for a pull request, this is its number
+	PullRequestNumber int `json:"pull_request_number,omitempty"`
 }
 
 func (t *TestResult) String() string {
@@ -87,6 +166,82 @@ func (t *TestResult) String() string {
 	)
 }
 
+// Flaky is true if the test both passed and failed across runs. Tests that fail every run are broken, not flaky.
+func (t *TestResult) Flaky() bool {
+	return t.Successes > 0 && t.Successes < t.Runs
+}
+
+// Classification is the most likely kind of flakiness, from what the analysis found out about the test's failures
+func (t *TestResult) Classification() string {
+	switch {
+	case t.Race:
+		return "data race"
+	case t.Panic:
+		return "panic"
+	case t.Timeout:
+		return "timeout"
+	case t.PackagePanic:
+		return "panic in package"
+	case t.CrossProcessInterference:
+		return "cross-process interference"
+	case len(t.SettingCorrelations) > 0:
+		return "setting dependent"
+	default:
+		return "flaky"
+	}
+}
+
+// FailureSignature is the line of output that best describes why the test failed in its first failing run:
+// the panic, data race warning, or first test error. It's empty if the test never failed or no such line was found.
+func (t *TestResult) FailureSignature() string {
+	if len(t.FailingRunNumbers) == 0 {
+		return ""
+	}
+	for _, output := range t.Outputs[slices.Min(t.FailingRunNumbers)] {
+		line := strings.TrimRight(output, "\n")
+		if panicRe.MatchString(line) || raceRe.MatchString(line) || testErrorRe.MatchString(line) {
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
+}
+
+// notes returns human-readable hints about the test result to show alongside it in reports
+func (t *TestResult) notes() []string {
+	notes := t.findings()
+	for _, command := range t.ReproductionCommands {
+		notes = append(notes, fmt.Sprintf("%s: %s", command.Description, command.Command))
+	}
+	return notes
+}
+
+// findings are the notes about what the analysis found out about the test's failures
+func (t *TestResult) findings() []string {
+	findings := []string{}
+	if t.CrossProcessInterference {
+		findings = append(findings, fmt.Sprintf(
+			"Fails more often in parallel runs (%.2f%%) than in sequential runs (%.2f%%), it may share state with other processes",
+			t.ParallelFailureRate*100,
+			t.SequentialFailureRate*100,
+		))
+	}
+	for _, correlation := range t.SettingCorrelations {
+		findings = append(findings, correlation.String())
+	}
+	for _, dump := range t.GoroutineDumps {
+		findings = append(findings, fmt.Sprintf("Goroutine dump: %s", dump))
+	}
+	if t.History != nil && t.History.Runs > 0 {
+		runs, failures := t.History.Runs+t.Runs, t.History.Failures+t.Failures
+		findings = append(findings, fmt.Sprintf(
+			"Failed in %d of %d runs over the last %s (%.2f%%), %d of %d including this session (%.2f%%)",
+			t.History.Failures, t.History.Runs, t.History.WindowString(), t.History.FailureRate()*100,
+			failures, runs, float64(failures)/float64(runs)*100,
+		))
+	}
+	return findings
+}
+
 // testOutputLine is a single line of test output from the go test -json
 type testOutputLine struct {
 	Action  string    `json:"Action,omitempty"`
@@ -95,6 +250,9 @@ type testOutputLine struct {
 	Output  string    `json:"Output,omitempty"`
 	Elapsed float64   `json:"Elapsed,omitempty"` // Decimal value in seconds
 	Time    time.Time `json:"Time,omitempty"`    // Time of the log
+
+	// Run is the number of the run that produced the line, it is not part of go test output
+	Run int `json:"-"`
 }
 
 type reportSummary struct {
@@ -133,6 +291,13 @@ type reportOptions struct {
 	jsonFile     string
 	markdownFile string
 
+	// filter leaves ignored packages and tests out of the report
+	filter *filter.Filter
+	// exclusions were left out before the tests ran, and are listed in the report along with the ones filter leaves out
+	exclusions []filter.Exclusion
+	// history looks up how tests did in past sessions, to show alongside their results
+	history HistoryLookup
+
 	// Remote reporting
 	// Splunk
 	splunkURL        string
@@ -141,12 +306,15 @@ type reportOptions struct {
 	splunkSourceType string
 }
 
+// DefaultJSONFile is the name of the JSON report written to the report dir, unless ToJSON changes it
+const DefaultJSONFile = "flakeguard-report.json"
+
 func defaultOptions() reportOptions {
 	return reportOptions{
 		reportDir:    "./flakeguard-output",
 		toConsole:    true,
 		reportFile:   "flakeguard-report.txt",
-		jsonFile:     "flakeguard-report.json",
+		jsonFile:     DefaultJSONFile,
 		markdownFile: "flakeguard-report.md",
 	}
 }
@@ -189,6 +357,27 @@ func ToJSON(path string) Option {
 	}
 }
 
+// WithFilter leaves the packages and tests the filter excludes out of the report, and lists them instead
+func WithFilter(f *filter.Filter) Option {
+	return func(o *reportOptions) {
+		o.filter = f
+	}
+}
+
+// WithExclusions lists packages and tests that were left out before running in the report
+func WithExclusions(exclusions []filter.Exclusion) Option {
+	return func(o *reportOptions) {
+		o.exclusions = exclusions
+	}
+}
+
+// WithHistory adds how each test did in past sessions to its result
+func WithHistory(lookup HistoryLookup) Option {
+	return func(o *reportOptions) {
+		o.history = lookup
+	}
+}
+
 // ToSplunk sends the report to Splunk via HTTP Event Collector
 func ToSplunk(url, token, index, sourceType string) Option {
 	return func(o *reportOptions) {
@@ -207,60 +396,134 @@ func ToSplunk(url, token, index, sourceType string) Option {
 	}
 }
 
-// New creates a new report from scanning go test -json output. It will then send the report to selected destinations.
-func New(l zerolog.Logger, testRunInfo TestRunInfo, files []string, options ...Option) error {
+// New creates a new report from scanning the go test -json output of each run.
+// It will then send the report to selected destinations, and return the results for every test.
+func New(l zerolog.Logger, testRunInfo TestRunInfo, runs []Run, options ...Option) ([]*TestResult, error) {
 	opts := defaultOptions()
 	for _, option := range options {
 		option(&opts)
 	}
 
-	lines, err := readTestOutput(l, opts.reportDir, files...)
+	lines, runs, err := readRunOutput(l, opts.reportDir, runs)
 	if err != nil {
-		return fmt.Errorf("failed to read test output: %w", err)
+		return nil, fmt.Errorf("failed to read test output: %w", err)
 	}
+	lines, excluded := excludeLines(lines, opts.filter)
+	exclusions := append(slices.Clone(opts.exclusions), excluded...)
 
 	summary, results, err := analyzeTestOutput(l, lines)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	markHungTests(summary, results, lines, runs)
+	compareParallelRuns(results, runs)
+	correlateSettings(results, runs)
+	addReproductionCommands(results, runs)
 
 	for _, result := range results {
 		result.TestRunInfo = testRunInfo
+		if result.Runs > 0 {
+			result.PassRatio = float64(result.Successes) / float64(result.Runs)
+		}
+		if opts.history == nil {
+			continue
+		}
+		if h, ok := opts.history(result.Package, result.Name); ok {
+			result.History = &h
+		}
 	}
 
 	eg := errgroup.Group{}
 	if opts.toConsole {
 		eg.Go(func() error {
-			return writeToConsole(summary, results)
+			return writeToConsole(summary, results, runs, exclusions)
 		})
 	}
 
 	if opts.reportFile != "" {
 		eg.Go(func() error {
-			return writeToTextFile(l, summary, results, opts.reportDir, opts.reportFile)
+			return writeToTextFile(l, summary, results, runs, exclusions, opts.reportDir, opts.reportFile)
 		})
 	}
 
 	if opts.jsonFile != "" {
 		eg.Go(func() error {
-			return writeToJSONFile(l, summary, results, opts.reportDir, opts.jsonFile)
+			return writeToJSONFile(l, summary, results, runs, exclusions, opts.reportDir, opts.jsonFile)
 		})
 	}
 
 	if err := eg.Wait(); err != nil {
-		return fmt.Errorf("failed to write report: %w", err)
+		return nil, fmt.Errorf("failed to write report: %w", err)
+	}
+
+	return results, nil
+}
+
+// Analyze reads the go test -json output of each run and returns the results for every test, without reporting them anywhere.
+// Tests the filter excludes are left out, f may be nil.
+func Analyze(l zerolog.Logger, dir string, runs []Run, f *filter.Filter) ([]*TestResult, error) {
+	lines, runs, err := readRunOutput(l, dir, runs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test output: %w", err)
 	}
+	lines, _ = excludeLines(lines, f)
+
+	summary, results, err := analyzeTestOutput(l, lines)
+	if err != nil {
+		return nil, err
+	}
+	markHungTests(summary, results, lines, runs)
+	compareParallelRuns(results, runs)
+	correlateSettings(results, runs)
+	addReproductionCommands(results, runs)
+	return results, nil
+}
 
-	return nil
+// readRunOutput reads the JSON output of each run, tagging every line with the number of the run that produced it.
+// The returned runs are sorted by number, and filled in with the shuffle seeds found in their output.
+func readRunOutput(l zerolog.Logger, dir string, runs []Run) ([]*testOutputLine, []Run, error) {
+	runs = slices.Clone(runs)
+	slices.SortFunc(runs, func(a, b Run) int {
+		return a.Number - b.Number
+	})
+
+	lines := []*testOutputLine{}
+	for i, run := range runs {
+		runLines, err := readTestOutput(l, dir, run.File)
+		if err != nil && run.Killed {
+			// gotestsum may have been killed halfway through writing a line, keep everything before it
+			l.Warn().Err(err).Int("run", run.Number).Msg("Output of killed run is cut short")
+			err = nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, line := range runLines {
+			line.Run = run.Number
+			if line.Test != "" || line.Action != "output" {
+				continue
+			}
+			if seed, ok := parseShuffleSeed(line.Output); ok {
+				if runs[i].ShuffleSeeds == nil {
+					runs[i].ShuffleSeeds = map[string]int64{}
+				}
+				runs[i].ShuffleSeeds[line.Package] = seed
+			}
+		}
+		lines = append(lines, runLines...)
+	}
+	return lines, runs, nil
 }
 
-// readTestOutput reads the JSON output of a test suite run into structs
+// readTestOutput reads the JSON output of a test suite run into structs.
+// Lines are tagged with the 1-based position of the file they were read from as their run number.
+// If a file can't be decoded, the lines read up to that point are returned with the error.
 func readTestOutput(l zerolog.Logger, dir string, files ...string) ([]*testOutputLine, error) {
 	l.Debug().Strs("files", files).Msg("Reading test output")
 	start := time.Now()
 
 	lines := []*testOutputLine{}
-	for _, file := range files {
+	for fileIndex, file := range files {
 		filePath := filepath.Join(dir, file)
 		//nolint:gosec // we're reading from our own files
 		jsonFile, err := os.Open(filePath)
@@ -275,9 +538,9 @@ func readTestOutput(l zerolog.Logger, dir string, files ...string) ([]*testOutpu
 
 		decoder := json.NewDecoder(jsonFile)
 		for decoder.More() {
-			var line testOutputLine
+			line := testOutputLine{Run: fileIndex + 1}
 			if err := decoder.Decode(&line); err != nil {
-				return nil, fmt.Errorf("error unmarshalling go test -json output: %w", err)
+				return lines, fmt.Errorf("error unmarshalling go test -json output: %w", err)
 			}
 			lines = append(lines, &line)
 		}
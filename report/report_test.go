@@ -1,10 +1,12 @@
 package report
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/smartcontractkit/flakeguard/filter"
 	"github.com/smartcontractkit/flakeguard/internal/testhelpers"
 )
 
@@ -24,3 +26,213 @@ func TestReadTestOutput(t *testing.T) {
 	// TODO: Better validation
 	require.Len(t, lines, 638)
 }
+
+func TestCompareParallelRuns(t *testing.T) {
+	t.Parallel()
+
+	runs := []Run{}
+	for number := 1; number <= 40; number++ {
+		runs = append(runs, Run{Number: number, Parallel: number <= 20})
+	}
+
+	var (
+		interfering = &TestResult{Name: "TestSharesPort"}
+		flaky       = &TestResult{Name: "TestFlaky"}
+	)
+	for _, run := range runs {
+		interfering.runNumbers = append(interfering.runNumbers, run.Number)
+		flaky.runNumbers = append(flaky.runNumbers, run.Number)
+		if run.Parallel && run.Number%2 == 0 {
+			interfering.FailingRunNumbers = append(interfering.FailingRunNumbers, run.Number)
+		}
+		if run.Number%10 == 0 {
+			flaky.FailingRunNumbers = append(flaky.FailingRunNumbers, run.Number)
+		}
+	}
+
+	compareParallelRuns([]*TestResult{interfering, flaky}, runs)
+	require.True(t, interfering.CrossProcessInterference, "test failing only in parallel runs should be flagged")
+	require.InDelta(t, 0.5, interfering.ParallelFailureRate, 0.001)
+	require.InDelta(t, 0, interfering.SequentialFailureRate, 0.001)
+	require.False(t, flaky.CrossProcessInterference, "test failing at the same rate everywhere should not be flagged")
+}
+
+func TestFailureRateInterval(t *testing.T) {
+	t.Parallel()
+
+	low, high := FailureRateInterval(5, 10, 0.95)
+	require.InDelta(t, 0.237, low, 0.001)
+	require.InDelta(t, 0.763, high, 0.001)
+
+	moreLow, moreHigh := FailureRateInterval(50, 100, 0.95)
+	require.Less(t, moreHigh-moreLow, high-low, "interval should narrow with more runs")
+
+	low, high = FailureRateInterval(0, 0, 0.95)
+	require.InDelta(t, 0.0, low, 0)
+	require.InDelta(t, 1.0, high, 0)
+}
+
+func TestCorrelateSettings(t *testing.T) {
+	t.Parallel()
+
+	runs := []Run{}
+	for number := 1; number <= 40; number++ {
+		cpu := "4"
+		if number%2 == 0 {
+			cpu = "1"
+		}
+		runs = append(runs, Run{Number: number, Settings: map[string]string{"-cpu": cpu, "TZ": "UTC"}})
+	}
+
+	var (
+		cpuBound = &TestResult{Name: "TestNeedsCPUs"}
+		flaky    = &TestResult{Name: "TestFlaky"}
+	)
+	for _, run := range runs {
+		cpuBound.runNumbers = append(cpuBound.runNumbers, run.Number)
+		flaky.runNumbers = append(flaky.runNumbers, run.Number)
+		if run.Settings["-cpu"] == "1" && run.Number%4 == 0 {
+			cpuBound.FailingRunNumbers = append(cpuBound.FailingRunNumbers, run.Number)
+		}
+		if run.Number%5 == 0 {
+			flaky.FailingRunNumbers = append(flaky.FailingRunNumbers, run.Number)
+		}
+	}
+
+	correlateSettings([]*TestResult{cpuBound, flaky}, runs)
+	require.Equal(t, []SettingCorrelation{
+		{Setting: "-cpu", Value: "1", FailureRate: 0.5, OtherFailureRate: 0},
+	}, cpuBound.SettingCorrelations)
+	require.Equal(t, "Fails only with -cpu=1 (50.00% of runs)", cpuBound.SettingCorrelations[0].String())
+	require.Empty(t, flaky.SettingCorrelations, "test failing at the same rate with every setting should not be flagged")
+}
+
+func TestAddReproductionCommands(t *testing.T) {
+	t.Parallel()
+
+	runs := []Run{
+		{Number: 1},
+		{
+			Number:            2,
+			ReproductionFlags: []string{"-tags", "examples"},
+			Settings:          map[string]string{"-cpu": "1", "TZ": "Asia/Tokyo"},
+			ShuffleSeeds:      map[string]int64{"example.com/pkg": 42},
+		},
+	}
+	failing := &TestResult{Name: "TestA/sub test", Package: "example.com/pkg", FailingRunNumbers: []int{2}}
+	passing := &TestResult{Name: "TestB", Package: "example.com/pkg"}
+
+	addReproductionCommands([]*TestResult{failing, passing}, runs)
+	require.Empty(t, passing.ReproductionCommands)
+	require.Equal(t, []ReproductionCommand{
+		{
+			Description: "Run the test alone",
+			Command:     `TZ=Asia/Tokyo go test example.com/pkg '-run=^TestA$/^sub test$' -count=1 -tags examples`,
+		},
+		{
+			Description: "Run the package in the same order as the failing run",
+			Command:     `TZ=Asia/Tokyo go test example.com/pkg -shuffle=42 -count=1 -tags examples`,
+		},
+		{
+			Description: "Stress the test until it fails",
+			Command:     `TZ=Asia/Tokyo go test example.com/pkg '-run=^TestA$/^sub test$' -count=100 -failfast -tags examples`,
+		},
+	}, failing.ReproductionCommands)
+}
+
+func TestParseShuffleSeed(t *testing.T) {
+	t.Parallel()
+
+	seed, ok := parseShuffleSeed("-test.shuffle 1792361463145401819\n")
+	require.True(t, ok)
+	require.Equal(t, int64(1792361463145401819), seed)
+
+	_, ok = parseShuffleSeed("=== RUN   TestA\n")
+	require.False(t, ok)
+}
+
+func TestMarkHungTests(t *testing.T) {
+	t.Parallel()
+
+	lines := []*testOutputLine{
+		{Run: 1, Action: "run", Package: "pkg", Test: "TestHang"},
+		{Run: 1, Action: "run", Package: "pkg", Test: "TestPass"},
+		{Run: 1, Action: "pass", Package: "pkg", Test: "TestPass"},
+		{Run: 2, Action: "run", Package: "pkg", Test: "TestHang"},
+		{Run: 2, Action: "pass", Package: "pkg", Test: "TestHang"},
+	}
+	runs := []Run{{Number: 1, Killed: true, GoroutineDump: "run-1-goroutines.txt"}, {Number: 2}}
+	summary := &reportSummary{}
+	hang := &TestResult{Package: "pkg", Name: "TestHang", Runs: 1, Successes: 1}
+	pass := &TestResult{Package: "pkg", Name: "TestPass", Runs: 1, Successes: 1}
+
+	markHungTests(summary, []*TestResult{hang, pass}, lines, runs)
+	require.True(t, hang.Timeout, "test that never finished in a killed run should be marked as timed out")
+	require.Equal(t, []int{1}, hang.FailingRunNumbers)
+	require.Equal(t, 2, hang.Runs)
+	require.Equal(t, []string{"run-1-goroutines.txt"}, hang.GoroutineDumps, "hung test should link the dump of the run")
+	require.False(t, pass.Timeout)
+	require.Empty(t, pass.GoroutineDumps)
+	require.Equal(t, 1, summary.Timeouts)
+}
+
+func TestExcludeLines(t *testing.T) {
+	t.Parallel()
+
+	f, err := filter.New([]string{"e2e/..."}, nil, []string{"TestKnownBad"}, nil)
+	require.NoError(t, err)
+	lines := []*testOutputLine{
+		{Run: 1, Action: "run", Package: "pkg", Test: "TestKnownBad"},
+		{Run: 1, Action: "run", Package: "pkg", Test: "TestKnownBad/sub"},
+		{Run: 1, Action: "run", Package: "pkg", Test: "TestGood"},
+		{Run: 1, Action: "output", Package: "pkg", Output: "ok"},
+		{Run: 1, Action: "run", Package: "e2e/smoke", Test: "TestGood"},
+		{Run: 1, Action: "output", Package: "e2e/smoke", Output: "ok"},
+		{Run: 2, Action: "run", Package: "pkg", Test: "TestKnownBad"},
+	}
+
+	kept, exclusions := excludeLines(lines, f)
+	require.Equal(t, []*testOutputLine{lines[2], lines[3]}, kept)
+	require.Equal(t, []filter.Exclusion{
+		{Package: "pkg", Test: "TestKnownBad", Rule: `ignored by test pattern "TestKnownBad"`},
+		{Package: "pkg", Test: "TestKnownBad/sub", Rule: `ignored by test pattern "TestKnownBad"`},
+		{Package: "e2e/smoke", Rule: `ignored by package pattern "e2e/..."`},
+	}, exclusions, "every exclusion should be listed once, tests of excluded packages are covered by the package")
+}
+
+func TestWriteMarkdownSummary(t *testing.T) {
+	t.Parallel()
+
+	results := []*TestResult{
+		{
+			Name: "TestRace", Package: "pkg", Race: true, Runs: 10, Successes: 8, Failures: 2, PassRatio: 0.8,
+			ReproductionCommands: []ReproductionCommand{{Description: "Run the test alone", Command: "go test pkg -run=^TestRace$"}},
+		},
+		{Name: "TestBroken", Package: "pkg", Runs: 10, Failures: 10},
+		{Name: "TestPass", Package: "pkg", Runs: 10, Successes: 10, PassRatio: 1},
+	}
+	require.Len(t, FlakyTests(results), 1, "tests failing every run are broken, not flaky")
+	require.Equal(t, []*TestResult{results[1]}, FailingTests(results))
+
+	var comment strings.Builder
+	require.NoError(t, WriteMarkdownSummary(&comment, results))
+	require.Contains(t, comment.String(), "Flakeguard found 1 flaky test\n")
+	require.Contains(t, comment.String(), "| `TestRace` | `pkg` | data race | 80.00% | 10 |")
+	require.Contains(t, comment.String(), "Run the test alone:\n```sh\ngo test pkg -run=^TestRace$\n```")
+	require.NotContains(t, comment.String(), "TestBroken")
+}
+
+func TestFailureSignature(t *testing.T) {
+	t.Parallel()
+
+	result := &TestResult{
+		FailingRunNumbers: []int{3, 2},
+		Outputs: map[int][]string{
+			1: {"=== RUN   TestFlaky\n", "--- PASS: TestFlaky (0.00s)\n"},
+			2: {"=== RUN   TestFlaky\n", "    flaky_test.go:26: expected 1, got 2\n", "--- FAIL: TestFlaky (0.00s)\n"},
+			3: {"=== RUN   TestFlaky\n", "panic: runtime error: index out of range [1] with length 1\n"},
+		},
+	}
+	require.Equal(t, "flaky_test.go:26: expected 1, got 2", result.FailureSignature(), "should come from the first failing run")
+	require.Empty(t, (&TestResult{}).FailureSignature())
+}
@@ -0,0 +1,117 @@
+package report
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// stressCount is how many times the stress reproduction command runs a test
+	stressCount = 100
+)
+
+var (
+	shuffleSeedRe = regexp.MustCompile(`^-test\.shuffle (\d+)`)
+	// shellSafeRe matches strings that don't need quoting in a shell
+	shellSafeRe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+)
+
+// ReproductionCommand is a command a developer can copy and paste to reproduce a failing test
+type ReproductionCommand struct {
+	Description string `json:"description"`
+	Command     string `json:"command"`
+}
+
+// parseShuffleSeed returns the seed go test prints at the start of a package run when using -shuffle=on
+func parseShuffleSeed(output string) (int64, bool) {
+	match := shuffleSeedRe.FindStringSubmatch(output)
+	if match == nil {
+		return 0, false
+	}
+	seed, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return seed, true
+}
+
+// addReproductionCommands gives every failing test commands to reproduce its first failing run: running the test
+// alone, running its whole package in the same order with the failing shuffle seed, and a stress loop.
+func addReproductionCommands(results []*TestResult, runs []Run) {
+	runsByNumber := make(map[int]Run, len(runs))
+	for _, run := range runs {
+		runsByNumber[run.Number] = run
+	}
+
+	for _, result := range results {
+		if len(result.FailingRunNumbers) == 0 {
+			continue
+		}
+		run, ok := runsByNumber[slices.Min(result.FailingRunNumbers)]
+		if !ok {
+			continue
+		}
+
+		testPattern := runPattern(result.Name)
+		result.ReproductionCommands = []ReproductionCommand{
+			{
+				Description: "Run the test alone",
+				Command:     goTestCommand(run, result.Package, "-run="+testPattern, "-count=1"),
+			},
+		}
+		if seed, ok := run.ShuffleSeeds[result.Package]; ok {
+			result.ReproductionCommands = append(result.ReproductionCommands, ReproductionCommand{
+				Description: "Run the package in the same order as the failing run",
+				Command:     goTestCommand(run, result.Package, fmt.Sprintf("-shuffle=%d", seed), "-count=1"),
+			})
+		}
+		result.ReproductionCommands = append(result.ReproductionCommands, ReproductionCommand{
+			Description: "Stress the test until it fails",
+			Command: goTestCommand(
+				run, result.Package, "-run="+testPattern, fmt.Sprintf("-count=%d", stressCount), "-failfast",
+			),
+		})
+	}
+}
+
+// goTestCommand builds a go test command for a package with the flags and env vars of the run
+func goTestCommand(run Run, pkg string, flags ...string) string {
+	parts := []string{}
+	envVars := make([]string, 0, len(run.Settings))
+	for setting, value := range run.Settings {
+		if !strings.HasPrefix(setting, "-") {
+			envVars = append(envVars, shellQuote(setting+"="+value))
+		}
+	}
+	slices.Sort(envVars)
+	parts = append(parts, envVars...)
+
+	parts = append(parts, "go", "test", shellQuote(pkg))
+	for _, flag := range flags {
+		parts = append(parts, shellQuote(flag))
+	}
+	for _, flag := range run.ReproductionFlags {
+		parts = append(parts, shellQuote(flag))
+	}
+	return strings.Join(parts, " ")
+}
+
+// runPattern builds a -run pattern that only matches the test, including its parents if it's a subtest
+func runPattern(testName string) string {
+	levels := strings.Split(testName, "/")
+	for i, level := range levels {
+		levels[i] = "^" + regexp.QuoteMeta(level) + "$"
+	}
+	return strings.Join(levels, "/")
+}
+
+// shellQuote quotes s for a POSIX shell, if needed
+func shellQuote(s string) string {
+	if shellSafeRe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,65 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Phases of a detect or guard session
+const (
+	// PhaseFull runs execute the full test suite
+	PhaseFull = "full"
+	// PhaseAdaptive runs are narrowed to suspicious tests
+	PhaseAdaptive = "adaptive"
+	// PhaseSequential runs execute the full test suite one at a time, as a baseline for parallel runs
+	PhaseSequential = "sequential"
+	// PhaseRetry runs are narrowed to the tests that failed in guard, until they pass
+	PhaseRetry = "retry"
+)
+
+// Run describes a single execution of the test suite whose output is part of the report
+type Run struct {
+	// Number is the 1-based number of the run in the detect session
+	Number int `json:"number"`
+	// Phase is the phase of the detect session the run belongs to
+	Phase string `json:"phase,omitempty"`
+	// File is the go test -json output of the run, relative to the report directory
+	File     string        `json:"file"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	// Killed is true if the run timed out or stalled and was killed, its output may be cut short
+	Killed     bool   `json:"killed,omitempty"`
+	KillReason string `json:"kill_reason,omitempty"`
+	// GoroutineDump is the file holding the goroutines the test binaries dumped before the run was killed,
+	// relative to the report directory
+	GoroutineDump string `json:"goroutine_dump,omitempty"`
+	// Parallel is true if the run executed alongside other runs
+	Parallel bool `json:"parallel,omitempty"`
+	// Env is the environment that was set specifically for this run, on top of the inherited environment
+	Env []string `json:"env,omitempty"`
+	// GoTestFlags are the go test flags the run executed with
+	GoTestFlags []string `json:"go_test_flags,omitempty"`
+	// ReproductionFlags are the go test flags needed to reproduce the run, without packages, -run, -count, and -shuffle
+	ReproductionFlags []string `json:"reproduction_flags,omitempty"`
+	// ShuffleSeeds are the seeds go test printed when running with -shuffle=on, package -> seed
+	ShuffleSeeds map[string]int64 `json:"shuffle_seeds,omitempty"`
+	// Settings are the matrix settings the run executed with, go test flags (like -cpu) or env vars (like TZ) -> value
+	Settings map[string]string `json:"settings,omitempty"`
+}
+
+// killedRunsNote returns a human-readable note about runs that were killed, or an empty string if there were none
+func killedRunsNote(runs []Run) string {
+	killed := []string{}
+	for _, run := range runs {
+		if !run.Killed {
+			continue
+		}
+		note := fmt.Sprintf("Run %d killed: %s", run.Number, run.KillReason)
+		if run.GoroutineDump != "" {
+			note += fmt.Sprintf(", goroutine dump in %s", run.GoroutineDump)
+		}
+		killed = append(killed, note)
+	}
+	return strings.Join(killed, "\n")
+}
@@ -0,0 +1,50 @@
+package report
+
+import (
+	"math"
+)
+
+// zScore returns the one-sided z-score for the given confidence level (e.g. 0.95 -> 1.645)
+func zScore(confidence float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*confidence-1)
+}
+
+// minComparisonRuns is the fewest runs on each side for a comparison of failure rates to mean anything,
+// the z-test's normal approximation falls apart below it
+const minComparisonRuns = 5
+
+// SignificantlyHigher reports whether the failure rate failuresA/runsA is higher than failuresB/runsB
+// with the given confidence, using a one-sided two-proportion z-test.
+func SignificantlyHigher(failuresA, runsA, failuresB, runsB int, confidence float64) bool {
+	if runsA < minComparisonRuns || runsB < minComparisonRuns {
+		return false
+	}
+	rateA := float64(failuresA) / float64(runsA)
+	rateB := float64(failuresB) / float64(runsB)
+	if rateA <= rateB {
+		return false
+	}
+
+	pooled := float64(failuresA+failuresB) / float64(runsA+runsB)
+	stdErr := math.Sqrt(pooled * (1 - pooled) * (1/float64(runsA) + 1/float64(runsB)))
+	if stdErr == 0 {
+		return false
+	}
+	return (rateA-rateB)/stdErr >= zScore(confidence)
+}
+
+// FailureRateInterval returns the Wilson score interval of the failure rate failures/runs at the given two-sided confidence.
+// The interval narrows as runs grow, telling how precisely the failure rate is known.
+func FailureRateInterval(failures, runs int, confidence float64) (low, high float64) {
+	if runs == 0 {
+		return 0, 1
+	}
+	n := float64(runs)
+	rate := float64(failures) / n
+	z := zScore((1 + confidence) / 2)
+	z2 := z * z
+
+	center := (rate + z2/(2*n)) / (1 + z2/n)
+	margin := z / (1 + z2/n) * math.Sqrt(rate*(1-rate)/n+z2/(4*n*n))
+	return math.Max(0, center-margin), math.Min(1, center+margin)
+}
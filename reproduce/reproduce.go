@@ -0,0 +1,159 @@
+// Package reproduce tries to reproduce a flaky test by running it under increasingly hostile conditions,
+// following the steps of the fixing flaky tests guide.
+package reproduce
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Condition is a way of running a flaky test that might make it fail
+type Condition struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// WholePackage runs every test in the test's package, rather than just the test
+	WholePackage bool `json:"whole_package"`
+	// GoTestFlags are added to the go test flags when running under this condition
+	GoTestFlags []string `json:"go_test_flags,omitempty"`
+}
+
+// DefaultConditions are the steps of the fixing flaky tests guide, from least to most hostile
+func DefaultConditions() []Condition {
+	return []Condition{
+		{
+			Name:        "isolated",
+			Description: "Run the test alone, over and over",
+		},
+		{
+			Name:         "package",
+			Description:  "Run the test with the rest of its package",
+			WholePackage: true,
+		},
+		{
+			Name:         "shuffle",
+			Description:  "Run the package in random order",
+			WholePackage: true,
+			GoTestFlags:  []string{"-shuffle=on"},
+		},
+		{
+			Name:         "race",
+			Description:  "Run the package in random order with the race detector",
+			WholePackage: true,
+			GoTestFlags:  []string{"-shuffle=on", "-race"},
+		},
+		{
+			Name:         "cpu",
+			Description:  "Run the package in random order with different GOMAXPROCS and parallelism",
+			WholePackage: true,
+			GoTestFlags:  []string{"-shuffle=on", "-cpu=1,2,4", "-parallel=4"},
+		},
+	}
+}
+
+// Attempt runs the test once under the condition, and returns how many times the test executed and how many of
+// those executions failed.
+type Attempt func(ctx context.Context, condition Condition) (executions, failures int, err error)
+
+// Result is the outcome of trying to reproduce a test under a single condition
+type Result struct {
+	Condition   Condition     `json:"condition"`
+	Executions  int           `json:"executions"`
+	Failures    int           `json:"failures"`
+	FailureRate float64       `json:"failure_rate"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// Reproduced reports whether the test failed under the condition
+func (r Result) Reproduced() bool {
+	return r.Failures > 0
+}
+
+// Run makes attempts under each condition until the test fails or the condition's budget runs out.
+// Budgets are soft, an attempt that started within the budget is allowed to finish.
+// Unless all is set, it stops at the first condition that reproduces the failure.
+func Run(
+	ctx context.Context,
+	l zerolog.Logger,
+	conditions []Condition,
+	budget time.Duration,
+	all bool,
+	attempt Attempt,
+) ([]Result, error) {
+	results := make([]Result, 0, len(conditions))
+	for _, condition := range conditions {
+		cl := l.With().Str("condition", condition.Name).Logger()
+		cl.Info().Str("budget", budget.String()).Msg("Trying to reproduce")
+
+		result := Result{Condition: condition}
+		start := time.Now()
+		for result.Failures == 0 && (result.Executions == 0 || time.Since(start) < budget) {
+			executions, failures, err := attempt(ctx, condition)
+			if err != nil {
+				return results, fmt.Errorf("failed to run condition '%s': %w", condition.Name, err)
+			}
+			if executions == 0 {
+				return results, fmt.Errorf("test didn't run under condition '%s'", condition.Name)
+			}
+			result.Executions += executions
+			result.Failures += failures
+		}
+		result.Duration = time.Since(start)
+		result.FailureRate = float64(result.Failures) / float64(result.Executions)
+		results = append(results, result)
+
+		cl.Info().
+			Int("executions", result.Executions).
+			Int("failures", result.Failures).
+			Str("duration", result.Duration.String()).
+			Msg("Condition complete")
+		if result.Reproduced() && !all {
+			break
+		}
+	}
+	return results, nil
+}
+
+// WriteReport writes a human-readable table of which conditions reproduced the test, and at what rate
+func WriteReport(w io.Writer, test string, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "Condition\tFlags\tExecutions\tFailures\tFailure Rate\tDuration\t"); err != nil {
+		return err
+	}
+	reproducedBy := []string{}
+	for _, result := range results {
+		if result.Reproduced() {
+			reproducedBy = append(reproducedBy, result.Condition.Name)
+		}
+		flags := strings.Join(result.Condition.GoTestFlags, " ")
+		if flags == "" {
+			flags = "-"
+		}
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.2f%%\t%s\t\n",
+			result.Condition.Name,
+			flags,
+			result.Executions,
+			result.Failures,
+			result.FailureRate*100,
+			result.Duration.Round(time.Millisecond),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(reproducedBy) == 0 {
+		_, err := fmt.Fprintf(w, "Could not reproduce %s failing under any condition\n", test)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "Reproduced %s failing under: %s\n", test, strings.Join(reproducedBy, ", "))
+	return err
+}
@@ -0,0 +1,56 @@
+package reproduce
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/flakeguard/internal/testhelpers"
+)
+
+// failsWithShuffle fakes a test that fails every other execution once tests run in random order
+func failsWithShuffle(_ context.Context, condition Condition) (int, int, error) {
+	for _, flag := range condition.GoTestFlags {
+		if flag == "-shuffle=on" {
+			return 10, 5, nil
+		}
+	}
+	return 10, 0, nil
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	l := testhelpers.Logger(t)
+	results, err := Run(context.Background(), l, DefaultConditions(), time.Millisecond, false, failsWithShuffle)
+	require.NoError(t, err)
+	require.Len(t, results, 3, "should stop at the first condition that reproduces the failure")
+	require.False(t, results[0].Reproduced())
+	require.False(t, results[1].Reproduced())
+	require.True(t, results[2].Reproduced())
+	require.Equal(t, "shuffle", results[2].Condition.Name)
+	require.InDelta(t, 0.5, results[2].FailureRate, 0.001)
+
+	results, err = Run(context.Background(), l, DefaultConditions(), time.Millisecond, true, failsWithShuffle)
+	require.NoError(t, err)
+	require.Len(t, results, len(DefaultConditions()), "should try every condition")
+
+	var report bytes.Buffer
+	require.NoError(t, WriteReport(&report, "TestFlaky", results))
+	require.Contains(t, report.String(), "Reproduced TestFlaky failing under: shuffle, race, cpu")
+}
+
+func TestRunTestNotFound(t *testing.T) {
+	t.Parallel()
+
+	l := testhelpers.Logger(t)
+	_, err := Run(context.Background(), l, DefaultConditions(), time.Millisecond, false,
+		func(_ context.Context, _ Condition) (int, int, error) {
+			return 0, 0, nil
+		},
+	)
+	require.Error(t, err)
+}
@@ -0,0 +1,297 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/smartcontractkit/flakeguard/exit"
+)
+
+// TestBinariesCommand is the hidden flakeguard subcommand that runs pre-compiled test binaries through test2json.
+const TestBinariesCommand = "__test-binaries"
+
+// testBinary is a compiled test binary for a single package
+type testBinary struct {
+	ImportPath string `json:"import_path"`
+	Dir        string `json:"dir"`
+	// Binary is empty if the package has no test files
+	Binary string `json:"binary,omitempty"`
+
+	hasTests bool
+}
+
+// compiledSuite is a set of test binaries compiled with the same build flags
+type compiledSuite struct {
+	manifest string
+	binaries []testBinary
+}
+
+// compiledBinaries compiles the test binaries for the given go test flags, or returns them if they were already
+// compiled with the same build flags and packages.
+func (r *Runner) compiledBinaries(ctx context.Context, args goTestArgs) (*compiledSuite, error) {
+	buildKey := strings.Join(args.buildFlags, " ") + "|" + strings.Join(args.goTestOnlyFlags, " ")
+	key := buildKey + "|" + strings.Join(args.packages, " ")
+
+	r.compileMu.Lock()
+	defer r.compileMu.Unlock()
+	if suite, ok := r.compiled[key]; ok {
+		return suite, nil
+	}
+
+	if r.binariesDir == "" {
+		dir, err := os.MkdirTemp("", "flakeguard-test-binaries-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create test binaries dir: %w", err)
+		}
+		r.binariesDir = dir
+	}
+	suiteDir := filepath.Join(r.binariesDir, strconv.Itoa(len(r.compiled)))
+	if err := os.MkdirAll(suiteDir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create test binaries dir: %w", err)
+	}
+
+	// Narrowed runs only ask for packages that were already compiled, reuse their binaries
+	for compiledKey, compiled := range r.compiled {
+		if !strings.HasPrefix(compiledKey, buildKey+"|") {
+			continue
+		}
+		if suite, ok := compiled.subset(args.packages); ok {
+			if err := suite.writeManifest(suiteDir); err != nil {
+				return nil, err
+			}
+			r.compiled[key] = suite
+			return suite, nil
+		}
+	}
+
+	suite, err := compile(ctx, r.l, args, r.opts.workDir, suiteDir, r.opts.stderr)
+	if err != nil {
+		return nil, err
+	}
+	r.compiled[key] = suite
+	return suite, nil
+}
+
+// compile runs go test -c in workDir once for every package matching the go test args
+func compile(ctx context.Context, l zerolog.Logger, args goTestArgs, workDir, dir string, stderr io.Writer) (*compiledSuite, error) {
+	l = l.With().Strs("build_flags", args.buildFlags).Strs("packages", args.packages).Logger()
+	l.Debug().Msg("Compiling test binaries")
+	start := time.Now()
+
+	binaries, err := listTestPackages(ctx, args, workDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		eg         errgroup.Group
+		buildErrMu sync.Mutex
+		buildErrs  bytes.Buffer
+	)
+	eg.SetLimit(runtime.NumCPU())
+	for i := range binaries {
+		if !binaries[i].hasTests {
+			continue
+		}
+		binaries[i].Binary = filepath.Join(dir, fmt.Sprintf("%d-%s.test", i, path.Base(binaries[i].ImportPath)))
+		eg.Go(func() error {
+			compileArgs := []string{"test", "-c", "-o", binaries[i].Binary}
+			compileArgs = append(compileArgs, args.buildFlags...)
+			compileArgs = append(compileArgs, args.goTestOnlyFlags...)
+			compileArgs = append(compileArgs, binaries[i].ImportPath)
+
+			//nolint:gosec // We're launching go with the user's own flags
+			cmd := exec.CommandContext(ctx, "go", compileArgs...)
+			cmd.Dir = workDir
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				buildErrMu.Lock()
+				buildErrs.Write(out)
+				buildErrMu.Unlock()
+				return fmt.Errorf("failed to compile tests for package %s: %w", binaries[i].ImportPath, err)
+			}
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		_, _ = stderr.Write(buildErrs.Bytes())
+		return nil, exit.New(exit.CodeGoBuildError, fmt.Errorf("go test build failed: %w", err))
+	}
+
+	suite := &compiledSuite{binaries: binaries}
+	if err := suite.writeManifest(dir); err != nil {
+		return nil, err
+	}
+
+	l.Debug().Int("packages", len(binaries)).Str("duration", time.Since(start).String()).Msg("Compiled test binaries")
+	return suite, nil
+}
+
+// subset returns a suite with only the binaries of the given import paths,
+// if all of them are part of this suite
+func (s *compiledSuite) subset(importPaths []string) (*compiledSuite, bool) {
+	binaries := make([]testBinary, 0, len(importPaths))
+	for _, importPath := range importPaths {
+		i := slices.IndexFunc(s.binaries, func(b testBinary) bool {
+			return b.ImportPath == importPath
+		})
+		if i == -1 {
+			return nil, false
+		}
+		binaries = append(binaries, s.binaries[i])
+	}
+	return &compiledSuite{binaries: binaries}, true
+}
+
+// writeManifest writes the list of binaries to a manifest in dir, for the test binaries command to read
+func (s *compiledSuite) writeManifest(dir string) error {
+	manifest := filepath.Join(dir, "manifest.json")
+	manifestBytes, err := json.Marshal(s.binaries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal test binaries manifest: %w", err)
+	}
+	if err := os.WriteFile(manifest, manifestBytes, 0600); err != nil {
+		return fmt.Errorf("failed to write test binaries manifest: %w", err)
+	}
+	s.manifest = manifest
+	return nil
+}
+
+// TestPackages lists the import paths of the packages go test arguments would test
+func TestPackages(ctx context.Context, args []string) ([]string, error) {
+	binaries, err := listTestPackages(ctx, splitGoTestArgs(args), "")
+	if err != nil {
+		return nil, err
+	}
+	packages := make([]string, 0, len(binaries))
+	for _, binary := range binaries {
+		packages = append(packages, binary.ImportPath)
+	}
+	return packages, nil
+}
+
+// listTestPackages lists the packages matching the go test args in workDir, and whether they have any test files
+func listTestPackages(ctx context.Context, args goTestArgs, workDir string) ([]testBinary, error) {
+	listArgs := []string{"list", "-f", "{{.ImportPath}}\t{{.Dir}}\t{{len .TestGoFiles}}\t{{len .XTestGoFiles}}"}
+	listArgs = append(listArgs, args.buildFlags...)
+	listArgs = append(listArgs, args.packages...)
+
+	var stderr bytes.Buffer
+	//nolint:gosec // We're launching go with the user's own flags
+	cmd := exec.CommandContext(ctx, "go", listArgs...)
+	cmd.Dir = workDir
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, exit.New(exit.CodeGoBuildError, fmt.Errorf("go test build failed: go list: %w: %s", err, stderr.String()))
+	}
+
+	binaries := []testBinary{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 4 {
+			continue
+		}
+		binaries = append(binaries, testBinary{
+			ImportPath: fields[0],
+			Dir:        fields[1],
+			hasTests:   fields[2] != "0" || fields[3] != "0",
+		})
+	}
+	if len(binaries) == 0 {
+		return nil, exit.New(exit.CodeGoBuildError, fmt.Errorf("go test build failed: no packages to test"))
+	}
+	return binaries, nil
+}
+
+// RunBinaries runs every test binary in the manifest through test2json, one package at a time, the same way go test -json
+// would. Output is written to stdout in go test -json format.
+// It returns the exit code go test would have returned.
+func RunBinaries(ctx context.Context, manifest string, testArgs []string, stdout, stderr io.Writer) int {
+	manifestBytes, err := os.ReadFile(manifest)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "failed to read test binaries manifest: %v\n", err)
+		return exit.CodeFlakeguardError
+	}
+	var binaries []testBinary
+	if err := json.Unmarshal(manifestBytes, &binaries); err != nil {
+		_, _ = fmt.Fprintf(stderr, "failed to parse test binaries manifest: %v\n", err)
+		return exit.CodeFlakeguardError
+	}
+
+	code := exit.CodeSuccess
+	encoder := json.NewEncoder(stdout)
+	for _, binary := range binaries {
+		if binary.Binary == "" {
+			// Mimic go test -json output for packages without tests
+			for _, event := range []map[string]any{
+				{"Time": time.Now(), "Action": "start", "Package": binary.ImportPath},
+				{
+					"Time":    time.Now(),
+					"Action":  "output",
+					"Package": binary.ImportPath,
+					"Output":  fmt.Sprintf("?   \t%s\t[no test files]\n", binary.ImportPath),
+				},
+				{"Time": time.Now(), "Action": "skip", "Package": binary.ImportPath, "Elapsed": 0},
+			} {
+				if err := encoder.Encode(event); err != nil {
+					_, _ = fmt.Fprintf(stderr, "failed to write output: %v\n", err)
+					return exit.CodeFlakeguardError
+				}
+			}
+			continue
+		}
+
+		if err := runBinary(ctx, binary, testArgs, stdout, stderr); err != nil {
+			if ctx.Err() != nil {
+				return exit.CodeGoFailingTest
+			}
+			code = exit.CodeGoFailingTest
+		}
+	}
+	return code
+}
+
+// runBinary runs a single test binary through test2json.
+// Like go test, test2json converts both stdout and stderr of the binary, so panics and goroutine dumps end up in the output.
+func runBinary(ctx context.Context, binary testBinary, testArgs []string, stdout, stderr io.Writer) error {
+	args := []string{"tool", "test2json", "-t", "-p", binary.ImportPath, binary.Binary, "-test.v=test2json"}
+	args = append(args, testArgs...)
+	//nolint:gosec // We're launching binaries we compiled
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = binary.Dir
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// Close removes any compiled test binaries.
+func (r *Runner) Close() error {
+	r.compileMu.Lock()
+	defer r.compileMu.Unlock()
+	if r.binariesDir == "" {
+		return nil
+	}
+	err := os.RemoveAll(r.binariesDir)
+	r.binariesDir = ""
+	r.compiled = map[string]*compiledSuite{}
+	return err
+}
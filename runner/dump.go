@@ -0,0 +1,68 @@
+package runner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// goroutineDumpStart is the first line a Go program prints when SIGQUIT makes it dump its goroutines
+const goroutineDumpStart = "SIGQUIT: quit"
+
+// saveGoroutineDump pulls the goroutine dumps the test binaries printed before a run was killed out of the run's
+// output, and saves them next to it. It returns the name of the dump file, relative to dir, or "" if no test binary
+// printed a dump.
+func saveGoroutineDump(dir, file string) (string, error) {
+	f, err := os.Open(filepath.Join(dir, file))
+	if err != nil {
+		return "", fmt.Errorf("failed to open run output: %w", err)
+	}
+	defer f.Close()
+
+	dumps := map[string]*strings.Builder{}
+	packages := []string{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var event struct {
+			Action  string
+			Package string
+			Output  string
+		}
+		// The run was killed, so its last line may have been cut off halfway through
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || event.Action != "output" {
+			continue
+		}
+		dump, dumping := dumps[event.Package]
+		if !dumping {
+			if !strings.HasPrefix(event.Output, goroutineDumpStart) {
+				continue
+			}
+			dump = &strings.Builder{}
+			dumps[event.Package] = dump
+			packages = append(packages, event.Package)
+		}
+		dump.WriteString(event.Output)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read run output: %w", err)
+	}
+	if len(dumps) == 0 {
+		return "", nil
+	}
+
+	slices.Sort(packages)
+	var out strings.Builder
+	for _, pkg := range packages {
+		fmt.Fprintf(&out, "=== %s\n%s\n", pkg, dumps[pkg].String())
+	}
+	dumpFile := strings.TrimSuffix(file, filepath.Ext(file)) + "-goroutines.txt"
+	if err := os.WriteFile(filepath.Join(dir, dumpFile), []byte(out.String()), 0600); err != nil {
+		return "", fmt.Errorf("failed to write goroutine dump: %w", err)
+	}
+	return dumpFile, nil
+}
@@ -0,0 +1,211 @@
+package runner
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// defaultTestTimeout matches the timeout go test gives test binaries when -timeout isn't set
+const defaultTestTimeout = "10m0s"
+
+var (
+	// testFlagsWithValues are go test flags that are passed on to the test binary and take a value
+	testFlagsWithValues = map[string]bool{
+		"bench": true, "benchtime": true, "blockprofile": true, "blockprofilerate": true, "count": true,
+		"coverprofile": true, "cpu": true, "cpuprofile": true, "fuzz": true, "fuzzminimizetime": true,
+		"fuzztime": true, "list": true, "memprofile": true, "memprofilerate": true, "mutexprofile": true,
+		"mutexprofilefraction": true, "outputdir": true, "parallel": true, "run": true, "shuffle": true,
+		"skip": true, "timeout": true, "trace": true,
+	}
+	// boolTestFlags are go test flags that are passed on to the test binary and don't need a value
+	boolTestFlags = map[string]bool{
+		"benchmem": true, "failfast": true, "fullpath": true, "short": true, "v": true,
+	}
+	// buildFlagsWithValues are go build flags that take a value
+	buildFlagsWithValues = map[string]bool{
+		"asmflags": true, "buildmode": true, "compiler": true, "covermode": true, "coverpkg": true,
+		"gccgoflags": true, "gcflags": true, "installsuffix": true, "ldflags": true, "mod": true, "modfile": true,
+		"overlay": true, "p": true, "pgo": true, "pkgdir": true, "tags": true, "toolexec": true,
+	}
+	// goTestOnlyFlags are go test flags that only make sense when compiling through go test, not go list
+	goTestOnlyFlags = map[string]bool{
+		"vet": true,
+	}
+	// droppedFlagsWithValues are dropped, as flakeguard decides where binaries go and how they're run
+	droppedFlagsWithValues = map[string]bool{
+		"o": true, "exec": true,
+	}
+	// droppedBoolFlags are handled by flakeguard itself
+	droppedBoolFlags = map[string]bool{
+		"json": true, "c": true,
+	}
+)
+
+// goTestArgs are go test arguments split up by where they need to go when compiling and running test binaries
+type goTestArgs struct {
+	// buildFlags are passed to go list and go test -c
+	buildFlags []string
+	// goTestOnlyFlags are passed to go test -c only
+	goTestOnlyFlags []string
+	// testFlags are translated to -test.* flags for the test binary
+	testFlags []string
+	// packages are the package patterns to test
+	packages []string
+	// binaryArgs come after -args and are passed to the test binary untouched
+	binaryArgs []string
+}
+
+// testBinaryArgs returns the arguments to run a test binary with, matching what go test would pass
+func (a goTestArgs) testBinaryArgs() []string {
+	args := []string{"-test.paniconexit0"}
+	hasTimeout := false
+	for _, flag := range a.testFlags {
+		if strings.HasPrefix(flag, "-test.timeout=") {
+			hasTimeout = true
+		}
+	}
+	if !hasTimeout {
+		args = append(args, "-test.timeout="+defaultTestTimeout)
+	}
+	for _, flag := range a.testFlags {
+		// test2json needs -test.v=test2json, which is always set when running binaries
+		if flag == "-test.v" || strings.HasPrefix(flag, "-test.v=") {
+			continue
+		}
+		args = append(args, flag)
+	}
+	return append(args, a.binaryArgs...)
+}
+
+// splitGoTestArgs splits go test arguments into build flags, test binary flags, packages, and binary args.
+// Unknown flags are treated as build flags, so go reports them when compiling.
+func splitGoTestArgs(args []string) goTestArgs {
+	var split goTestArgs
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-args" || arg == "--args" {
+			split.binaryArgs = append(split.binaryArgs, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			split.packages = append(split.packages, arg)
+			continue
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		name, value, hasValue := strings.Cut(name, "=")
+		// Value flags given as "-flag value" consume the next argument
+		takesValue := testFlagsWithValues[name] || buildFlagsWithValues[name] || goTestOnlyFlags[name] ||
+			droppedFlagsWithValues[name]
+		if takesValue && !hasValue && i+1 < len(args) {
+			i++
+			value, hasValue = args[i], true
+		}
+
+		switch {
+		case testFlagsWithValues[name] || boolTestFlags[name]:
+			flag := "-test." + name
+			if hasValue {
+				flag += "=" + value
+			}
+			split.testFlags = append(split.testFlags, flag)
+		case goTestOnlyFlags[name]:
+			split.goTestOnlyFlags = append(split.goTestOnlyFlags, "-"+name+"="+value)
+		case droppedFlagsWithValues[name] || droppedBoolFlags[name]:
+			continue
+		case hasValue:
+			split.buildFlags = append(split.buildFlags, "-"+name+"="+value)
+		default:
+			split.buildFlags = append(split.buildFlags, "-"+name)
+		}
+	}
+
+	if len(split.packages) == 0 {
+		split.packages = []string{"."}
+	}
+	return split
+}
+
+// NarrowGoTestFlags rewrites go test arguments to only run the given top-level tests in the given packages.
+// Package patterns and -run flags are replaced, every other flag is kept as is.
+// Without any tests, every test in the packages runs.
+func NarrowGoTestFlags(args []string, packages []string, tests []string) []string {
+	narrowed, binaryArgs := withoutFlags(args, "run")
+	if len(tests) > 0 {
+		quoted := make([]string, 0, len(tests))
+		for _, test := range tests {
+			quoted = append(quoted, regexp.QuoteMeta(test))
+		}
+		narrowed = append(narrowed, "-run=^("+strings.Join(quoted, "|")+")$")
+	}
+	narrowed = append(narrowed, packages...)
+	return append(narrowed, binaryArgs...)
+}
+
+// ReplacePackages rewrites go test arguments to test the given packages instead of the package patterns in them
+func ReplacePackages(args []string, packages []string) []string {
+	replaced, binaryArgs := withoutFlags(args)
+	replaced = append(replaced, packages...)
+	return append(replaced, binaryArgs...)
+}
+
+// AddGoTestFlags adds flags to go test arguments, ahead of the package patterns and -args
+func AddGoTestFlags(args []string, flags ...string) []string {
+	added, binaryArgs := withoutFlags(args)
+	added = append(added, flags...)
+	added = append(added, splitGoTestArgs(args).packages...)
+	return append(added, binaryArgs...)
+}
+
+// HasGoTestFlag is true if go test arguments set the flag, e.g. "run"
+func HasGoTestFlag(args []string, name string) bool {
+	kept, _ := withoutFlags(args, name)
+	flags, _ := withoutFlags(args)
+	return len(kept) != len(flags)
+}
+
+// reproductionFlags strips go test arguments down to the flags needed to reproduce a run:
+// package patterns and the flags that decide which tests run and how often are dropped, so they can be set per test.
+func reproductionFlags(args []string) []string {
+	flags, binaryArgs := withoutFlags(args, "run", "skip", "count", "shuffle", "json")
+	return append(flags, binaryArgs...)
+}
+
+// withoutFlags drops package patterns and the named flags from go test arguments.
+// Arguments from -args on are returned separately, untouched.
+func withoutFlags(args []string, names ...string) (flags []string, binaryArgs []string) {
+	flags = make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-args" || arg == "--args" {
+			return flags, args[i:]
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			continue
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		name, _, hasValue := strings.Cut(name, "=")
+		takesValue := testFlagsWithValues[name] || buildFlagsWithValues[name] || goTestOnlyFlags[name] ||
+			droppedFlagsWithValues[name]
+		hasSeparateValue := takesValue && !hasValue && i+1 < len(args)
+		if slices.Contains(names, name) {
+			if hasSeparateValue {
+				i++
+			}
+			continue
+		}
+		flags = append(flags, arg)
+		if hasSeparateValue {
+			i++
+			flags = append(flags, args[i])
+		}
+	}
+	return flags, nil
+}
+
+// BuildFlags returns the go build flags (like -tags) from go test arguments
+func BuildFlags(args []string) []string {
+	return splitGoTestArgs(args).buildFlags
+}
@@ -0,0 +1,95 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitGoTestArgs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected goTestArgs
+		binary   []string
+	}{
+		{
+			name:     "no args",
+			args:     nil,
+			expected: goTestArgs{packages: []string{"."}},
+			binary:   []string{"-test.paniconexit0", "-test.timeout=10m0s"},
+		},
+		{
+			name: "mixed flags",
+			args: []string{"./...", "-tags", "examples", "-run=TestFoo", "-race", "-v", "-count", "1", "-json", "-vet=off"},
+			expected: goTestArgs{
+				buildFlags:      []string{"-tags=examples", "-race"},
+				goTestOnlyFlags: []string{"-vet=off"},
+				testFlags:       []string{"-test.run=TestFoo", "-test.v", "-test.count=1"},
+				packages:        []string{"./..."},
+			},
+			binary: []string{"-test.paniconexit0", "-test.timeout=10m0s", "-test.run=TestFoo", "-test.count=1"},
+		},
+		{
+			name: "timeout and binary args",
+			args: []string{"-timeout", "30s", "./pkg", "-args", "-custom", "value"},
+			expected: goTestArgs{
+				testFlags:  []string{"-test.timeout=30s"},
+				packages:   []string{"./pkg"},
+				binaryArgs: []string{"-custom", "value"},
+			},
+			binary: []string{"-test.paniconexit0", "-test.timeout=30s", "-custom", "value"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			split := splitGoTestArgs(tc.args)
+			assert.Equal(t, tc.expected, split)
+			assert.Equal(t, tc.binary, split.testBinaryArgs())
+		})
+	}
+}
+
+func TestNarrowGoTestFlags(t *testing.T) {
+	t.Parallel()
+
+	narrowed := NarrowGoTestFlags(
+		[]string{"./...", "-tags", "examples", "-run", "TestOld", "-count=1", "-args", "-custom"},
+		[]string{"example.com/pkg"},
+		[]string{"TestA", "TestB"},
+	)
+	assert.Equal(t, []string{
+		"-tags", "examples", "-count=1", "-run=^(TestA|TestB)$", "example.com/pkg", "-args", "-custom",
+	}, narrowed)
+}
+
+func TestReplacePackages(t *testing.T) {
+	t.Parallel()
+
+	args := []string{"./...", "-tags", "examples", "-run", "TestOld", "-args", "-custom"}
+	assert.Equal(t,
+		[]string{"-tags", "examples", "-run", "TestOld", "example.com/a", "example.com/b", "-args", "-custom"},
+		ReplacePackages(args, []string{"example.com/a", "example.com/b"}),
+	)
+	assert.Equal(t,
+		[]string{"-tags", "examples", "-run", "TestOld", "-skip=^TestBad$", "./...", "-args", "-custom"},
+		AddGoTestFlags(args, "-skip=^TestBad$"),
+	)
+	assert.True(t, HasGoTestFlag(args, "run"))
+	assert.False(t, HasGoTestFlag(args, "skip"))
+	assert.False(t, HasGoTestFlag(args, "custom"), "flags after -args are for the test binary")
+}
+
+func TestReproductionFlags(t *testing.T) {
+	t.Parallel()
+
+	flags := reproductionFlags(
+		[]string{"./...", "-tags", "examples", "-run", "TestOld", "-skip=TestBad", "-count=1", "-shuffle=on", "-race", "-args", "-custom"},
+	)
+	assert.Equal(t, []string{"-tags", "examples", "-race", "-args", "-custom"}, flags)
+}
@@ -0,0 +1,106 @@
+package runner
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// matrixValueSeparator separates the values of a matrix dimension, commas are already used by flags like -cpu
+const matrixValueSeparator = "|"
+
+// MatrixDimension is a single setting that is rotated across runs
+type MatrixDimension struct {
+	// Name is a go test flag like -cpu if it starts with a dash, otherwise it is an environment variable like GOMAXPROCS
+	Name   string
+	Values []string
+}
+
+// IsFlag reports whether the dimension is a go test flag, rather than an environment variable
+func (d MatrixDimension) IsFlag() bool {
+	return strings.HasPrefix(d.Name, "-")
+}
+
+// Matrix rotates settings across runs, so that each run executes under a different combination of them
+type Matrix []MatrixDimension
+
+// ParseMatrix parses matrix dimensions formatted like "-cpu=1|2|4" for go test flags or "TZ=UTC|Asia/Tokyo" for
+// environment variables.
+func ParseMatrix(dimensions []string) (Matrix, error) {
+	matrix := make(Matrix, 0, len(dimensions))
+	for _, dimension := range dimensions {
+		name, values, found := strings.Cut(dimension, "=")
+		name = strings.TrimSpace(name)
+		if !found || strings.Trim(name, "-") == "" || values == "" {
+			return nil, fmt.Errorf("invalid matrix dimension '%s', expected '<-flag or ENV_VAR>=<value>%s<value>'", dimension, matrixValueSeparator)
+		}
+		if strings.HasPrefix(name, "-") {
+			// Normalize -flag and --flag
+			name = "-" + strings.TrimLeft(name, "-")
+			if name == "-count" || name == "-json" {
+				return nil, fmt.Errorf("%s flag cannot be part of the matrix while using flakeguard", name)
+			}
+		}
+		if slices.ContainsFunc(matrix, func(d MatrixDimension) bool { return d.Name == name }) {
+			return nil, fmt.Errorf("matrix dimension '%s' is set more than once", name)
+		}
+		matrix = append(matrix, MatrixDimension{Name: name, Values: strings.Split(values, matrixValueSeparator)})
+	}
+	return matrix, nil
+}
+
+// Settings returns the combination of settings for a run. Runs rotate through every combination in order.
+func (m Matrix) Settings(runNumber int) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	settings := make(map[string]string, len(m))
+	index := runNumber - 1
+	for _, dimension := range m {
+		settings[dimension.Name] = dimension.Values[index%len(dimension.Values)]
+		index /= len(dimension.Values)
+	}
+	return settings
+}
+
+// Apply sets the matrix settings for the spec's run number on the spec.
+// Matrix flags replace the same flags the user already passed.
+func (m Matrix) Apply(spec Spec) Spec {
+	settings := m.Settings(spec.Number)
+	if settings == nil {
+		return spec
+	}
+
+	goTestFlags := make([]string, 0, len(spec.GoTestFlags)+len(m))
+	var binaryArgs []string
+	for i := 0; i < len(spec.GoTestFlags); i++ {
+		flag := spec.GoTestFlags[i]
+		if flag == "-args" || flag == "--args" {
+			binaryArgs = spec.GoTestFlags[i:]
+			break
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(flag, "-"), "=")
+		if strings.HasPrefix(flag, "-") && slices.ContainsFunc(m, func(d MatrixDimension) bool { return d.Name == "-"+name }) {
+			// Skip the value of "-flag value" too
+			if !hasValue && (testFlagsWithValues[name] || buildFlagsWithValues[name]) {
+				i++
+			}
+			continue
+		}
+		goTestFlags = append(goTestFlags, flag)
+	}
+	env := slices.Clone(spec.Env)
+	for _, dimension := range m {
+		value := settings[dimension.Name]
+		if dimension.IsFlag() {
+			goTestFlags = append(goTestFlags, dimension.Name+"="+value)
+		} else {
+			env = append(env, dimension.Name+"="+value)
+		}
+	}
+
+	spec.GoTestFlags = append(goTestFlags, binaryArgs...)
+	spec.Env = env
+	spec.Settings = settings
+	return spec
+}
@@ -0,0 +1,46 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMatrix(t *testing.T) {
+	t.Parallel()
+
+	matrix, err := ParseMatrix([]string{"--cpu=1,2|4", "TZ=UTC|Asia/Tokyo"})
+	require.NoError(t, err)
+	assert.Equal(t, Matrix{
+		{Name: "-cpu", Values: []string{"1,2", "4"}},
+		{Name: "TZ", Values: []string{"UTC", "Asia/Tokyo"}},
+	}, matrix)
+
+	for _, invalid := range []string{"-cpu", "-cpu=", "=1|2", "-count=1|2", "-cpu=1|2 -cpu=4"} {
+		_, err := ParseMatrix(append([]string{"-cpu=1"}, invalid))
+		assert.Error(t, err, "expected '%s' to be invalid", invalid)
+	}
+}
+
+func TestMatrixApply(t *testing.T) {
+	t.Parallel()
+
+	matrix := Matrix{
+		{Name: "-cpu", Values: []string{"1", "4"}},
+		{Name: "TZ", Values: []string{"UTC", "Asia/Tokyo"}},
+	}
+
+	seen := map[string]bool{}
+	for number := 1; number <= 4; number++ {
+		spec := matrix.Apply(Spec{
+			Number:      number,
+			GoTestFlags: []string{"./...", "-cpu", "2", "-count=1", "-args", "-cpu=8"},
+		})
+		require.Len(t, spec.Settings, 2)
+		assert.Equal(t, []string{"./...", "-count=1", "-cpu=" + spec.Settings["-cpu"], "-args", "-cpu=8"}, spec.GoTestFlags)
+		assert.Equal(t, []string{"TZ=" + spec.Settings["TZ"]}, spec.Env)
+		seen[spec.Settings["-cpu"]+" "+spec.Settings["TZ"]] = true
+	}
+	assert.Len(t, seen, 4, "runs should rotate through every combination")
+}
@@ -0,0 +1,505 @@
+// Package runner executes go test suites through gotestsum.
+// Every run executes in its own process with its own temporary directories, so runs can safely execute in parallel.
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/smartcontractkit/flakeguard/exit"
+	"github.com/smartcontractkit/flakeguard/report"
+)
+
+const (
+	// GotestsumCommand is the hidden flakeguard subcommand that runs gotestsum in its own process.
+	GotestsumCommand = "__gotestsum"
+	// PortRangeEnvVar hints to tests which ports they can bind to without colliding with other parallel runs.
+	// It is formatted as "<first>-<last>", both inclusive.
+	PortRangeEnvVar = "FLAKEGUARD_PORT_RANGE"
+
+	portRangeStart = 20000
+	portRangeSize  = 1000
+
+	// interruptGracePeriod is how long a run has to exit after being interrupted before it is killed
+	interruptGracePeriod = 10 * time.Second
+	// stallPollInterval is how often runs are checked for new test output when watching for stalls
+	stallPollInterval = time.Second
+)
+
+// Spec describes a single run of the test suite
+type Spec struct {
+	// Number is the 1-based number of the run, used to name its output file
+	Number int
+	// Phase is the phase of the detect session the run belongs to, see report.PhaseFull
+	Phase          string
+	GotestsumFlags []string
+	GoTestFlags    []string
+	// Env is set for the run on top of the inherited environment
+	Env []string
+	// Settings are the matrix settings the run executes with, see Matrix
+	Settings map[string]string
+}
+
+// options holds the options for the runner.
+type options struct {
+	dir             string
+	workDir         string
+	fileFormat      string
+	executable      string
+	stdout          io.Writer
+	stderr          io.Writer
+	compileBinaries bool
+	onRunCompleted  func(report.Run)
+	runTimeout      time.Duration
+	stallTimeout    time.Duration
+	group           func(w io.Writer, title string) (end func())
+}
+
+func defaultOptions() options {
+	return options{
+		dir:        "./flakeguard-output",
+		fileFormat: "test-output-%d.json",
+		stdout:     os.Stdout,
+		stderr:     os.Stderr,
+	}
+}
+
+// Option is a function that sets an option for the runner.
+type Option func(*options)
+
+// WithDir sets the directory to write go test -json output files to.
+func WithDir(dir string) Option {
+	return func(o *options) {
+		o.dir = dir
+	}
+}
+
+// WithWorkDir runs go test in dir instead of the current directory, e.g. a different checkout of the repository.
+// Package patterns and relative paths in go test flags are resolved from it, while WithDir is not.
+func WithWorkDir(dir string) Option {
+	return func(o *options) {
+		o.workDir = dir
+	}
+}
+
+// WithFileFormat sets the format of the output file names, it is formatted with the run number.
+func WithFileFormat(format string) Option {
+	return func(o *options) {
+		o.fileFormat = format
+	}
+}
+
+// WithExecutable sets the flakeguard binary used to launch gotestsum processes.
+// Defaults to the currently running executable.
+func WithExecutable(path string) Option {
+	return func(o *options) {
+		o.executable = path
+	}
+}
+
+// WithOutput sets where the console output of runs is written to. Defaults to stdout and stderr.
+func WithOutput(stdout, stderr io.Writer) Option {
+	return func(o *options) {
+		o.stdout = stdout
+		o.stderr = stderr
+	}
+}
+
+// WithCompiledBinaries compiles each package's test binary once with go test -c, then runs the binaries directly
+// through test2json for every run, skipping the package loading and linking go test does every time.
+// Call Close to remove the binaries when done.
+func WithCompiledBinaries() Option {
+	return func(o *options) {
+		o.compileBinaries = true
+	}
+}
+
+// WithRunCompleted calls fn every time a run completes successfully, e.g. to keep track of progress.
+// Calls are never concurrent.
+func WithRunCompleted(fn func(report.Run)) Option {
+	return func(o *options) {
+		o.onRunCompleted = fn
+	}
+}
+
+// WithRunTimeout kills runs that take longer than timeout. Test binaries are sent SIGQUIT first, so the output of
+// killed runs includes the stacks of all their goroutines. Killed runs are reported as such, not as errors.
+func WithRunTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.runTimeout = timeout
+	}
+}
+
+// WithStallTimeout kills runs that haven't produced any test output for timeout, most likely because of a deadlock.
+// Like with WithRunTimeout, test binaries are sent SIGQUIT first, and their goroutine dump is saved next to the
+// run's output.
+func WithStallTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.stallTimeout = timeout
+	}
+}
+
+// WithOutputGroups wraps the console output of each run in a group started by group, e.g. a collapsible group in the
+// GitHub Actions log
+func WithOutputGroups(group func(w io.Writer, title string) (end func())) Option {
+	return func(o *options) {
+		o.group = group
+	}
+}
+
+// Runner executes runs of a test suite
+type Runner struct {
+	l    zerolog.Logger
+	opts options
+
+	// outputMu keeps the buffered output of parallel runs from interleaving
+	outputMu sync.Mutex
+
+	// Build flags and packages -> compiled test binaries
+	compiled    map[string]*compiledSuite
+	compileMu   sync.Mutex
+	binariesDir string
+}
+
+// New creates a new Runner.
+func New(l zerolog.Logger, options ...Option) (*Runner, error) {
+	opts := defaultOptions()
+	for _, option := range options {
+		option(&opts)
+	}
+
+	if opts.executable == "" {
+		executable, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find flakeguard executable: %w", err)
+		}
+		opts.executable = executable
+	}
+	if opts.workDir != "" {
+		// Runs write their output from the work dir
+		dir, err := filepath.Abs(opts.dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve output dir: %w", err)
+		}
+		opts.dir = dir
+	}
+
+	return &Runner{
+		l:        l,
+		opts:     opts,
+		compiled: map[string]*compiledSuite{},
+	}, nil
+}
+
+// Runs executes all specs, running up to parallel of them at a time.
+// Before each run is started, next is consulted. If it returns false, no more runs are started.
+// Completed runs are returned in order of their numbers, even if an error occurs.
+func (r *Runner) Runs(ctx context.Context, specs []Spec, parallel int, next func() bool) ([]report.Run, error) {
+	if parallel < 1 {
+		parallel = 1
+	}
+	isParallel := parallel > 1 && len(specs) > 1
+
+	slots := make(chan int, parallel)
+	for slot := range parallel {
+		slots <- slot
+	}
+
+	var (
+		eg, egCtx = errgroup.WithContext(ctx)
+		runsMu    sync.Mutex
+		runs      = make([]report.Run, 0, len(specs))
+	)
+
+specLoop:
+	for _, spec := range specs {
+		var slot int
+		select {
+		case slot = <-slots:
+		case <-egCtx.Done():
+			break specLoop
+		}
+		if egCtx.Err() != nil || (next != nil && !next()) {
+			break
+		}
+
+		eg.Go(func() error {
+			defer func() { slots <- slot }()
+
+			run, err := r.Run(egCtx, spec, slot, isParallel)
+			if err != nil {
+				return err
+			}
+			runsMu.Lock()
+			runs = append(runs, run)
+			if r.opts.onRunCompleted != nil {
+				r.opts.onRunCompleted(run)
+			}
+			runsMu.Unlock()
+			return nil
+		})
+	}
+
+	err := eg.Wait()
+	slices.SortFunc(runs, func(a, b report.Run) int {
+		return a.Number - b.Number
+	})
+	if err == nil {
+		err = ctx.Err()
+	}
+	return runs, err
+}
+
+// Run executes a single run of the test suite in its own gotestsum process.
+// The slot identifies which of the parallel runs this is, and decides the port range hinted to its tests.
+func (r *Runner) Run(ctx context.Context, spec Spec, slot int, parallel bool) (report.Run, error) {
+	file := fmt.Sprintf(r.opts.fileFormat, spec.Number)
+	l := r.l.With().
+		Int("run", spec.Number).
+		Int("slot", slot).
+		Str("detect_results_file", file).
+		Strs("gotestsum_flags", spec.GotestsumFlags).
+		Strs("go_test_flags", spec.GoTestFlags).
+		Logger()
+
+	tmpDir, err := os.MkdirTemp("", fmt.Sprintf("flakeguard-run-%d-", spec.Number))
+	if err != nil {
+		return report.Run{}, fmt.Errorf("failed to create temp dir for run %d: %w", spec.Number, err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			l.Warn().Err(err).Str("dir", tmpDir).Msg("Failed to remove run temp dir")
+		}
+	}()
+	runEnv, err := isolatedEnv(tmpDir, slot)
+	if err != nil {
+		return report.Run{}, err
+	}
+	runEnv = append(slices.Clone(spec.Env), runEnv...)
+	if r.opts.runTimeout > 0 || r.opts.stallTimeout > 0 {
+		runEnv = append(runEnv, tracebackEnv(spec.Env)...)
+	}
+
+	args := []string{GotestsumCommand}
+	args = append(args, spec.GotestsumFlags...)
+	args = append(args, "--jsonfile", filepath.Join(r.opts.dir, file))
+	if r.opts.compileBinaries {
+		goTestArgs := splitGoTestArgs(spec.GoTestFlags)
+		suite, err := r.compiledBinaries(ctx, goTestArgs)
+		if err != nil {
+			return report.Run{}, err
+		}
+		// gotestsum runs our binaries instead of go test, and reads their output the same way
+		args = append(args, "--raw-command", "--", r.opts.executable, TestBinariesCommand, suite.manifest, "--")
+		args = append(args, goTestArgs.testBinaryArgs()...)
+	} else {
+		args = append(args, "--")
+		args = append(args, spec.GoTestFlags...)
+	}
+
+	//nolint:gosec // We're launching our own executable
+	cmd := exec.CommandContext(ctx, r.opts.executable, args...)
+	cmd.Dir = r.opts.workDir
+	cmd.Env = append(os.Environ(), runEnv...)
+	// Run in our own process group so we can signal gotestsum, go test, and the test binaries all at once
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGINT)
+	}
+	cmd.WaitDelay = interruptGracePeriod
+
+	var stdout, stderr bytes.Buffer
+	if parallel {
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	} else {
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, r.opts.stdout, r.opts.stderr
+		if r.opts.group != nil {
+			end := r.opts.group(r.opts.stdout, fmt.Sprintf("Run %d", spec.Number))
+			defer end()
+		}
+	}
+
+	l.Debug().Strs("env", runEnv).Msg("Starting run")
+	start := time.Now()
+	var killReason atomic.Pointer[string]
+	err = cmd.Start()
+	if err == nil {
+		done := make(chan struct{})
+		if r.opts.runTimeout > 0 || r.opts.stallTimeout > 0 {
+			go r.watch(l, cmd.Process.Pid, filepath.Join(r.opts.dir, file), done, &killReason)
+		}
+		err = cmd.Wait()
+		close(done)
+	}
+	duration := time.Since(start)
+	if cmd.Process != nil {
+		// Clean up anything left behind in the process group, it's fine if there's nothing left
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	l.Debug().Err(err).Str("duration", duration.String()).Msg("Run completed")
+
+	if parallel {
+		r.outputMu.Lock()
+		if r.opts.group != nil {
+			// Stderr goes in the group too, the log shows both streams together anyway
+			end := r.opts.group(r.opts.stdout, fmt.Sprintf("Run %d", spec.Number))
+			_, _ = r.opts.stdout.Write(stdout.Bytes())
+			_, _ = r.opts.stdout.Write(stderr.Bytes())
+			end()
+		} else {
+			_, _ = fmt.Fprintf(r.opts.stdout, "Run %d output:\n%s", spec.Number, stdout.String())
+			_, _ = r.opts.stderr.Write(stderr.Bytes())
+		}
+		r.outputMu.Unlock()
+	}
+
+	run := report.Run{
+		Number:            spec.Number,
+		Phase:             spec.Phase,
+		File:              file,
+		Started:           start,
+		Duration:          duration,
+		Parallel:          parallel,
+		Env:               runEnv,
+		GoTestFlags:       spec.GoTestFlags,
+		ReproductionFlags: reproductionFlags(spec.GoTestFlags),
+		Settings:          spec.Settings,
+	}
+	if ctx.Err() != nil {
+		return run, ctx.Err()
+	}
+	if reason := killReason.Load(); reason != nil {
+		run.Killed = true
+		run.KillReason = *reason
+		dumpFile, err := saveGoroutineDump(r.opts.dir, file)
+		if err != nil {
+			l.Warn().Err(err).Msg("Failed to save goroutine dump of killed run")
+		}
+		run.GoroutineDump = dumpFile
+		return run, nil
+	}
+	if err != nil {
+		code := exitCode(err)
+		if code != exit.CodeGoFailingTest { // Exit code 1 is expected when there are flaky tests
+			return run, exit.New(code, err)
+		}
+	}
+	return run, nil
+}
+
+// watch kills the run's process group if it runs longer than the run timeout, or stops producing test output for the
+// stall timeout. SIGQUIT goes first, so the test binaries print their goroutines before exiting. Flakeguard's own
+// processes and the go command ignore it, and pass the dump on as test output.
+func (r *Runner) watch(l zerolog.Logger, pid int, outputFile string, done <-chan struct{}, killReason *atomic.Pointer[string]) {
+	var timeout, poll <-chan time.Time
+	if r.opts.runTimeout > 0 {
+		timer := time.NewTimer(r.opts.runTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	if r.opts.stallTimeout > 0 {
+		ticker := time.NewTicker(min(stallPollInterval, r.opts.stallTimeout/4))
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	// gotestsum writes every event to the output file as it happens, so the file not growing means nothing is happening
+	var (
+		reason     string
+		lastSize   int64 = -1
+		lastChange       = time.Now()
+	)
+watch:
+	for {
+		select {
+		case <-done:
+			return
+		case <-timeout:
+			reason = fmt.Sprintf("run timed out after %s", r.opts.runTimeout)
+			break watch
+		case <-poll:
+			var size int64
+			if info, err := os.Stat(outputFile); err == nil {
+				size = info.Size()
+			}
+			if size != lastSize {
+				lastSize, lastChange = size, time.Now()
+				continue
+			}
+			if time.Since(lastChange) >= r.opts.stallTimeout {
+				reason = fmt.Sprintf("no test output for %s", r.opts.stallTimeout)
+				break watch
+			}
+		}
+	}
+
+	killReason.Store(&reason)
+	l.Warn().Str("reason", reason).Msg("Dumping goroutines and killing run")
+	_ = syscall.Kill(-pid, syscall.SIGQUIT)
+	select {
+	case <-done:
+	case <-time.After(interruptGracePeriod):
+		_ = syscall.Kill(-pid, syscall.SIGKILL)
+	}
+}
+
+// tracebackEnv makes test binaries include every goroutine when they dump their stacks, unless the user asked otherwise
+func tracebackEnv(env []string) []string {
+	if _, set := os.LookupEnv("GOTRACEBACK"); set {
+		return nil
+	}
+	for _, v := range env {
+		if strings.HasPrefix(v, "GOTRACEBACK=") {
+			return nil
+		}
+	}
+	return []string{"GOTRACEBACK=all"}
+}
+
+// isolatedEnv creates temp dirs for the run and returns the environment that points the run at them,
+// along with a port range that doesn't overlap with other slots.
+func isolatedEnv(tmpDir string, slot int) ([]string, error) {
+	goTmpDir := filepath.Join(tmpDir, "gotmp")
+	testTmpDir := filepath.Join(tmpDir, "tmp")
+	for _, dir := range []string{goTmpDir, testTmpDir} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return nil, fmt.Errorf("failed to create temp dir '%s': %w", dir, err)
+		}
+	}
+
+	firstPort := portRangeStart + slot*portRangeSize
+	return []string{
+		"GOTMPDIR=" + goTmpDir,
+		"TMPDIR=" + testTmpDir,
+		fmt.Sprintf("%s=%d-%d", PortRangeEnvVar, firstPort, firstPort+portRangeSize-1),
+	}, nil
+}
+
+// exitCode extracts the exit code from an error returned by exec.Cmd
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		if status, ok := exitError.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+	}
+	return -1 // Unknown exit code
+}
@@ -0,0 +1,194 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/flakeguard/exit"
+	"github.com/smartcontractkit/flakeguard/internal/testhelpers"
+	"github.com/smartcontractkit/flakeguard/report"
+)
+
+// fakeGotestsum writes the isolated environment it was given into its jsonfile, then exits with the given code
+const fakeGotestsum = `#!/bin/sh
+while [ "$1" != "--jsonfile" ]; do shift; done
+echo "$TMPDIR $GOTMPDIR $FLAKEGUARD_PORT_RANGE" > "$2"
+exit %s
+`
+
+func writeFakeGotestsum(t *testing.T, exitCode string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "fake-flakeguard")
+	//nolint:gosec // G306: the fake needs to be executable
+	err := os.WriteFile(path, []byte(strings.Replace(fakeGotestsum, "%s", exitCode, 1)), 0700)
+	require.NoError(t, err)
+	return path
+}
+
+func TestRunsParallel(t *testing.T) {
+	t.Parallel()
+
+	var (
+		l      = testhelpers.Logger(t)
+		dir    = t.TempDir()
+		stdout = bytes.NewBuffer(nil)
+	)
+	r, err := New(
+		l,
+		WithDir(dir),
+		WithExecutable(writeFakeGotestsum(t, "1")),
+		WithOutput(stdout, stdout),
+	)
+	require.NoError(t, err)
+
+	specs := []Spec{{Number: 1}, {Number: 2}, {Number: 3}, {Number: 4}}
+	runs, err := r.Runs(context.Background(), specs, 2, nil)
+	require.NoError(t, err, "exit code 1 means failing tests and should not be an error")
+	require.Len(t, runs, len(specs))
+
+	tmpDirs := map[string]bool{}
+	portRanges := map[string]bool{}
+	for i, run := range runs {
+		assert.Equal(t, i+1, run.Number, "runs should be sorted by number")
+		assert.True(t, run.Parallel, "runs should be marked as parallel")
+
+		content, err := os.ReadFile(filepath.Join(dir, run.File))
+		require.NoError(t, err)
+		fields := strings.Fields(string(content))
+		require.Len(t, fields, 3, "expected TMPDIR, GOTMPDIR, and port range in output")
+		tmpDirs[fields[0]] = true
+		tmpDirs[fields[1]] = true
+		portRanges[fields[2]] = true
+		assert.NoDirExists(t, fields[0], "run temp dirs should be cleaned up")
+	}
+	assert.Len(t, tmpDirs, len(specs)*2, "every run should get its own temp dirs")
+	assert.Len(t, portRanges, 2, "port ranges should be reused by slot")
+}
+
+func TestRunsSequentialStops(t *testing.T) {
+	t.Parallel()
+
+	var (
+		l         = testhelpers.Logger(t)
+		completed []int
+		stdout    = bytes.NewBuffer(nil)
+	)
+	r, err := New(
+		l,
+		WithDir(t.TempDir()),
+		WithExecutable(writeFakeGotestsum(t, "0")),
+		WithOutput(stdout, bytes.NewBuffer(nil)),
+		WithRunCompleted(func(run report.Run) {
+			completed = append(completed, run.Number)
+		}),
+		WithOutputGroups(func(w io.Writer, title string) func() {
+			_, _ = fmt.Fprintf(w, "[%s]\n", title)
+			return func() { _, _ = fmt.Fprintf(w, "[/%s]\n", title) }
+		}),
+	)
+	require.NoError(t, err)
+
+	started := 0
+	runs, err := r.Runs(context.Background(), []Spec{{Number: 1}, {Number: 2}, {Number: 3}}, 1, func() bool {
+		started++
+		return started <= 2
+	})
+	require.NoError(t, err)
+	require.Len(t, runs, 2, "runs should stop once next returns false")
+	assert.Equal(t, []int{1, 2}, completed, "every completed run should be reported")
+	assert.False(t, runs[0].Parallel, "sequential runs should not be marked as parallel")
+	assert.Equal(t, "[Run 1]\n[/Run 1]\n[Run 2]\n[/Run 2]\n", stdout.String(), "each run's output should be grouped")
+}
+
+func TestRunBuildError(t *testing.T) {
+	t.Parallel()
+
+	l := testhelpers.Logger(t)
+	r, err := New(
+		l,
+		WithDir(t.TempDir()),
+		WithExecutable(writeFakeGotestsum(t, "2")),
+		WithOutput(bytes.NewBuffer(nil), bytes.NewBuffer(nil)),
+	)
+	require.NoError(t, err)
+
+	_, err = r.Run(context.Background(), Spec{Number: 1}, 0, false)
+	require.Error(t, err)
+	assert.Equal(t, exit.CodeGoBuildError, exit.GetCode(err))
+}
+
+func TestRunTimeout(t *testing.T) {
+	t.Parallel()
+
+	// The fake hangs until it's killed, the same way a test binary stuck in a test would
+	hanging := filepath.Join(t.TempDir(), "fake-flakeguard")
+	//nolint:gosec // G306: the fake needs to be executable
+	require.NoError(t, os.WriteFile(hanging, []byte("#!/bin/sh\nexec sleep 60\n"), 0700))
+
+	l := testhelpers.Logger(t)
+	r, err := New(
+		l,
+		WithDir(t.TempDir()),
+		WithExecutable(hanging),
+		WithOutput(bytes.NewBuffer(nil), bytes.NewBuffer(nil)),
+		WithRunTimeout(100*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	run, err := r.Run(context.Background(), Spec{Number: 1}, 0, false)
+	require.NoError(t, err, "killed runs should not be errors")
+	assert.True(t, run.Killed, "run should be marked as killed")
+	assert.Less(t, run.Duration, 30*time.Second, "run should be killed soon after the timeout")
+}
+
+func TestRunStalled(t *testing.T) {
+	t.Parallel()
+
+	// The fake writes some test output, including the goroutine dump of a test binary, then goes quiet
+	script := `#!/bin/sh
+cat > "$3" <<'EOF'
+{"Action":"run","Package":"pkg","Test":"TestHang"}
+{"Action":"output","Package":"pkg","Test":"TestHang","Output":"=== RUN   TestHang\n"}
+{"Action":"output","Package":"pkg","Test":"TestHang","Output":"SIGQUIT: quit\n"}
+{"Action":"output","Package":"pkg","Test":"TestHang","Output":"goroutine 1 [sleep]:\n"}
+{"Action":"outp
+EOF
+exec sleep 60
+`
+	stalling := filepath.Join(t.TempDir(), "fake-flakeguard")
+	//nolint:gosec // G306: the fake needs to be executable
+	require.NoError(t, os.WriteFile(stalling, []byte(script), 0700))
+
+	dir := t.TempDir()
+	l := testhelpers.Logger(t)
+	r, err := New(
+		l,
+		WithDir(dir),
+		WithExecutable(stalling),
+		WithOutput(bytes.NewBuffer(nil), bytes.NewBuffer(nil)),
+		WithStallTimeout(200*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	run, err := r.Run(context.Background(), Spec{Number: 1}, 0, false)
+	require.NoError(t, err, "killed runs should not be errors")
+	require.True(t, run.Killed, "stalled run should be marked as killed")
+	assert.Contains(t, run.KillReason, "no test output")
+	assert.Contains(t, run.Env, "GOTRACEBACK=all")
+	require.NotEmpty(t, run.GoroutineDump, "goroutine dump should be saved")
+
+	dump, err := os.ReadFile(filepath.Join(dir, run.GoroutineDump))
+	require.NoError(t, err)
+	assert.Equal(t, "=== pkg\nSIGQUIT: quit\ngoroutine 1 [sleep]:\n\n", string(dump))
+}
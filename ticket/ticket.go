@@ -0,0 +1,49 @@
+// Package ticket tracks flaky tests in a ticketing system, one ticket per test, so every quarantined test has an
+// owner and a record of how often it's still failing until it's fixed and reinstated.
+package ticket
+
+import (
+	"context"
+)
+
+// Ticketer opens, updates, and closes the tickets of flaky tests
+type Ticketer interface {
+	// Report opens a ticket for a flaky test, or adds the occurrence to the test's ticket if it already has one,
+	// reopening it if it was closed
+	Report(ctx context.Context, o Occurrence) (Ticket, error)
+	// Open lists the open tickets of flaky tests
+	Open(ctx context.Context) ([]Ticket, error)
+	// MarkQuarantined records on the ticket that its test was seen quarantined on the base branch
+	MarkQuarantined(ctx context.Context, t Ticket) error
+	// Close closes the ticket of a test that no longer needs tracking, commenting why
+	Close(ctx context.Context, t Ticket, reason string) error
+}
+
+// Ticket tracks a single flaky test
+type Ticket struct {
+	Package string
+	Test    string
+	// ID is how the ticketing system refers to the ticket, like #12
+	ID  string
+	URL string
+	// Created is true if the ticket was opened by the last Report
+	Created bool
+	// Quarantined is true once the test was seen quarantined on the base branch, so its ticket can be closed when it's
+	// reinstated. Tests whose quarantine was never merged aren't reinstated.
+	Quarantined bool
+}
+
+// Occurrence is a flaky test found by flakeguard
+type Occurrence struct {
+	Package   string
+	Test      string
+	Branch    string
+	FlakeRate float64
+	Runs      int
+	// Path of the file the test is in, relative to the root of the repository, empty if unknown
+	Path string
+	// Owners are the code owners of Path
+	Owners []string
+	// Link to where the occurrence was found, like the quarantine pull request, if there is one
+	Link string
+}